@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/term"
+
+	"clap/pkg/clap"
+)
+
+// setupApply implements "clap apply": it writes the files of an edited
+// plain bundle back over the tree they came from, after showing what will
+// change.
+func setupApply(fs *flag.FlagSet) func(args []string) error {
+	root := fs.String("root", ".", "directory the bundle's paths are relative to")
+	yes := fs.Bool("yes", false, "apply without asking")
+	return func(args []string) error {
+		positional, err := parseInterleaved(fs, args)
+		if err != nil {
+			return err
+		}
+		if len(positional) != 1 {
+			return errUsage
+		}
+		return apply(hostPath(positional[0]), hostPath(*root), *yes)
+	}
+}
+
+// change is a file apply will write.
+type change struct {
+	path    string // as in the bundle
+	target  string // on disk
+	old     []byte // nil for a new file
+	content []byte
+	mode    fs.FileMode
+}
+
+// apply writes every file in the bundle at bundlePath whose content
+// differs from the one below root, once confirmed.
+func apply(bundlePath, root string, yes bool) error {
+	files, err := readApplyFiles(bundlePath)
+	if err != nil {
+		return err
+	}
+
+	var changes []change
+	for _, f := range files {
+		path, content := f.Path, f.Content
+		target, err := safeJoin(root, path)
+		if err != nil {
+			logf("Skipping %s: %v\n", path, err)
+			continue
+		}
+
+		c := change{path: path, target: target, content: content, mode: 0644}
+		old, err := os.ReadFile(target)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+		case err != nil:
+			return err
+		case bytes.Equal(old, content):
+			continue
+		default:
+			c.old = old
+			if info, err := os.Stat(target); err == nil {
+				c.mode = info.Mode().Perm()
+			}
+		}
+		changes = append(changes, c)
+	}
+	if len(changes) == 0 {
+		logf("Nothing to apply: %s matches %s\n", root, bundlePath)
+		return nil
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	for _, c := range changes {
+		oldName := c.path
+		if c.old == nil {
+			oldName = ""
+		}
+		writeUnified(out, oldName, c.path, c.old, c.content, 3)
+	}
+	if err := out.Flush(); err != nil {
+		return err
+	}
+
+	if !yes {
+		ok, err := confirm(fmt.Sprintf("Apply changes to %d files in %s?", len(changes), root))
+		if err != nil {
+			return fmt.Errorf("%v; pass --yes to apply without asking", err)
+		}
+		if !ok {
+			logf("Nothing applied\n")
+			return nil
+		}
+	}
+
+	for _, c := range changes {
+		if err := os.MkdirAll(filepath.Dir(c.target), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(c.target, c.content, c.mode); err != nil {
+			return err
+		}
+		verb := "Updated"
+		if c.old == nil {
+			verb = "Created"
+		}
+		logf("%s %s\n", verb, c.target)
+	}
+	logf("Applied %d files from %s\n", len(changes), bundlePath)
+	return nil
+}
+
+// errNoTerminal is confirm's error when there is no one to ask.
+var errNoTerminal = errors.New("not a terminal")
+
+// readApplyFiles reads the files of the bundle at bundlePath that apply
+// may write, in bundle order. Deduplicated copies are left out: they stand
+// for the file they name, which is written in their place.
+func readApplyFiles(bundlePath string) ([]clap.BundleFile, error) {
+	f, err := openBundle(bundlePath, nil)
+	if err != nil {
+		return nil, fmt.Errorf("opening bundle %s: %v", bundlePath, err)
+	}
+	defer f.Close()
+
+	var files []clap.BundleFile
+	index := map[string]int{}
+	err = clap.ReadBundleFiles(f, func(file clap.BundleFile) error {
+		if file.DuplicateOf != "" {
+			return nil
+		}
+		if i, dup := index[file.Path]; dup {
+			files[i] = file
+			return nil
+		}
+		index[file.Path] = len(files)
+		files = append(files, file)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading bundle %s: %v", bundlePath, err)
+	}
+	return files, nil
+}
+
+// confirm asks a yes/no question on the terminal. Without one, it fails
+// rather than guess.
+func confirm(question string) (bool, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return false, errNoTerminal
+	}
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		return false, nil
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+)
+
+// The completion command lists every command, including itself, so it
+// joins the list here rather than in its initializer.
+func init() {
+	commands = append(commands, &command{name: "completion", synopsis: "bash|zsh|fish|powershell", summary: "print a shell completion script", setup: setupCompletion})
+}
+
+// setupCompletion implements "clap completion": it prints a script that
+// completes commands, flags, and flag values such as formats and presets.
+// Profile names are looked up in the current directory's config each
+// time, through --profiles.
+func setupCompletion(fs *flag.FlagSet) func(args []string) error {
+	profiles := fs.Bool("profiles", false, "print the profiles of the config in the current directory, one per line (used by the scripts)")
+	return func(args []string) error {
+		positional, err := parseInterleaved(fs, args)
+		if err != nil {
+			return err
+		}
+		if *profiles {
+			return printProfiles()
+		}
+		if len(positional) != 1 {
+			return errUsage
+		}
+		script, err := completionScript(positional[0])
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.WriteString(script)
+		return err
+	}
+}
+
+// printProfiles prints the profile names of ./.clap.toml, if there is one.
+func printProfiles() error {
+	path, _ := findConfig("", ".")
+	cfg, _, err := loadConfig(path, false)
+	if err != nil {
+		return err
+	}
+	for _, name := range slices.Sorted(maps.Keys(cfg.Profiles)) {
+		fmt.Println(name)
+	}
+	return nil
+}
+
+// completionFlag is a flag as the scripts see it.
+type completionFlag struct {
+	name   string // with its dashes
+	usage  string
+	value  bool     // takes a value
+	values []string // the values to offer, if known
+}
+
+// completionValues lists the values of flags that take one of a few. -p,
+// whose profiles depend on the directory, is handled by the scripts.
+func completionValues() map[string][]string {
+	return map[string][]string{
+		"format":        formatNames,
+		"preset":        presetNames(),
+		"model":         modelNames(),
+		"tokenizer":     {"cl100k", "o200k"},
+		"compress":      {"gzip", "zstd"},
+		"sort":          {"path", "size", "mtime", "ext", "go"},
+		"path-style":    {"relative", "absolute", "basename"},
+		"framing":       {"escape", "safe"},
+		"report":        {"text", "json", "none"},
+		"log-format":    {"text", "json"},
+		"errors":        {"warn", "skip", "fail"},
+		"encoding":      {"utf-8", "keep"},
+		"sanitize":      {"auto", "all", "off"},
+		"normalize-eol": {"lf", "crlf", "keep"},
+	}
+}
+
+// completionFlags returns the flags of every command, by name.
+func completionFlags() map[string][]completionFlag {
+	values := completionValues()
+	all := map[string][]completionFlag{}
+	for _, cmd := range commands {
+		fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+		cmd.setup(fs)
+		fs.VisitAll(func(f *flag.Flag) {
+			name := "--" + f.Name
+			if len(f.Name) == 1 || f.Name == "vv" {
+				name = "-" + f.Name
+			}
+			boolFlag, ok := f.Value.(interface{ IsBoolFlag() bool })
+			all[cmd.name] = append(all[cmd.name], completionFlag{
+				name:   name,
+				usage:  f.Usage,
+				value:  !ok || !boolFlag.IsBoolFlag(),
+				values: values[f.Name],
+			})
+		})
+	}
+	return all
+}
+
+// completionScript returns the completion script for shell.
+func completionScript(shell string) (string, error) {
+	var names []string
+	for _, cmd := range commands {
+		names = append(names, cmd.name)
+	}
+	flags := completionFlags()
+	var sb strings.Builder
+	switch shell {
+	case "bash":
+		writeBashCompletion(&sb, names, flags)
+	case "zsh":
+		writeZshCompletion(&sb, names, flags)
+	case "fish":
+		writeFishCompletion(&sb, names, flags)
+	case "powershell":
+		writePowerShellCompletion(&sb, names, flags)
+	default:
+		return "", fmt.Errorf("unknown shell %q (want bash, zsh, fish, or powershell)", shell)
+	}
+	return sb.String(), nil
+}
+
+// valueFlags returns every flag with known values, across commands, and
+// those values.
+func valueFlags(flags map[string][]completionFlag) ([]string, map[string][]string) {
+	values := map[string][]string{}
+	for _, list := range flags {
+		for _, f := range list {
+			if f.values != nil {
+				values[f.name] = f.values
+			}
+		}
+	}
+	return slices.Sorted(maps.Keys(values)), values
+}
+
+// flagNames returns the names of flags, space-separated.
+func flagNames(flags []completionFlag) string {
+	names := make([]string, len(flags))
+	for i, f := range flags {
+		names[i] = f.name
+	}
+	return strings.Join(names, " ")
+}
+
+func writeBashCompletion(sb *strings.Builder, names []string, flags map[string][]completionFlag) {
+	sb.WriteString("# bash completion for clap. Load it with:\n#   source <(clap completion bash)\n\n")
+	sb.WriteString("_clap() {\n")
+	sb.WriteString("    local cur=\"${COMP_WORDS[COMP_CWORD]}\" prev=\"${COMP_WORDS[COMP_CWORD-1]}\" cmd=pack\n")
+	fmt.Fprintf(sb, "    case \"${COMP_WORDS[1]}\" in\n        %s) cmd=\"${COMP_WORDS[1]}\" ;;\n    esac\n", strings.Join(names, "|"))
+	sb.WriteString("    case \"$prev\" in\n")
+	ordered, values := valueFlags(flags)
+	for _, name := range ordered {
+		fmt.Fprintf(sb, "        %s) COMPREPLY=($(compgen -W \"%s\" -- \"$cur\")); return ;;\n", name, strings.Join(values[name], " "))
+	}
+	sb.WriteString("        -p) COMPREPLY=($(compgen -W \"$(clap completion --profiles 2>/dev/null)\" -- \"$cur\")); return ;;\n")
+	sb.WriteString("    esac\n")
+	sb.WriteString("    if [[ $cur == -* ]]; then\n        local flags\n        case \"$cmd\" in\n")
+	for _, name := range names {
+		fmt.Fprintf(sb, "            %s) flags=\"%s\" ;;\n", name, flagNames(flags[name]))
+	}
+	sb.WriteString("        esac\n        COMPREPLY=($(compgen -W \"$flags\" -- \"$cur\"))\n        return\n    fi\n")
+	fmt.Fprintf(sb, "    if [[ $COMP_CWORD -eq 1 ]]; then\n        COMPREPLY=($(compgen -W \"%s\" -- \"$cur\"))\n    fi\n", strings.Join(names, " "))
+	sb.WriteString("    COMPREPLY+=($(compgen -f -- \"$cur\"))\n}\n\ncomplete -o filenames -F _clap clap\n")
+}
+
+func writeZshCompletion(sb *strings.Builder, names []string, flags map[string][]completionFlag) {
+	sb.WriteString("#compdef clap\n# zsh completion for clap. Load it with:\n#   source <(clap completion zsh)\n\n")
+	sb.WriteString("_clap() {\n")
+	sb.WriteString("    local cmd=pack prev=${words[CURRENT-1]}\n")
+	fmt.Fprintf(sb, "    (( CURRENT > 2 )) && case ${words[2]} in\n        (%s) cmd=${words[2]} ;;\n    esac\n", strings.Join(names, "|"))
+	sb.WriteString("    case $prev in\n")
+	ordered, values := valueFlags(flags)
+	for _, name := range ordered {
+		fmt.Fprintf(sb, "        (%s) compadd -- %s; return ;;\n", name, strings.Join(values[name], " "))
+	}
+	sb.WriteString("        (-p) compadd -- ${(f)\"$(clap completion --profiles 2>/dev/null)\"}; return ;;\n")
+	sb.WriteString("    esac\n")
+	sb.WriteString("    if [[ $PREFIX == -* ]]; then\n        case $cmd in\n")
+	for _, name := range names {
+		fmt.Fprintf(sb, "            (%s) compadd -- %s ;;\n", name, flagNames(flags[name]))
+	}
+	sb.WriteString("        esac\n        return\n    fi\n")
+	fmt.Fprintf(sb, "    (( CURRENT == 2 )) && compadd -- %s\n", strings.Join(names, " "))
+	sb.WriteString("    _files\n}\n\ncompdef _clap clap\n")
+}
+
+func writeFishCompletion(sb *strings.Builder, names []string, flags map[string][]completionFlag) {
+	sb.WriteString("# fish completion for clap. Load it with:\n#   clap completion fish | source\n\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(sb, "complete -c clap -n __fish_use_subcommand -a %s -d %s\n", cmd.name, fishQuote(cmd.summary))
+	}
+	sb.WriteString("complete -c clap -s p -x -a '(clap completion --profiles 2>/dev/null)'\n")
+	for _, name := range names {
+		// pack is also what runs without a command.
+		condition := "__fish_seen_subcommand_from " + name
+		if name == "pack" {
+			condition = "not __fish_seen_subcommand_from " + strings.Join(names[1:], " ")
+		}
+		for _, f := range flags[name] {
+			if f.name == "-p" {
+				continue
+			}
+			option := "-l " + strings.TrimLeft(f.name, "-")
+			if !strings.HasPrefix(f.name, "--") {
+				option = "-o " + strings.TrimLeft(f.name, "-")
+			}
+			switch {
+			case f.values != nil:
+				option += " -x -a " + fishQuote(strings.Join(f.values, " "))
+			case f.value:
+				option += " -r"
+			}
+			fmt.Fprintf(sb, "complete -c clap -n %s %s -d %s\n", fishQuote(condition), option, fishQuote(f.usage))
+		}
+	}
+}
+
+// fishQuote quotes s for fish.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+func writePowerShellCompletion(sb *strings.Builder, names []string, flags map[string][]completionFlag) {
+	sb.WriteString("# PowerShell completion for clap. Load it with:\n#   clap completion powershell | Out-String | Invoke-Expression\n\n")
+	sb.WriteString("Register-ArgumentCompleter -Native -CommandName clap -ScriptBlock {\n")
+	sb.WriteString("    param($wordToComplete, $commandAst, $cursorPosition)\n\n")
+	fmt.Fprintf(sb, "    $commands = @(%s)\n", psList(names))
+	sb.WriteString("    $flags = @{\n")
+	for _, name := range names {
+		var list []string
+		for _, f := range flags[name] {
+			list = append(list, f.name)
+		}
+		fmt.Fprintf(sb, "        '%s' = @(%s)\n", name, psList(list))
+	}
+	sb.WriteString("    }\n    $values = @{\n")
+	ordered, values := valueFlags(flags)
+	for _, name := range ordered {
+		fmt.Fprintf(sb, "        '%s' = @(%s)\n", name, psList(values[name]))
+	}
+	sb.WriteString("    }\n\n")
+	sb.WriteString(`    $words = @($commandAst.CommandElements | ForEach-Object { $_.ToString() })
+    $cmd = 'pack'
+    if ($words.Count -gt 1 -and $commands -contains $words[1]) { $cmd = $words[1] }
+    $prev = if ($wordToComplete) { $words[-2] } else { $words[-1] }
+
+    if ($prev -eq '-p') {
+        $candidates = @(clap completion --profiles 2>$null)
+    } elseif ($values.ContainsKey($prev)) {
+        $candidates = $values[$prev]
+    } elseif ($wordToComplete -like '-*') {
+        $candidates = $flags[$cmd]
+    } elseif ($words.Count -le 2) {
+        $candidates = $commands
+    } else {
+        return
+    }
+    $candidates | Where-Object { $_ -like "$wordToComplete*" } | ForEach-Object {
+        [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+    }
+}
+`)
+}
+
+// psList formats items as the elements of a PowerShell array.
+func psList(items []string) string {
+	quoted := make([]string, len(items))
+	for i, item := range items {
+		quoted[i] = "'" + item + "'"
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressExt returns the file extension for a --compress method, or ""
+// for none.
+func compressExt(method string) string {
+	switch method {
+	case "gzip":
+		return ".gz"
+	case "zstd":
+		return ".zst"
+	}
+	return ""
+}
+
+// withExt appends ext to name unless it is there already.
+func withExt(name, ext string) string {
+	if ext == "" || strings.HasSuffix(name, ext) {
+		return name
+	}
+	return name + ext
+}
+
+// newCompressor wraps w in a streaming compressor. Closing it flushes the
+// compressed stream but leaves w open.
+func newCompressor(w io.Writer, method string) (io.WriteCloser, error) {
+	switch method {
+	case "gzip":
+		return gzip.NewWriter(w), nil
+	case "zstd":
+		return zstd.NewWriter(w)
+	}
+	return nil, fmt.Errorf("--compress: unknown method %q (want gzip or zstd)", method)
+}
+
+// openBundle opens the bundle at path for reading, decrypting it with
+// identities if it was written with --encrypt and decompressing it if it
+// was written with --compress.
+func openBundle(path string, identities []age.Identity) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := decodeBundle(f, identities)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return readCloser{r, f}, nil
+}
+
+// decodeBundle undoes --encrypt and then --compress, telling them apart
+// from a plain bundle by their leading bytes.
+func decodeBundle(r io.Reader, identities []age.Identity) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(len(ageMagic)); string(magic) == ageMagic {
+		if len(identities) == 0 {
+			return nil, fmt.Errorf("bundle is encrypted; decrypt it with clap unpack --identity <key file>")
+		}
+		dr, err := age.Decrypt(br, identities...)
+		if err != nil {
+			return nil, err
+		}
+		br = bufio.NewReader(dr)
+	}
+
+	magic, _ := br.Peek(4)
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return gzip.NewReader(br)
+	case bytes.Equal(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	}
+	return br, nil
+}
+
+// readCloser reads from a decompressor and closes the file under it.
+type readCloser struct {
+	io.Reader
+	file *os.File
+}
+
+func (r readCloser) Close() error {
+	if c, ok := r.Reader.(io.Closer); ok {
+		c.Close()
+	}
+	return r.file.Close()
+}
@@ -0,0 +1,416 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"maps"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// configFile is the per-project defaults file looked up in the scanned path.
+const configFile = ".clap.toml"
+
+// config holds per-project defaults. Each field mirrors a command-line
+// flag; pointer fields distinguish "unset" from zero values.
+type config struct {
+	Output            *string           `toml:"output"`
+	Force             *bool             `toml:"force"`
+	Backup            *bool             `toml:"backup"`
+	Compress          *string           `toml:"compress"`
+	Manifest          *string           `toml:"manifest"`
+	PerDir            *int              `toml:"per_dir"`
+	Grep              *string           `toml:"grep"`
+	GrepInvert        *bool             `toml:"grep_invert"`
+	Encrypt           []string          `toml:"encrypt"`
+	Format            *string           `toml:"format"`
+	ChunkTokens       *int              `toml:"chunk_tokens"`
+	ChunkOverlap      *int              `toml:"chunk_overlap"`
+	Model             *string           `toml:"model"`
+	Preset            []string          `toml:"preset"`
+	Languages         map[string]string `toml:"languages"`
+	HeaderMeta        []string          `toml:"header_meta"`
+	Framing           *string           `toml:"framing"`
+	Header            *string           `toml:"header"`
+	Footer            *string           `toml:"footer"`
+	Extensions        []string          `toml:"extensions"`
+	IncludeNames      []string          `toml:"include_names"`
+	Exclude           []string          `toml:"exclude"`
+	IncludeRegexp     []string          `toml:"include_re"`
+	ExcludeRegexp     []string          `toml:"exclude_re"`
+	SkipOutput        []string          `toml:"skip_output"`
+	Tokenizer         *string           `toml:"tokenizer"`
+	MaxTokens         *int              `toml:"max_tokens"`
+	FitTokens         *int              `toml:"fit_tokens"`
+	FitPriority       []string          `toml:"fit_priority"`
+	Weights           []string          `toml:"weights"`
+	NoGitignore       *bool             `toml:"no_gitignore"`
+	NoClapignore      *bool             `toml:"no_clapignore"`
+	NoDefaultExcludes *bool             `toml:"no_default_excludes"`
+	NoTests           *bool             `toml:"no_tests"`
+	NoGenerated       *bool             `toml:"no_generated"`
+	Hidden            *bool             `toml:"hidden"`
+	IncludeBinary     *bool             `toml:"include_binary"`
+	SkipEmpty         *bool             `toml:"skip_empty"`
+	Errors            *string           `toml:"errors"`
+	Encoding          *string           `toml:"encoding"`
+	MaxDepth          *int              `toml:"max_depth"`
+	MaxSize           *string           `toml:"max_size"`
+	NewerThan         *string           `toml:"newer_than"`
+	OlderThan         *string           `toml:"older_than"`
+	ConfirmOver       *string           `toml:"confirm_over"`
+	TruncateLines     *int              `toml:"truncate_lines"`
+	TruncateBytes     *string           `toml:"truncate_bytes"`
+	TruncateTail      *bool             `toml:"truncate_tail"`
+	LineNumbers       *bool             `toml:"line_numbers"`
+	NoDedupe          *bool             `toml:"no_dedupe"`
+	Report            *string           `toml:"report"`
+	Quiet             *bool             `toml:"quiet"`
+	NoProgress        *bool             `toml:"no_progress"`
+	LogFormat         *string           `toml:"log_format"`
+	Cache             *bool             `toml:"cache"`
+	Split             *string           `toml:"split"`
+	Redact            *bool             `toml:"redact"`
+	NormalizeEOL      *string           `toml:"normalize_eol"`
+	TrimTrailingSpace *bool             `toml:"trim_trailing_space"`
+	TabsToSpaces      *int              `toml:"tabs_to_spaces"`
+	Sanitize          *string           `toml:"sanitize"`
+	SanitizeEscape    *bool             `toml:"sanitize_escape"`
+	Anonymize         *bool             `toml:"anonymize"`
+	AnonymizeKey      *string           `toml:"anonymize_key"`
+	AnonymizeIdent    []string          `toml:"anonymize_ident"`
+	StripComments     *bool             `toml:"strip_comments"`
+	Signatures        *bool             `toml:"signatures"`
+	Tree              *bool             `toml:"tree"`
+	FrontMatter       *bool             `toml:"front_matter"`
+	Reproducible      *bool             `toml:"reproducible"`
+	Throttle          *string           `toml:"throttle"`
+	Nice              *bool             `toml:"nice"`
+	PathStyle         *string           `toml:"path_style"`
+	StripPrefix       *string           `toml:"strip_prefix"`
+	Sort              *string           `toml:"sort"`
+	GoOrder           *bool             `toml:"go_order"`
+	GoPackages        *bool             `toml:"go_packages"`
+	Reverse           *bool             `toml:"reverse"`
+	First             []string          `toml:"first"`
+	Last              []string          `toml:"last"`
+	FollowSymlinks    *bool             `toml:"follow_symlinks"`
+	GitTracked        *bool             `toml:"git_tracked"`
+	GitDiff           *string           `toml:"git_diff"`
+
+	// Profiles are named sets of the same keys, from [profile.<name>]
+	// tables, selected with -p.
+	Profiles map[string]*config `toml:"profile"`
+}
+
+// loadConfig reads the config at path and reports whether it existed.
+// When required is false a missing file yields an empty config.
+func loadConfig(path string, required bool) (*config, bool, error) {
+	cfg := &config{}
+	meta, err := toml.DecodeFile(path, cfg)
+	if err != nil {
+		if !required && errors.Is(err, fs.ErrNotExist) {
+			return cfg, false, nil
+		}
+		return nil, false, err
+	}
+
+	if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, len(undecoded))
+		for i, key := range undecoded {
+			keys[i] = key.String()
+		}
+		return nil, false, fmt.Errorf("unknown keys: %s", strings.Join(keys, ", "))
+	}
+	for name, profile := range cfg.Profiles {
+		if profile.Profiles != nil {
+			return nil, false, fmt.Errorf("profile %s: profiles can't be nested", name)
+		}
+	}
+	return cfg, true, nil
+}
+
+// profile returns the named profile.
+func (c *config) profile(name string) (*config, error) {
+	profile, ok := c.Profiles[name]
+	if !ok {
+		names := slices.Sorted(maps.Keys(c.Profiles))
+		if len(names) == 0 {
+			return nil, fmt.Errorf("no profile %q (the config defines none)", name)
+		}
+		return nil, fmt.Errorf("no profile %q (want %s)", name, strings.Join(names, ", "))
+	}
+	return profile, nil
+}
+
+// override replaces every key of c that other defines. Lists are replaced,
+// not extended, so a profile can also clear one with an empty list.
+func (c *config) override(other *config) {
+	dst, src := reflect.ValueOf(c).Elem(), reflect.ValueOf(other).Elem()
+	for i := range dst.NumField() {
+		if field := src.Field(i); !field.IsNil() {
+			dst.Field(i).Set(field)
+		}
+	}
+}
+
+// findConfig returns the config path to use: explicit if given, otherwise
+// the project file in root.
+func findConfig(explicit, root string) (string, bool) {
+	if explicit != "" {
+		return explicit, true
+	}
+	return filepath.Join(root, configFile), false
+}
+
+// apply sets every flag the config defines, unless it was given on the
+// command line. Flags on the command line always win.
+func (c *config) apply(flags *flag.FlagSet) error {
+	explicit := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	set := func(name string, values ...string) error {
+		if explicit[name] {
+			return nil
+		}
+		for _, value := range values {
+			if err := flags.Set(name, value); err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+		}
+		return nil
+	}
+
+	var errs []error
+	if c.Output != nil {
+		errs = append(errs, set("o", *c.Output))
+	}
+	if c.Force != nil {
+		errs = append(errs, set("force", strconv.FormatBool(*c.Force)))
+	}
+	if c.Backup != nil {
+		errs = append(errs, set("backup", strconv.FormatBool(*c.Backup)))
+	}
+	if c.Format != nil {
+		errs = append(errs, set("format", *c.Format))
+	}
+	if c.Model != nil {
+		errs = append(errs, set("model", *c.Model))
+	}
+	if c.Header != nil {
+		errs = append(errs, set("header", *c.Header))
+	}
+	if c.Footer != nil {
+		errs = append(errs, set("footer", *c.Footer))
+	}
+	if c.Tokenizer != nil {
+		errs = append(errs, set("tokenizer", *c.Tokenizer))
+	}
+	if c.MaxTokens != nil {
+		errs = append(errs, set("max-tokens", strconv.Itoa(*c.MaxTokens)))
+	}
+	if c.NoGitignore != nil {
+		errs = append(errs, set("no-gitignore", strconv.FormatBool(*c.NoGitignore)))
+	}
+	if c.NoDefaultExcludes != nil {
+		errs = append(errs, set("no-default-excludes", strconv.FormatBool(*c.NoDefaultExcludes)))
+	}
+	if c.Hidden != nil {
+		errs = append(errs, set("hidden", strconv.FormatBool(*c.Hidden)))
+	}
+	if c.NoTests != nil {
+		errs = append(errs, set("no-tests", strconv.FormatBool(*c.NoTests)))
+	}
+	if c.IncludeBinary != nil {
+		errs = append(errs, set("include-binary", strconv.FormatBool(*c.IncludeBinary)))
+	}
+	if c.Encoding != nil {
+		errs = append(errs, set("encoding", *c.Encoding))
+	}
+	if c.MaxDepth != nil {
+		errs = append(errs, set("max-depth", strconv.Itoa(*c.MaxDepth)))
+	}
+	if c.MaxSize != nil {
+		errs = append(errs, set("max-size", *c.MaxSize))
+	}
+	if c.Redact != nil {
+		errs = append(errs, set("redact", strconv.FormatBool(*c.Redact)))
+	}
+	if c.StripComments != nil {
+		errs = append(errs, set("strip-comments", strconv.FormatBool(*c.StripComments)))
+	}
+	if c.LineNumbers != nil {
+		errs = append(errs, set("line-numbers", strconv.FormatBool(*c.LineNumbers)))
+	}
+	if c.NoDedupe != nil {
+		errs = append(errs, set("no-dedupe", strconv.FormatBool(*c.NoDedupe)))
+	}
+	if c.Report != nil {
+		errs = append(errs, set("report", *c.Report))
+	}
+	if c.Cache != nil {
+		errs = append(errs, set("cache", strconv.FormatBool(*c.Cache)))
+	}
+	if c.Split != nil {
+		errs = append(errs, set("split", *c.Split))
+	}
+	if c.Tree != nil {
+		errs = append(errs, set("tree", strconv.FormatBool(*c.Tree)))
+	}
+	if c.Sort != nil {
+		errs = append(errs, set("sort", *c.Sort))
+	}
+	if c.Reverse != nil {
+		errs = append(errs, set("reverse", strconv.FormatBool(*c.Reverse)))
+	}
+	if c.FollowSymlinks != nil {
+		errs = append(errs, set("follow-symlinks", strconv.FormatBool(*c.FollowSymlinks)))
+	}
+	if c.GitTracked != nil {
+		errs = append(errs, set("git-tracked", strconv.FormatBool(*c.GitTracked)))
+	}
+	if c.GitDiff != nil {
+		errs = append(errs, set("git-diff", *c.GitDiff))
+	}
+	if c.LogFormat != nil {
+		errs = append(errs, set("log-format", *c.LogFormat))
+	}
+	if c.Errors != nil {
+		errs = append(errs, set("errors", *c.Errors))
+	}
+	if c.NoProgress != nil {
+		errs = append(errs, set("no-progress", strconv.FormatBool(*c.NoProgress)))
+	}
+	if c.Quiet != nil {
+		errs = append(errs, set("q", strconv.FormatBool(*c.Quiet)))
+	}
+	var langs []string
+	for _, key := range slices.Sorted(maps.Keys(c.Languages)) {
+		langs = append(langs, key+"="+c.Languages[key])
+	}
+	errs = append(errs, set("lang", langs...))
+	if c.TruncateLines != nil {
+		errs = append(errs, set("truncate-lines", strconv.Itoa(*c.TruncateLines)))
+	}
+	if c.TruncateBytes != nil {
+		errs = append(errs, set("truncate-bytes", *c.TruncateBytes))
+	}
+	if c.TruncateTail != nil {
+		errs = append(errs, set("truncate-tail", strconv.FormatBool(*c.TruncateTail)))
+	}
+	if c.FitTokens != nil {
+		errs = append(errs, set("fit-tokens", strconv.Itoa(*c.FitTokens)))
+	}
+	if c.Compress != nil {
+		errs = append(errs, set("compress", *c.Compress))
+	}
+	if c.ConfirmOver != nil {
+		errs = append(errs, set("confirm-over", *c.ConfirmOver))
+	}
+	if c.Grep != nil {
+		errs = append(errs, set("grep", *c.Grep))
+	}
+	if c.GrepInvert != nil {
+		errs = append(errs, set("grep-invert", strconv.FormatBool(*c.GrepInvert)))
+	}
+	if c.NewerThan != nil {
+		errs = append(errs, set("newer-than", *c.NewerThan))
+	}
+	if c.OlderThan != nil {
+		errs = append(errs, set("older-than", *c.OlderThan))
+	}
+	if c.PathStyle != nil {
+		errs = append(errs, set("path-style", *c.PathStyle))
+	}
+	if c.StripPrefix != nil {
+		errs = append(errs, set("strip-prefix", *c.StripPrefix))
+	}
+	if c.Framing != nil {
+		errs = append(errs, set("framing", *c.Framing))
+	}
+	if c.Manifest != nil {
+		errs = append(errs, set("manifest", *c.Manifest))
+	}
+	if c.Anonymize != nil {
+		errs = append(errs, set("anonymize", strconv.FormatBool(*c.Anonymize)))
+	}
+	if c.AnonymizeKey != nil {
+		errs = append(errs, set("anonymize-key", *c.AnonymizeKey))
+	}
+	if c.PerDir != nil {
+		errs = append(errs, set("per-dir", strconv.Itoa(*c.PerDir)))
+	}
+	if c.Sanitize != nil {
+		errs = append(errs, set("sanitize", *c.Sanitize))
+	}
+	if c.SanitizeEscape != nil {
+		errs = append(errs, set("sanitize-escape", strconv.FormatBool(*c.SanitizeEscape)))
+	}
+	if c.NormalizeEOL != nil {
+		errs = append(errs, set("normalize-eol", *c.NormalizeEOL))
+	}
+	if c.TrimTrailingSpace != nil {
+		errs = append(errs, set("trim-trailing-space", strconv.FormatBool(*c.TrimTrailingSpace)))
+	}
+	if c.TabsToSpaces != nil {
+		errs = append(errs, set("tabs-to-spaces", strconv.Itoa(*c.TabsToSpaces)))
+	}
+	if c.Signatures != nil {
+		errs = append(errs, set("signatures", strconv.FormatBool(*c.Signatures)))
+	}
+	if c.GoOrder != nil {
+		errs = append(errs, set("go-order", strconv.FormatBool(*c.GoOrder)))
+	}
+	if c.GoPackages != nil {
+		errs = append(errs, set("go-packages", strconv.FormatBool(*c.GoPackages)))
+	}
+	if c.NoGenerated != nil {
+		errs = append(errs, set("no-generated", strconv.FormatBool(*c.NoGenerated)))
+	}
+	if c.NoClapignore != nil {
+		errs = append(errs, set("no-clapignore", strconv.FormatBool(*c.NoClapignore)))
+	}
+	if c.SkipEmpty != nil {
+		errs = append(errs, set("skip-empty", strconv.FormatBool(*c.SkipEmpty)))
+	}
+	if c.ChunkTokens != nil {
+		errs = append(errs, set("chunk-tokens", strconv.Itoa(*c.ChunkTokens)))
+	}
+	if c.ChunkOverlap != nil {
+		errs = append(errs, set("chunk-overlap", strconv.Itoa(*c.ChunkOverlap)))
+	}
+	if c.FrontMatter != nil {
+		errs = append(errs, set("front-matter", strconv.FormatBool(*c.FrontMatter)))
+	}
+	if c.Reproducible != nil {
+		errs = append(errs, set("reproducible", strconv.FormatBool(*c.Reproducible)))
+	}
+	if c.Throttle != nil {
+		errs = append(errs, set("throttle", *c.Throttle))
+	}
+	if c.Nice != nil {
+		errs = append(errs, set("nice", strconv.FormatBool(*c.Nice)))
+	}
+	errs = append(errs, set("e", c.Extensions...))
+	errs = append(errs, set("exclude", c.Exclude...))
+	errs = append(errs, set("skip-output", c.SkipOutput...))
+	errs = append(errs, set("first", c.First...))
+	errs = append(errs, set("last", c.Last...))
+	errs = append(errs, set("weight", c.Weights...))
+	errs = append(errs, set("anonymize-ident", c.AnonymizeIdent...))
+	errs = append(errs, set("exclude-re", c.ExcludeRegexp...))
+	errs = append(errs, set("include-re", c.IncludeRegexp...))
+	errs = append(errs, set("include-name", c.IncludeNames...))
+	errs = append(errs, set("preset", c.Preset...))
+	errs = append(errs, set("encrypt", c.Encrypt...))
+	errs = append(errs, set("fit-priority", c.FitPriority...))
+	errs = append(errs, set("header-meta", c.HeaderMeta...))
+	return errors.Join(errs...)
+}
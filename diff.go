@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"clap/pkg/clap"
+)
+
+// setupDiff implements "clap diff": it compares two bundles file by file
+// without unpacking them.
+func setupDiff(fs *flag.FlagSet) func(args []string) error {
+	unified := fs.Bool("u", false, "also print a unified diff of each added, removed, or changed file")
+	context := fs.Int("context", 3, "lines of context around each change with -u")
+	return func(args []string) error {
+		positional, err := parseInterleaved(fs, args)
+		if err != nil {
+			return err
+		}
+		if len(positional) != 2 {
+			return errUsage
+		}
+		if *context < 0 {
+			return fmt.Errorf("--context: want zero or more lines")
+		}
+		lines := -1
+		if *unified {
+			lines = *context
+		}
+		return diffBundles(positional[0], positional[1], lines)
+	}
+}
+
+// diffBundles prints every file added, removed, or changed going from the
+// bundle at oldPath to the one at newPath. With context of zero or more,
+// each one's unified diff follows the list.
+func diffBundles(oldPath, newPath string, context int) error {
+	oldFiles, oldOrder, err := readBundleFile(oldPath)
+	if err != nil {
+		return err
+	}
+	newFiles, newOrder, err := readBundleFile(newPath)
+	if err != nil {
+		return err
+	}
+
+	added, removed, changed := listChanges(oldFiles, oldOrder, newFiles, newOrder)
+	fmt.Printf("%d added, %d removed, %d changed\n", added, removed, changed)
+	if context < 0 {
+		return nil
+	}
+	return writeUnifiedAll(oldFiles, oldOrder, newFiles, newOrder, context)
+}
+
+// listChanges prints a line for each file added (+), removed (-), or
+// changed (~) between two sets of files, and returns the counts.
+func listChanges(oldFiles map[string][]byte, oldOrder []string, newFiles map[string][]byte, newOrder []string) (added, removed, changed int) {
+	for _, path := range newOrder {
+		old, ok := oldFiles[path]
+		switch {
+		case !ok:
+			fmt.Printf("+ %s (%d bytes)\n", path, len(newFiles[path]))
+			added++
+		case !bytes.Equal(old, newFiles[path]):
+			fmt.Printf("~ %s (%d -> %d bytes)\n", path, len(old), len(newFiles[path]))
+			changed++
+		}
+	}
+	for _, path := range oldOrder {
+		if _, ok := newFiles[path]; !ok {
+			fmt.Printf("- %s (%d bytes)\n", path, len(oldFiles[path]))
+			removed++
+		}
+	}
+	return added, removed, changed
+}
+
+// writeUnifiedAll prints the unified diff of every file that differs
+// between two sets of files.
+func writeUnifiedAll(oldFiles map[string][]byte, oldOrder []string, newFiles map[string][]byte, newOrder []string, context int) error {
+	out := bufio.NewWriter(os.Stdout)
+	for _, path := range newOrder {
+		old, ok := oldFiles[path]
+		switch {
+		case !ok:
+			writeUnified(out, "", path, nil, newFiles[path], context)
+		case !bytes.Equal(old, newFiles[path]):
+			writeUnified(out, path, path, old, newFiles[path], context)
+		}
+	}
+	for _, path := range oldOrder {
+		if _, ok := newFiles[path]; !ok {
+			writeUnified(out, path, "", oldFiles[path], nil, context)
+		}
+	}
+	return out.Flush()
+}
+
+// writeUnified writes the unified diff from old to new, named oldName and
+// newName; an empty name stands for a file that doesn't exist.
+func writeUnified(w io.Writer, oldName, newName string, old, new []byte, context int) {
+	a, b := splitLines(old), splitLines(new)
+	label := func(prefix, name string) string {
+		if name == "" {
+			return "/dev/null"
+		}
+		return prefix + name
+	}
+	fmt.Fprintf(w, "\n--- %s\n+++ %s\n", label("a/", oldName), label("b/", newName))
+
+	edits := editScript(a, b)
+	for i := 0; i < len(edits); {
+		for i < len(edits) && edits[i].op == ' ' {
+			i++
+		}
+		if i == len(edits) {
+			break
+		}
+
+		// A hunk runs from context lines before its first change to context
+		// lines after its last, taking in later changes closer than twice
+		// the context.
+		start, end := max(i-context, 0), i
+		for end < len(edits) {
+			if edits[end].op != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(edits) && edits[run].op == ' ' {
+				run++
+			}
+			if run == len(edits) || run-end > 2*context {
+				end = min(end+context, run)
+				break
+			}
+			end = run
+		}
+		hunk := edits[start:end]
+		i = end
+
+		var oldCount, newCount int
+		for _, e := range hunk {
+			if e.op != '+' {
+				oldCount++
+			}
+			if e.op != '-' {
+				newCount++
+			}
+		}
+		fmt.Fprintf(w, "@@ -%s +%s @@\n", hunkRange(hunk[0].a, oldCount), hunkRange(hunk[0].b, newCount))
+		for _, e := range hunk {
+			var line string
+			if e.op == '+' {
+				line = b[e.b]
+			} else {
+				line = a[e.a]
+			}
+			fmt.Fprintf(w, "%c%s", e.op, line)
+			if !strings.HasSuffix(line, "\n") {
+				fmt.Fprint(w, "\n\\ No newline at end of file\n")
+			}
+		}
+	}
+}
+
+// hunkRange formats the start and length of a hunk's side, 1-based. An
+// empty side starts at the line before it.
+func hunkRange(start, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return strconv.Itoa(start + 1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// splitLines splits content into lines, each with its newline except
+// perhaps the last.
+func splitLines(content []byte) []string {
+	lines := strings.SplitAfter(string(content), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// edit is one step of an edit script: keep (' ') the line at a in the old
+// file and b in the new, delete ('-') the old line at a, or insert ('+')
+// the new line at b. a and b are the positions reached in each file.
+type edit struct {
+	op   byte
+	a, b int
+}
+
+// editScript returns a shortest edit script turning a into b, using
+// Myers' O(ND) algorithm.
+func editScript(a, b []string) []edit {
+	n, m := len(a), len(b)
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	var trace [][]int // the frontier before each step, diagonals -d to d
+
+	for d := 0; d <= n+m; d++ {
+		trace = append(trace, slices.Clone(v[offset-d:offset+d+1]))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, n, m)
+			}
+		}
+	}
+	return nil
+}
+
+// backtrack walks the saved frontiers of editScript back from the end of
+// both files and returns the edits in order.
+func backtrack(trace [][]int, x, y int) []edit {
+	var edits []edit
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && v[d+k-1] < v[d+k+1]) {
+			prevK = k + 1
+		}
+		prevX := 0
+		if d > 0 {
+			prevX = v[d+prevK]
+		}
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x, y = x-1, y-1
+			edits = append(edits, edit{' ', x, y})
+		}
+		if d > 0 {
+			if x == prevX {
+				edits = append(edits, edit{'+', x, y - 1})
+			} else {
+				edits = append(edits, edit{'-', x - 1, y})
+			}
+		}
+		x, y = prevX, prevY
+	}
+	slices.Reverse(edits)
+	return edits
+}
+
+// readBundleFile loads every file in the bundle at path, along with their
+// paths in bundle order.
+func readBundleFile(path string) (map[string][]byte, []string, error) {
+	f, err := openBundle(path, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("opening bundle %s: %v", path, err)
+	}
+	defer f.Close()
+
+	files, order, err := readBundleFiles(f)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading bundle %s: %v", path, err)
+	}
+	return files, order, nil
+}
+
+// readBundleFiles loads every file in the bundle read from r, along with
+// their paths in bundle order.
+func readBundleFiles(r io.Reader) (map[string][]byte, []string, error) {
+	files := map[string][]byte{}
+	var order []string
+	err := clap.ReadBundle(r, func(name string, content []byte) error {
+		if _, dup := files[name]; !dup {
+			order = append(order, name)
+		}
+		files[name] = bytes.Clone(content)
+		return nil
+	})
+	return files, order, err
+}
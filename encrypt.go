@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+)
+
+// ageExt is the extension --encrypt adds to the bundle's name, after any
+// from --compress.
+const ageExt = ".age"
+
+// ageMagic starts every binary age file.
+const ageMagic = "age-encryption.org/v1\n"
+
+// parseRecipients parses the --encrypt recipients, age1... public keys.
+func parseRecipients(keys []string) ([]age.Recipient, error) {
+	var recipients []age.Recipient
+	for _, key := range keys {
+		r, err := age.ParseX25519Recipient(strings.TrimSpace(key))
+		if err != nil {
+			return nil, fmt.Errorf("--encrypt: %v", err)
+		}
+		recipients = append(recipients, r)
+	}
+	return recipients, nil
+}
+
+// loadIdentities reads the age secret keys in each of paths, in the
+// format age-keygen writes.
+func loadIdentities(paths []string) ([]age.Identity, error) {
+	var identities []age.Identity
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("--identity: %v", err)
+		}
+		ids, err := age.ParseIdentities(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("--identity %s: %v", path, err)
+		}
+		identities = append(identities, ids...)
+	}
+	return identities, nil
+}
+
+// encoder writes the bundle through a compressor, then age encryption,
+// either of which may be left out. Close finishes both but leaves the
+// underlying writer open.
+type encoder struct {
+	io.Writer
+	closers []io.Closer // nearest the underlying writer first
+}
+
+// newEncoder wraps w to compress with method, if it isn't "", and encrypt
+// to recipients, if there are any.
+func newEncoder(w io.Writer, method string, recipients []age.Recipient) (*encoder, error) {
+	e := &encoder{Writer: w}
+	if len(recipients) > 0 {
+		aw, err := age.Encrypt(w, recipients...)
+		if err != nil {
+			return nil, err
+		}
+		e.Writer = aw
+		e.closers = append(e.closers, aw)
+	}
+	if method != "" {
+		cw, err := newCompressor(e.Writer, method)
+		if err != nil {
+			return nil, err
+		}
+		e.Writer = cw
+		e.closers = append(e.closers, cw)
+	}
+	return e, nil
+}
+
+func (e *encoder) Close() error {
+	for i := len(e.closers) - 1; i >= 0; i-- {
+		if err := e.closers[i].Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeOutput makes o write through newEncoder's layers, finished on
+// Close before o itself.
+func encodeOutput(o *output, method string, recipients []age.Recipient) error {
+	e, err := newEncoder(o.w, method, recipients)
+	if err != nil {
+		return err
+	}
+	closeFn := o.closeFn
+	o.w = e
+	o.closeFn = func() error {
+		if err := e.Close(); err != nil {
+			if o.abortFn != nil {
+				o.abortFn()
+			}
+			return err
+		}
+		return closeFn()
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+
+	"clap/pkg/clap"
+)
+
+// errExtracted stops reading a bundle once the file is found.
+var errExtracted = errors.New("extracted")
+
+// setupExtract implements "clap extract": it pulls one file out of a
+// bundle, reading no further than it has to.
+func setupExtract(fs *flag.FlagSet) func(args []string) error {
+	out := fs.String("o", "-", "write the file here, or into this directory, instead of stdout")
+	manifestPath := fs.String("manifest", "", "seek straight to the file through this --manifest index, which reads any text format and split bundles")
+	var identityFiles stringList
+	fs.Var(&identityFiles, "identity", "age key file to decrypt an --encrypt bundle with (repeatable)")
+	return func(args []string) error {
+		positional, err := parseInterleaved(fs, args)
+		if err != nil {
+			return err
+		}
+		if len(positional) != 2 && (*manifestPath == "" || len(positional) == 0) {
+			return errUsage
+		}
+		identities, err := loadIdentities(identityFiles)
+		if err != nil {
+			return err
+		}
+
+		name := positional[len(positional)-1]
+		bundles := positional[:len(positional)-1]
+		var f clap.BundleFile
+		if *manifestPath != "" {
+			f, err = extractIndexed(hostPath(*manifestPath), bundles, name, identities)
+		} else {
+			f, err = extractFile(hostPath(bundles[0]), name, identities)
+		}
+		if err != nil {
+			return err
+		}
+		if problem := verifyMeta(f); problem != "" {
+			return fmt.Errorf("checksum mismatch for %s: %s", f.Path, problem)
+		}
+		return writeExtracted(f, *out)
+	}
+}
+
+// extractFile finds name in the bundle at bundlePath: a zip or tar archive,
+// whose files are looked up directly, or a plain bundle, read up to the
+// file's section.
+func extractFile(bundlePath, name string, identities []age.Identity) (clap.BundleFile, error) {
+	if clap.IsArchive(bundlePath) {
+		fsys, closer, err := clap.OpenArchive(bundlePath)
+		if err != nil {
+			return clap.BundleFile{}, fmt.Errorf("opening archive %s: %v", bundlePath, err)
+		}
+		defer closer.Close()
+		rel := path.Clean(strings.TrimLeft(name, "/"))
+		content, err := fs.ReadFile(fsys, rel)
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrInvalid) {
+			return clap.BundleFile{}, fmt.Errorf("%s isn't in %s", name, bundlePath)
+		}
+		if err != nil {
+			return clap.BundleFile{}, fmt.Errorf("reading %s in %s: %v", name, bundlePath, err)
+		}
+		return clap.BundleFile{Path: rel, Content: content}, nil
+	}
+
+	bundle, err := openBundle(bundlePath, identities)
+	if err != nil {
+		return clap.BundleFile{}, fmt.Errorf("opening bundle %s: %v", bundlePath, err)
+	}
+	defer bundle.Close()
+	var found clap.BundleFile
+	err = clap.ReadBundleFiles(bundle, func(f clap.BundleFile) error {
+		if !sameBundlePath(f.Path, name) {
+			return nil
+		}
+		found = f
+		return errExtracted
+	})
+	switch err {
+	case errExtracted:
+		return found, nil
+	case nil:
+		return clap.BundleFile{}, fmt.Errorf("%s isn't in %s", name, bundlePath)
+	}
+	return clap.BundleFile{}, fmt.Errorf("reading bundle %s: %v", bundlePath, err)
+}
+
+// extractIndexed finds name in a --manifest index and reads only its
+// section, from the part it names.
+func extractIndexed(manifestPath string, bundles []string, name string, identities []age.Identity) (clap.BundleFile, error) {
+	m, parts, err := loadManifest(manifestPath, bundles)
+	if err != nil {
+		return clap.BundleFile{}, err
+	}
+	x := indexedExtractor{manifestPath, m, parts, identities, map[string]bool{}}
+	f, _, err := x.extract(name)
+	return f, err
+}
+
+// indexedExtractor reads files out of the parts of a --manifest index.
+type indexedExtractor struct {
+	manifestPath string
+	m            manifest
+	parts        []string
+	identities   []age.Identity
+	seen         map[string]bool // being extracted, to catch duplicates of each other
+}
+
+// extract returns the file at name and its section.
+func (x indexedExtractor) extract(name string) (clap.BundleFile, []byte, error) {
+	for _, f := range x.m.Files {
+		if !sameBundlePath(f.Path, name) {
+			continue
+		}
+		if x.seen[f.Path] {
+			return clap.BundleFile{}, nil, fmt.Errorf("%s: the duplicates of %s lead back to it; is the manifest stale?", x.manifestPath, f.Path)
+		}
+		x.seen[f.Path] = true
+		i := max(f.Part, 1) - 1
+		if i >= len(x.parts) {
+			return clap.BundleFile{}, nil, fmt.Errorf("%s: %s is in part %d of %d", x.manifestPath, f.Path, f.Part, len(x.parts))
+		}
+		section, err := readSection(x.parts[i], f.Offset, f.Length, x.identities)
+		if err != nil {
+			return clap.BundleFile{}, nil, fmt.Errorf("%s: %v; is the manifest stale?", x.manifestPath, err)
+		}
+		if f.DuplicateOf != "" {
+			// The section holds a stub; the original has the content.
+			// Read after the original's, as in the bundle, a plain section
+			// also gives the copy its own mode and mtime.
+			original, originalSection, err := x.extract(f.DuplicateOf)
+			if err != nil {
+				return clap.BundleFile{}, nil, err
+			}
+			if file, ok := parseSection(append(slices.Clip(originalSection), section...), f.Path); ok {
+				return file, section, nil
+			}
+			return clap.BundleFile{Path: f.Path, Content: original.Content, DuplicateOf: f.DuplicateOf}, section, nil
+		}
+		file, ok := sectionContent(section, f)
+		if !ok {
+			return clap.BundleFile{}, nil, fmt.Errorf("%s: can't find the content of %s in %s; is the manifest stale?", x.manifestPath, f.Path, x.parts[i])
+		}
+		return file, section, nil
+	}
+	return clap.BundleFile{}, nil, fmt.Errorf("%s isn't in %s", name, x.manifestPath)
+}
+
+// readSection reads length bytes at offset of the bundle at name, counted
+// after decompressing and decrypting it. The section is read as it
+// arrives, so a stale or crafted length can't allocate more than the
+// bundle holds.
+func readSection(name string, offset, length int64, identities []age.Identity) ([]byte, error) {
+	bundle, err := openBundle(name, identities)
+	if err != nil {
+		return nil, fmt.Errorf("opening bundle %s: %v", name, err)
+	}
+	defer bundle.Close()
+	if offset < 0 || length < 0 {
+		return nil, fmt.Errorf("invalid section in %s", name)
+	}
+	if _, err := io.CopyN(io.Discard, bundle, offset); err != nil {
+		return nil, fmt.Errorf("%s ends before the section: %v", name, err)
+	}
+	var section bytes.Buffer
+	if info, err := os.Stat(name); err == nil {
+		section.Grow(int(min(length, info.Size())))
+	}
+	if n, err := io.Copy(&section, io.LimitReader(bundle, length)); err != nil || n < length {
+		return nil, fmt.Errorf("%s ends inside the section", name)
+	}
+	return section.Bytes(), nil
+}
+
+// sameBundlePath reports whether a bundled path is the one asked for,
+// ignoring a leading "./" or Windows separators.
+func sameBundlePath(bundled, name string) bool {
+	clean := func(p string) string { return path.Clean(filepath.ToSlash(p)) }
+	return clean(bundled) == clean(name)
+}
+
+// writeExtracted writes f to stdout for "-", into out if it is a
+// directory, or else to out, with the mode and mtime of --header-meta.
+func writeExtracted(f clap.BundleFile, out string) error {
+	if out == "-" {
+		_, err := os.Stdout.Write(f.Content)
+		return err
+	}
+	target := hostPath(out)
+	if info, err := os.Stat(target); err == nil && info.IsDir() {
+		target = filepath.Join(target, path.Base(filepath.ToSlash(f.Path)))
+	}
+	perm := os.FileMode(0644)
+	if mode, ok := parseMode(f.Meta[clap.MetaMode]); ok {
+		perm = mode
+	}
+	if err := os.WriteFile(target, f.Content, perm); err != nil {
+		return err
+	}
+	if mtime, err := time.Parse(time.RFC3339, f.Meta[clap.MetaMtime]); err == nil {
+		os.Chtimes(target, mtime, mtime)
+	}
+	logf("%s (%d bytes)\n", target, len(f.Content))
+	return nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"clap/pkg/clap"
+)
+
+// writeIndexed bundles fsys into dir with a --manifest index and returns
+// the index.
+func writeIndexed(t *testing.T, dir string, fsys fstest.MapFS, opts clap.Options) (manifest, string) {
+	t.Helper()
+	var m manifest
+	opts.Placed = m.add
+	b, err := clap.New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundlePath := filepath.Join(dir, "bundle.txt")
+	out, err := os.Create(bundlePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	if err := b.Run(context.Background(), fsys, out); err != nil {
+		t.Fatal(err)
+	}
+	m.finish(bundlePath, nil, nil)
+	return m, bundlePath
+}
+
+func TestExtractIndexed(t *testing.T) {
+	mtime := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	content := strings.Repeat("the same content, long enough to stub\n", 8)
+	fsys := fstest.MapFS{
+		"a/run.sh":   {Data: []byte(content), Mode: 0755, ModTime: mtime},
+		"b/copy.sh":  {Data: []byte(content), Mode: 0700, ModTime: mtime.Add(time.Hour)},
+		"c/plain.go": {Data: []byte("package c\n=== escaped ===\n"), Mode: 0600, ModTime: mtime},
+	}
+	defer func(v int) { verbosity = v }(verbosity)
+	verbosity = -1
+	dir := t.TempDir()
+	m, bundlePath := writeIndexed(t, dir, fsys, clap.Options{HeaderMeta: []string{clap.MetaMode, clap.MetaMtime, clap.MetaSHA256}})
+	manifestPath := filepath.Join(dir, "bundle.json")
+	if err := m.write(manifestPath); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range fsys {
+		f, err := extractIndexed(manifestPath, nil, name, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(f.Content) != string(want.Data) {
+			t.Errorf("%s extracted as %q, want %q", name, f.Content, want.Data)
+		}
+		if problem := verifyMeta(f); problem != "" {
+			t.Errorf("%s: %s", name, problem)
+		}
+		out := filepath.Join(dir, filepath.Base(name))
+		if err := writeExtracted(f, out); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.ModTime().Equal(want.ModTime) {
+			t.Errorf("%s extracted with mtime %v, want %v", name, info.ModTime(), want.ModTime)
+		}
+		// Windows keeps no permission bits beyond read-only.
+		if runtime.GOOS != "windows" && info.Mode().Perm() != want.Mode.Perm() {
+			t.Errorf("%s extracted with mode %v, want %v", name, info.Mode().Perm(), want.Mode.Perm())
+		}
+	}
+	if f, _ := extractIndexed(manifestPath, nil, "b/copy.sh", nil); f.DuplicateOf != "a/run.sh" {
+		t.Errorf("b/copy.sh extracted as a duplicate of %q, want a/run.sh", f.DuplicateOf)
+	}
+
+	// A stale or crafted index.
+	stale := func(edit func(*manifest)) error {
+		t.Helper()
+		m, _ := writeIndexed(t, t.TempDir(), fsys, clap.Options{})
+		edit(&m)
+		name := filepath.Join(t.TempDir(), "stale.json")
+		m.Bundle = bundlePath
+		if err := m.write(name); err != nil {
+			t.Fatal(err)
+		}
+		_, err := extractIndexed(name, nil, "a/run.sh", nil)
+		return err
+	}
+	cycle := func(m *manifest) {
+		for i := range m.Files {
+			m.Files[i].DuplicateOf = map[string]string{"a/run.sh": "b/copy.sh", "b/copy.sh": "a/run.sh"}[m.Files[i].Path]
+		}
+	}
+	if err := stale(cycle); err == nil || !strings.Contains(err.Error(), "lead back") {
+		t.Errorf("duplicates of each other extracted with error %v", err)
+	}
+	huge := func(m *manifest) {
+		for i := range m.Files {
+			m.Files[i].Length = 1 << 50
+		}
+	}
+	if err := stale(huge); err == nil || !strings.Contains(err.Error(), "ends inside the section") {
+		t.Errorf("a section past the end extracted with error %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// readFileList reads the paths listed in name, or stdin for "-", one per
+// line or, with nul, NUL-separated.
+func readFileList(name string, nul bool) ([]string, error) {
+	data, err := readListFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return splitFileList(data, nul), nil
+}
+
+// readListFile reads name, or stdin for "-".
+func readListFile(name string) ([]byte, error) {
+	if name == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(name)
+}
+
+// splitFileList splits data into the paths it lists, one per line or,
+// with nul, NUL-separated.
+func splitFileList(data []byte, nul bool) []string {
+	sep := []byte("\n")
+	if nul {
+		sep = []byte{0}
+	}
+	var files []string
+	for _, entry := range bytes.Split(data, sep) {
+		file := string(entry)
+		if !nul {
+			file = strings.TrimSuffix(file, "\r")
+		}
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// readSelection reads a --files-manifest: paths one per line, like
+// readFileList, or the JSON manifest of an earlier run, whose files are
+// listed in bundle order.
+func readSelection(name string) ([]string, error) {
+	data, err := readListFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var m manifest
+		if err := json.Unmarshal(trimmed, &m); err != nil {
+			return nil, fmt.Errorf("reading %s as a manifest: %v", name, err)
+		}
+		files := make([]string, len(m.Files))
+		for i, f := range m.Files {
+			files[i] = f.Path
+		}
+		return files, nil
+	}
+	return splitFileList(data, false), nil
+}
+
+// filesUnder returns the listed files that lie below root, as slash-
+// separated paths relative to it. Listed paths are relative to the current
+// directory or absolute.
+func filesUnder(root string, files []string) []string {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil
+	}
+	under := []string{}
+	for _, file := range files {
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(absRoot, abs)
+		if err != nil || !filepath.IsLocal(rel) {
+			continue
+		}
+		under = append(under, filepath.ToSlash(rel))
+	}
+	return under
+}
+
+// outsideAll returns the first of files that isn't below any of roots, or
+// "".
+func outsideAll(roots, files []string) string {
+	for _, file := range files {
+		inside := false
+		for _, root := range roots {
+			if len(filesUnder(root, []string{file})) > 0 {
+				inside = true
+				break
+			}
+		}
+		if !inside {
+			return file
+		}
+	}
+	return ""
+}
+
+// intersect returns the entries of a that are also in b.
+func intersect(a, b []string) []string {
+	keep := make(map[string]bool, len(b))
+	for _, s := range b {
+		keep[s] = true
+	}
+	both := []string{}
+	for _, s := range a {
+		if keep[s] {
+			both = append(both, s)
+		}
+	}
+	return both
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"flag"
+	"strconv"
+	"strings"
+)
+
+// stringList is a flag.Value that collects every occurrence of a
+// repeatable flag.
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// parseInterleaved parses args with fs, allowing flags to appear after
+// positional arguments, and returns the positional arguments.
+func parseInterleaved(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		args = rest
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// commaList is a stringList whose values may also be comma-separated, so
+// "-e go,md" and "-e go -e md" are equivalent.
+type commaList []string
+
+func (c *commaList) String() string {
+	return strings.Join(*c, ",")
+}
+
+func (c *commaList) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*c = append(*c, item)
+		}
+	}
+	return nil
+}
+
+// levelFlag is a bare flag that adds step to *level each time it is
+// given, so -v -v counts the same as -vv.
+type levelFlag struct {
+	level *int
+	step  int
+}
+
+func (l *levelFlag) String() string { return "" }
+
+func (l *levelFlag) Set(value string) error {
+	on, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	if on {
+		*l.level += l.step
+	}
+	return nil
+}
+
+// IsBoolFlag lets the flag package accept the bare form.
+func (l *levelFlag) IsBoolFlag() bool { return true }
+
+// optionalString is a flag that may be given bare ("--git-diff") to use
+// its default, or with a value ("--git-diff=main").
+type optionalString struct {
+	value    string
+	fallback string
+	set      bool
+}
+
+func (o *optionalString) String() string {
+	if o == nil {
+		return ""
+	}
+	return o.value
+}
+
+func (o *optionalString) Set(value string) error {
+	if value == "true" {
+		value = o.fallback
+	}
+	if value == "false" {
+		value = ""
+	}
+	o.value, o.set = value, value != ""
+	return nil
+}
+
+// IsBoolFlag lets the flag package accept the bare form.
+func (o *optionalString) IsBoolFlag() bool { return true }
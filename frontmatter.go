@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"clap/pkg/clap"
+)
+
+// frontMatterFields returns the --front-matter fields that record how the
+// bundle was made. The bundler adds the totals.
+func (p *packer) frontMatterFields(now time.Time) []clap.FrontMatterField {
+	fields := []clap.FrontMatterField{{Key: "tool", Value: "clap " + clapVersion()}}
+	if *p.reproducible {
+		// Only what the tree and flags decide.
+		return append(fields, clap.FrontMatterField{Key: "flags", Value: p.setFlags()})
+	}
+	roots := make([]string, len(p.paths))
+	for i, path := range p.paths {
+		roots[i] = path
+		if abs, err := filepath.Abs(path); err == nil && !clap.IsGitURL(path) {
+			roots[i] = abs
+		}
+	}
+	fields = append(fields,
+		clap.FrontMatterField{Key: "generated", Value: now.Format(time.RFC3339)},
+		clap.FrontMatterField{Key: "root", Value: strings.Join(roots, ", ")})
+	vars := outputVars{now: now, root: p.path}
+	if commit := vars.GitHash(); commit != "" {
+		fields = append(fields,
+			clap.FrontMatterField{Key: "git_commit", Value: commit},
+			clap.FrontMatterField{Key: "git_branch", Value: vars.git("rev-parse", "--abbrev-ref", "HEAD")})
+	}
+	return append(fields, clap.FrontMatterField{Key: "flags", Value: p.setFlags()})
+}
+
+// setFlags lists the flags set on the command line or by the config, as
+// they would be typed.
+func (p *packer) setFlags() string {
+	var args []string
+	p.flags.Visit(func(f *flag.Flag) {
+		name := "--" + f.Name
+		if len(f.Name) == 1 {
+			name = "-" + f.Name
+		}
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() && f.Value.String() == "true" {
+			args = append(args, name)
+			return
+		}
+		args = append(args, name+"="+f.Value.String())
+	})
+	return strings.Join(args, " ")
+}
+
+// clapVersion returns the module version clap was built as, or "devel".
+func clapVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return "devel"
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"filippo.io/age"
+
+	"clap/pkg/clap"
+)
+
+// setupGrep implements "clap grep": it searches the files inside bundles
+// and reports each match by the path and line it had in the tree.
+func setupGrep(fs *flag.FlagSet) func(args []string) error {
+	ignoreCase := fs.Bool("i", false, "ignore case")
+	fixed := fs.Bool("F", false, "match the pattern as a plain string, not a regular expression")
+	filesOnly := fs.Bool("l", false, "list only the paths of files with matches")
+	manifestPath := fs.String("manifest", "", "find each file through this --manifest index, which reads any text format and every part of a split bundle")
+	var identityFiles stringList
+	fs.Var(&identityFiles, "identity", "age key file to decrypt an --encrypt bundle with (repeatable)")
+	return func(args []string) error {
+		positional, err := parseInterleaved(fs, args)
+		if err != nil {
+			return err
+		}
+		if len(positional) == 0 || len(positional) == 1 && *manifestPath == "" {
+			return errUsage
+		}
+		pattern := positional[0]
+		if *fixed {
+			pattern = regexp.QuoteMeta(pattern)
+		}
+		if *ignoreCase {
+			pattern = "(?i)" + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern: %v", err)
+		}
+		identities, err := loadIdentities(identityFiles)
+		if err != nil {
+			return err
+		}
+
+		g := &grepper{re: re, filesOnly: *filesOnly}
+		bundles := positional[1:]
+		if *manifestPath != "" {
+			err = g.manifest(hostPath(*manifestPath), bundles, identities)
+		} else {
+			g.prefix = len(bundles) > 1
+			for _, bundle := range bundles {
+				if err = g.bundle(hostPath(bundle), identities); err != nil {
+					break
+				}
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if g.matched == 0 {
+			return fmt.Errorf("no matches for %s", positional[0])
+		}
+		return nil
+	}
+}
+
+// grepper prints the lines of bundled files that match re.
+type grepper struct {
+	re        *regexp.Regexp
+	filesOnly bool
+	prefix    bool // name the bundle before each path
+	matched   int  // files with a match
+}
+
+// bundle searches every file in the bundle at name: a zip or tar archive,
+// or a plain bundle, decompressed and decrypted as needed.
+func (g *grepper) bundle(name string, identities []age.Identity) error {
+	if clap.IsArchive(name) {
+		fsys, closer, err := clap.OpenArchive(name)
+		if err != nil {
+			return fmt.Errorf("opening archive %s: %v", name, err)
+		}
+		defer closer.Close()
+		return fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+			if err != nil || !d.Type().IsRegular() {
+				return err
+			}
+			content, err := fs.ReadFile(fsys, path)
+			if err != nil {
+				return fmt.Errorf("reading %s in %s: %v", path, name, err)
+			}
+			g.file(name, path, content)
+			return nil
+		})
+	}
+
+	bundle, err := openBundle(name, identities)
+	if err != nil {
+		return fmt.Errorf("opening bundle %s: %v", name, err)
+	}
+	defer bundle.Close()
+	err = clap.ReadBundle(bundle, func(path string, content []byte) error {
+		g.file(name, path, content)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("reading bundle %s: %v", name, err)
+	}
+	return nil
+}
+
+// manifest searches the files a --manifest index lists, in its order,
+// reading each one's section from the part it names. The parts are the
+// bundles given, or else those the index names, relative to it.
+func (g *grepper) manifest(name string, bundles []string, identities []age.Identity) error {
+	m, parts, err := loadManifest(name, bundles)
+	if err != nil {
+		return err
+	}
+	g.prefix = len(parts) > 1
+
+	loaded := make([][]byte, len(parts))
+	contents := map[string][]byte{} // for duplicates, whose sections hold stubs
+	for _, f := range m.Files {
+		i := max(f.Part, 1) - 1
+		if i >= len(parts) {
+			return fmt.Errorf("%s: %s is in part %d of %d", name, f.Path, f.Part, len(parts))
+		}
+		if loaded[i] == nil {
+			if loaded[i], err = readDecoded(parts[i], identities); err != nil {
+				return err
+			}
+		}
+		part := loaded[i]
+		if f.Offset < 0 || f.Length < 0 || f.Offset+f.Length > int64(len(part)) {
+			return fmt.Errorf("%s: %s lies past the end of %s; is the manifest stale?", name, f.Path, parts[i])
+		}
+		file, ok := sectionContent(part[f.Offset:f.Offset+f.Length], f)
+		content := file.Content
+		if f.DuplicateOf != "" {
+			content, ok = contents[f.DuplicateOf]
+		}
+		if !ok {
+			return fmt.Errorf("%s: can't find the content of %s in %s; is the manifest stale?", name, f.Path, parts[i])
+		}
+		contents[f.Path] = content
+		g.file(parts[i], f.Path, content)
+	}
+	return nil
+}
+
+// loadManifest reads the --manifest index at name and returns it with the
+// paths of the bundle parts it indexes: bundles, if any are given, or else
+// those it names, relative to it.
+func loadManifest(name string, bundles []string) (manifest, []string, error) {
+	m, err := readManifest(name)
+	if err != nil {
+		return m, nil, err
+	}
+	parts := make([]string, len(bundles))
+	for i, bundle := range bundles {
+		parts[i] = hostPath(bundle)
+	}
+	if len(parts) > 0 {
+		return m, parts, nil
+	}
+	names := m.Parts
+	if names == nil && m.Bundle != "" {
+		names = []string{m.Bundle}
+	}
+	if len(names) == 0 {
+		return m, nil, fmt.Errorf("%s names no bundle; give the bundle's path too", name)
+	}
+	for _, part := range names {
+		parts = append(parts, filepath.Join(filepath.Dir(name), filepath.FromSlash(part)))
+	}
+	return m, parts, nil
+}
+
+// readManifest reads the --manifest index at name.
+func readManifest(name string) (manifest, error) {
+	var m manifest
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return m, err
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, fmt.Errorf("reading %s as a manifest: %v", name, err)
+	}
+	return m, nil
+}
+
+// readDecoded reads the whole bundle at name, decompressed and decrypted,
+// which is what manifest offsets count.
+func readDecoded(name string, identities []age.Identity) ([]byte, error) {
+	bundle, err := openBundle(name, identities)
+	if err != nil {
+		return nil, fmt.Errorf("opening bundle %s: %v", name, err)
+	}
+	defer bundle.Close()
+	data, err := io.ReadAll(bundle)
+	if err != nil {
+		return nil, fmt.Errorf("reading bundle %s: %v", name, err)
+	}
+	return data, nil
+}
+
+// sectionContent finds a file's content in its section, along with the
+// metadata on a plain header. Whatever the format, content that is bundled
+// verbatim starts on one of the section's first lines and is f.Size bytes
+// with f.SHA256; escaped plain content is recovered by parsing the section
+// as a bundle of its own.
+func sectionContent(section []byte, f manifestEntry) (clap.BundleFile, bool) {
+	file, parsed := parseSection(section, f.Path)
+	if !parsed {
+		file = clap.BundleFile{Path: f.Path}
+	}
+	for start, line := 0, 0; start <= len(section) && line < 8; line++ {
+		if end := int64(start) + f.Size; end <= int64(len(section)) {
+			sum := sha256.Sum256(section[start:end])
+			if hex.EncodeToString(sum[:]) == f.SHA256 {
+				file.Content = section[start:end]
+				return file, true
+			}
+		}
+		next := bytes.IndexByte(section[start:], '\n')
+		if next < 0 {
+			break
+		}
+		start += next + 1
+	}
+	return file, parsed
+}
+
+// parseSection parses plain sections as a bundle of their own and returns
+// the last file at path in them.
+func parseSection(sections []byte, path string) (clap.BundleFile, bool) {
+	var file clap.BundleFile
+	found := false
+	err := clap.ReadBundleFiles(bytes.NewReader(sections), func(f clap.BundleFile) error {
+		if f.Path == path {
+			file, found = f, true
+		}
+		return nil
+	})
+	return file, err == nil && found
+}
+
+// file prints the lines of content that match, as bundle:path:line:text,
+// leaving out the bundle unless there are several.
+func (g *grepper) file(bundle, path string, content []byte) {
+	if bytes.IndexByte(content, 0) >= 0 || !g.re.Match(content) {
+		return
+	}
+	name := path
+	if g.prefix {
+		name = bundle + ":" + path
+	}
+	matched := false
+	for n := 1; len(content) > 0; n++ {
+		line := content
+		if i := bytes.IndexByte(content, '\n'); i >= 0 {
+			line, content = content[:i], content[i+1:]
+		} else {
+			content = nil
+		}
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		if !g.re.Match(line) {
+			continue
+		}
+		matched = true
+		if g.filesOnly {
+			fmt.Println(name)
+			break
+		}
+		fmt.Printf("%s:%d:%s\n", name, n, line)
+	}
+	if matched {
+		g.matched++
+	}
+}
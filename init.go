@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+
+	"clap/pkg/clap"
+)
+
+// initHeader starts every config "clap init" writes.
+const initHeader = `# Defaults for running clap in this directory. Flags on the command line
+# override anything set here.
+`
+
+// initExtras are the keys "clap init" leaves commented out, as a starting
+// point for editing.
+const initExtras = `
+# output = "clap.file"
+# tokenizer = "cl100k"      # cl100k or o200k
+# max_tokens = 128000
+# max_size = "200KB"
+`
+
+// junkDirs are directories that are rarely worth bundling but that the
+// default excludes don't cover. The presets' excludes count too.
+var junkDirs = []string{"bin/", "obj/", "out/", "tmp/", "logs/"}
+
+// largeProject is the estimated token count above which "clap init"
+// suggests fitting bundles to a budget.
+const largeProject = 100_000
+
+// setupInit implements "clap init": it looks at the directory, asks a few
+// questions, and writes a project config tuned to the answers.
+func setupInit(fs *flag.FlagSet) func(args []string) error {
+	force := fs.Bool("force", false, "overwrite an existing "+configFile)
+	yes := fs.Bool("yes", false, "take the suggested answers without asking")
+	return func(args []string) error {
+		positional, err := parseInterleaved(fs, args)
+		if err != nil {
+			return err
+		}
+		if len(positional) > 1 {
+			return errUsage
+		}
+		dir := "."
+		if len(positional) == 1 {
+			dir = positional[0]
+		}
+
+		path := filepath.Join(dir, configFile)
+		if _, err := os.Stat(path); err == nil && !*force {
+			return fmt.Errorf("%s already exists (use --force to overwrite)", path)
+		}
+		scan, err := scanProject(dir)
+		if err != nil {
+			return err
+		}
+		logf("Found %d files (%s, about %d tokens)\n", scan.files, clap.FormatSize(scan.bytes), scan.bytes/4)
+
+		settings := scan.suggest()
+		// Without a terminal there's no one to ask, so the suggestions
+		// stand, as with --yes.
+		if !*yes && term.IsTerminal(int(os.Stdin.Fd())) {
+			settings = scan.ask(bufio.NewReader(os.Stdin), settings)
+		}
+
+		flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+		if !*force {
+			flags |= os.O_EXCL
+		}
+		f, err := os.OpenFile(path, flags, 0644)
+		if os.IsExist(err) {
+			return fmt.Errorf("%s already exists (use --force to overwrite)", path)
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := f.WriteString(settings.config()); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		logf("Wrote %s\n", path)
+		return nil
+	}
+}
+
+// projectScan is what "clap init" learns about a directory: the files a
+// bundle would consider, and the junk directories it would rather not.
+type projectScan struct {
+	files int
+	bytes int64
+	exts  map[string]int // lowercased extension to file count
+	top   map[string]bool
+	junk  []string // junkDirs and preset excludes found, as patterns
+}
+
+// scanProject walks dir the way a bundle would by default, leaving out
+// hidden and default-excluded directories, and notes the junk ones.
+func scanProject(dir string) (*projectScan, error) {
+	candidates := slices.Clone(junkDirs)
+	for _, name := range presetNames() {
+		for _, pattern := range presets[name].exclude {
+			if strings.HasSuffix(pattern, "/") && !strings.ContainsAny(pattern, "*?[") && !slices.Contains(candidates, pattern) {
+				candidates = append(candidates, pattern)
+			}
+		}
+	}
+
+	scan := &projectScan{exts: map[string]int{}, top: map[string]bool{}}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if path == dir {
+			return nil
+		}
+		name := d.Name()
+		if filepath.Dir(path) == filepath.Clean(dir) {
+			scan.top[name] = true
+		}
+		if d.IsDir() {
+			if strings.HasPrefix(name, ".") || slices.Contains(clap.DefaultExcludes, name) {
+				return filepath.SkipDir
+			}
+			if slices.Contains(candidates, name+"/") {
+				if !slices.Contains(scan.junk, name+"/") {
+					scan.junk = append(scan.junk, name+"/")
+				}
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(name, ".") || !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		scan.files++
+		scan.bytes += info.Size()
+		scan.exts[strings.ToLower(filepath.Ext(name))]++
+		return nil
+	})
+	return scan, err
+}
+
+// detectPresets returns the presets whose manifests sit at the top of the
+// tree, or whose own extensions make up a tenth of its files.
+func (s *projectScan) detectPresets() []string {
+	var detected []string
+	for _, name := range presetNames() {
+		preset := presets[name]
+		found := false
+		if name != "web" {
+			// web shares package.json with node; only its files count.
+			found = slices.ContainsFunc(preset.names, func(manifest string) bool { return s.top[manifest] })
+		}
+		own := 0
+		for _, ext := range preset.extensions {
+			if !sharedExtension(name, ext) {
+				own += s.exts[ext]
+			}
+		}
+		if found || s.files > 0 && own*10 >= s.files {
+			detected = append(detected, name)
+		}
+	}
+	return detected
+}
+
+// sharedExtension reports whether a preset other than name selects ext.
+func sharedExtension(name, ext string) bool {
+	for other, preset := range presets {
+		if other != name && slices.Contains(preset.extensions, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// initSettings are the keys "clap init" writes.
+type initSettings struct {
+	presets   []string
+	exclude   []string
+	format    string
+	tree      bool
+	fitTokens int
+}
+
+// suggest returns the settings that suit the scanned directory.
+func (s *projectScan) suggest() initSettings {
+	settings := initSettings{presets: s.detectPresets(), format: "plain", tree: true}
+	settings.exclude = s.extraExcludes(settings.presets)
+	if s.bytes/4 > largeProject {
+		settings.fitTokens = 128000
+	}
+	return settings
+}
+
+// extraExcludes returns the junk directories found that presets don't
+// already exclude.
+func (s *projectScan) extraExcludes(chosen []string) []string {
+	var excludes []string
+	for _, pattern := range s.junk {
+		covered := slices.ContainsFunc(chosen, func(name string) bool {
+			return slices.Contains(presets[name].exclude, pattern)
+		})
+		if !covered {
+			excludes = append(excludes, pattern)
+		}
+	}
+	return excludes
+}
+
+// ask puts each of the suggested settings to the user, reading answers
+// from r. An empty answer takes the suggestion.
+func (s *projectScan) ask(r *bufio.Reader, suggested initSettings) initSettings {
+	settings := suggested
+	for {
+		answer := prompt(r, fmt.Sprintf("Presets (%s, or none)", strings.Join(presetNames(), ", ")), cmp.Or(strings.Join(suggested.presets, ","), "none"))
+		chosen, err := parsePresets(answer)
+		if err == nil {
+			settings.presets = chosen
+			break
+		}
+		fmt.Fprintln(os.Stderr, err)
+	}
+
+	settings.exclude = s.extraExcludes(settings.presets)
+	if len(settings.exclude) > 0 {
+		if !promptYes(r, fmt.Sprintf("Exclude %s?", strings.Join(settings.exclude, ", ")), true) {
+			settings.exclude = nil
+		}
+	}
+
+	for {
+		format := prompt(r, "Format (plain, markdown, json, html, or xml-docs)", suggested.format)
+		if slices.Contains(formatNames, format) && !isArchiveFormat(format) {
+			settings.format = format
+			break
+		}
+		fmt.Fprintf(os.Stderr, "unknown format %q\n", format)
+	}
+
+	settings.tree = promptYes(r, "Start bundles with a directory tree?", suggested.tree)
+
+	if s.bytes/4 > largeProject {
+		for {
+			answer := prompt(r, fmt.Sprintf("That's about %d tokens. Fit bundles to this many (0 for no limit)", s.bytes/4), strconv.Itoa(suggested.fitTokens))
+			n, err := strconv.Atoi(answer)
+			if err == nil && n >= 0 {
+				settings.fitTokens = n
+				break
+			}
+			fmt.Fprintf(os.Stderr, "want a number of tokens, not %q\n", answer)
+		}
+	}
+	return settings
+}
+
+// parsePresets reads a comma-separated list of preset names, or "none".
+func parsePresets(answer string) ([]string, error) {
+	if answer == "none" {
+		return nil, nil
+	}
+	var chosen []string
+	for _, name := range strings.Split(answer, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, err := findPreset(name); err != nil {
+			return nil, err
+		}
+		chosen = append(chosen, name)
+	}
+	return chosen, nil
+}
+
+// prompt asks question on stderr and returns the trimmed answer, or def
+// when it is empty or stdin ends.
+func prompt(r *bufio.Reader, question, def string) string {
+	fmt.Fprintf(os.Stderr, "%s [%s]: ", question, def)
+	answer, _ := r.ReadString('\n')
+	return cmp.Or(strings.TrimSpace(answer), def)
+}
+
+// promptYes asks a yes/no question, with def for an empty answer.
+func promptYes(r *bufio.Reader, question string, def bool) bool {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	fmt.Fprintf(os.Stderr, "%s [%s] ", question, hint)
+	answer, _ := r.ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	case "n", "no":
+		return false
+	}
+	return def
+}
+
+// config renders the settings as a project config.
+func (s initSettings) config() string {
+	var sb strings.Builder
+	sb.WriteString(initHeader)
+	sb.WriteString("\n")
+	if len(s.presets) > 0 {
+		fmt.Fprintf(&sb, "preset = %s\n", tomlList(s.presets))
+	} else {
+		sb.WriteString("# extensions = [\"go\", \"md\"]\n")
+	}
+	if len(s.exclude) > 0 {
+		fmt.Fprintf(&sb, "exclude = %s\n", tomlList(s.exclude))
+	}
+	fmt.Fprintf(&sb, "format = %q\n", s.format)
+	fmt.Fprintf(&sb, "tree = %t\n", s.tree)
+	if s.fitTokens > 0 {
+		fmt.Fprintf(&sb, "fit_tokens = %d\n", s.fitTokens)
+	}
+	sb.WriteString(initExtras)
+	return sb.String()
+}
+
+// tomlList formats items as a TOML array of strings.
+func tomlList(items []string) string {
+	quoted := make([]string, len(items))
+	for i, item := range items {
+		quoted[i] = strconv.Quote(item)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
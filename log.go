@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// logOut receives progress and diagnostics, keeping stdout free for the
+// bundle and other results.
+var logOut io.Writer = os.Stderr
+
+// verbosity is -1 with -q, which leaves only errors, 0 by default, and 1
+// or 2 with -v and -vv.
+var verbosity int
+
+// jsonLog is set by --log-format json. Every event is then written to it
+// as one JSON object per line on stderr, in place of the text log.
+var jsonLog *slog.Logger
+
+// setLogFormat selects the text or JSON log. The JSON log's level follows
+// verbosity, so set that first.
+func setLogFormat(format string) error {
+	switch format {
+	case "text":
+		jsonLog = nil
+	case "json":
+		level := slog.LevelInfo
+		switch {
+		case verbosity < 0:
+			level = slog.LevelError
+		case verbosity > 0:
+			level = slog.LevelDebug
+		}
+		jsonLog = slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+	default:
+		return fmt.Errorf("--log-format: unknown value %q (want text or json)", format)
+	}
+	return nil
+}
+
+// logf writes a progress or diagnostic line to logOut, above the progress
+// bar if one is shown, unless -q is set. With the JSON log, the line
+// becomes a "message" event instead.
+func logf(format string, args ...any) {
+	if verbosity < 0 {
+		return
+	}
+	if jsonLog != nil {
+		jsonLog.Info("message", "text", strings.TrimSpace(fmt.Sprintf(format, args...)))
+		return
+	}
+	writeLog(format, args...)
+}
+
+// debugf is logf for lines shown only at verbosity level or above.
+func debugf(level int, format string, args ...any) {
+	if verbosity >= level && jsonLog == nil {
+		writeLog(format, args...)
+	}
+}
+
+// writeLog writes a line of the text log.
+func writeLog(format string, args ...any) {
+	if bar != nil {
+		bar.clear()
+		defer bar.draw(true)
+	}
+	fmt.Fprintf(logOut, format, args...)
+}
+
+// logEvent writes a structured event to the JSON log, if there is one.
+// attrs are alternating keys and values, as for slog.
+func logEvent(level slog.Level, msg string, attrs ...any) {
+	if jsonLog != nil {
+		jsonLog.Log(context.Background(), level, msg, attrs...)
+	}
+}
+
+// logError reports an error, even with -q.
+func logError(err error) {
+	if jsonLog != nil {
+		jsonLog.Error("error", "error", err.Error())
+		return
+	}
+	writeLog("Error %v\n", err)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"strconv"
+
+	"filippo.io/age"
+
+	"clap/pkg/clap"
+)
+
+// setupLs implements "clap ls": it lists the files in a bundle, like
+// tar -tf.
+func setupLs(fs *flag.FlagSet) func(args []string) error {
+	pathsOnly := fs.Bool("paths", false, "print only the paths, one per line")
+	manifestPath := fs.String("manifest", "", "list the files of this --manifest index, without reading the bundle")
+	var identityFiles stringList
+	fs.Var(&identityFiles, "identity", "age key file to decrypt an --encrypt bundle with (repeatable)")
+	return func(args []string) error {
+		positional, err := parseInterleaved(fs, args)
+		if err != nil {
+			return err
+		}
+		var entries []lsEntry
+		switch {
+		case *manifestPath != "" && len(positional) == 0:
+			entries, err = lsManifest(hostPath(*manifestPath))
+		case *manifestPath == "" && len(positional) == 1:
+			identities, ierr := loadIdentities(identityFiles)
+			if ierr != nil {
+				return ierr
+			}
+			entries, err = lsBundle(hostPath(positional[0]), identities)
+		default:
+			return errUsage
+		}
+		if err != nil {
+			return err
+		}
+		printLs(entries, *pathsOnly)
+		return nil
+	}
+}
+
+// lsEntry is one file clap ls lists. sha256 is empty when the bundle
+// doesn't record it.
+type lsEntry struct {
+	path   string
+	size   int64
+	sha256 string
+}
+
+// lsBundle lists the files in the bundle at name: a zip or tar archive, by
+// its entries, or a plain bundle, with the SHA-256 of --header-meta.
+func lsBundle(name string, identities []age.Identity) ([]lsEntry, error) {
+	var entries []lsEntry
+	if clap.IsArchive(name) {
+		fsys, closer, err := clap.OpenArchive(name)
+		if err != nil {
+			return nil, fmt.Errorf("opening archive %s: %v", name, err)
+		}
+		defer closer.Close()
+		err = fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+			if err != nil || !d.Type().IsRegular() {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			entries = append(entries, lsEntry{path: path, size: info.Size()})
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("reading archive %s: %v", name, err)
+		}
+		return entries, nil
+	}
+
+	bundle, err := openBundle(name, identities)
+	if err != nil {
+		return nil, fmt.Errorf("opening bundle %s: %v", name, err)
+	}
+	defer bundle.Close()
+	err = clap.ReadBundleFiles(bundle, func(f clap.BundleFile) error {
+		size := int64(len(f.Content))
+		if n, err := strconv.ParseInt(f.Meta[clap.MetaSize], 10, 64); err == nil {
+			size = n
+		}
+		entries = append(entries, lsEntry{path: f.Path, size: size, sha256: f.Meta[clap.MetaSHA256]})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading bundle %s: %v", name, err)
+	}
+	return entries, nil
+}
+
+// lsManifest lists the files of a --manifest index, in bundle order.
+func lsManifest(name string) ([]lsEntry, error) {
+	m, err := readManifest(name)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]lsEntry, len(m.Files))
+	for i, f := range m.Files {
+		entries[i] = lsEntry{path: f.Path, size: f.Size, sha256: f.SHA256}
+	}
+	return entries, nil
+}
+
+// printLs prints one line per entry: its size, its SHA-256 if known, and
+// its path, or with pathsOnly, just the path.
+func printLs(entries []lsEntry, pathsOnly bool) {
+	width := 0
+	for _, e := range entries {
+		width = max(width, len(strconv.FormatInt(e.size, 10)))
+	}
+	for _, e := range entries {
+		switch {
+		case pathsOnly:
+			fmt.Println(e.path)
+		case e.sha256 != "":
+			fmt.Printf("%*d  %s  %s\n", width, e.size, e.sha256, e.path)
+		default:
+			fmt.Printf("%*d  %s\n", width, e.size, e.path)
+		}
+	}
+}
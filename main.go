@@ -1,93 +1,127 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
-	"path/filepath"
-	"strings"
 )
 
-func main() {
-	outputFilename := flag.String("o", "clap.file", "output filename")
-	flag.Parse()
-
-	args := flag.Args()
-	if len(args) < 1 {
-		fmt.Println("👏 Clap slaps all your files into one!")
-		fmt.Println("Usage: clap [-o filename] <path> [extensions...]")
-		os.Exit(1)
-	}
+// command is one clap subcommand. setup registers the command's flags on
+// fs and returns the function that runs it with the remaining arguments.
+type command struct {
+	name     string
+	synopsis string // arguments shown after "clap <name>" in usage
+	summary  string
+	setup    func(fs *flag.FlagSet) func(args []string) error
+}
 
-	path := args[0]
-	extensions := normalizeExtensions(args[1:])
+// commands lists every subcommand, in the order usage shows them. A bare
+// "clap <path>" runs the first.
+var commands = []*command{
+	{name: "pack", synopsis: "[flags] <path>... [-e extensions]", summary: "bundle files into one (the default)", setup: setupPack},
+	{name: "unpack", synopsis: "[--out dir] <bundle>", summary: "split a bundle back into files", setup: setupUnpack},
+	{name: "extract", synopsis: "[-o dest] <bundle> <path>", summary: "pull one file out of a bundle", setup: setupExtract},
+	{name: "ls", synopsis: "[--paths] <bundle> | --manifest file", summary: "list the files in a bundle with their sizes and hashes", setup: setupLs},
+	{name: "apply", synopsis: "[--root dir] [--yes] <bundle>", summary: "write a bundle's edited files back over the tree", setup: setupApply},
+	{name: "diff", synopsis: "<old bundle> <new bundle>", summary: "list files added, removed, or changed between bundles", setup: setupDiff},
+	{name: "grep", synopsis: "[flags] <pattern> <bundle>...", summary: "search the files inside bundles by their original paths and lines", setup: setupGrep},
+	{name: "verify", synopsis: "[flags] <bundle> <path>...", summary: "check that a bundle still matches the tree it was built from", setup: setupVerify},
+	{name: "stats", synopsis: "[flags] <path>... [-e extensions]", summary: "show files, bytes, and tokens by directory, heaviest first", setup: setupStats},
+	{name: "watch", synopsis: "[flags] <path>... [-e extensions]", summary: "rebuild the bundle whenever the tree changes", setup: setupWatch},
+	{name: "reveal", synopsis: "[--key file] [file]", summary: "restore the names an --anonymize bundle hides", setup: setupReveal},
+	{name: "pick", synopsis: "[flags] <path>... [-e extensions]", summary: "choose the files to bundle in a terminal picker", setup: setupPick},
+	{name: "serve", synopsis: "--mcp | --listen addr [path]", summary: "serve bundles to LLM agents over MCP, or to anything over HTTP", setup: setupServe},
+	{name: "init", synopsis: "[--force] [--yes] [dir]", summary: "write a " + configFile + " tuned to the project", setup: setupInit},
+}
 
-	var contentBuilder strings.Builder
+// errUsage reports that the command line doesn't describe anything to do.
+var errUsage = errors.New("usage")
 
-	err := filepath.Walk(path, func(filePath string, info os.FileInfo, err error) error {
-		if err != nil {
-			fmt.Printf("Error accessing path %s: %v\n", filePath, err)
-			return err
+func main() {
+	args := os.Args[1:]
+	cmd, explicit := commands[0], false
+	if len(args) > 0 {
+		if args[0] == "help" {
+			help(args[1:])
+			return
 		}
-
-		if info.IsDir() || !shouldPrintFile(filePath, extensions) {
-			return nil
+		if c := findCommand(args[0]); c != nil {
+			cmd, explicit, args = c, true, args[1:]
 		}
+	}
 
-		fmt.Printf("%s (%d bytes)\n", filePath, info.Size())
-
-		content, err := os.ReadFile(filePath)
-		if err != nil {
-			fmt.Printf("Error reading file %s: %v\n", filePath, err)
-			return nil
+	fs := flag.NewFlagSet("clap "+cmd.name, flag.ExitOnError)
+	fs.Usage = func() { commandUsage(cmd, fs) }
+	run := cmd.setup(fs)
+	if err := run(args); err != nil {
+		switch {
+		case err == errUsage && explicit:
+			commandUsage(cmd, fs)
+		case err == errUsage:
+			usage()
+		default:
+			logError(err)
 		}
-
-		contentBuilder.WriteString("=== ")
-		contentBuilder.WriteString(filePath)
-		contentBuilder.WriteString(" ===\n")
-		contentBuilder.Write(content)
-		contentBuilder.WriteString("\n\n")
-
-		return nil
-	})
-
-	if err != nil {
-		fmt.Printf("Error walking the path %s: %v\n", path, err)
 		os.Exit(1)
 	}
+}
 
-	outputPath := filepath.Join(path, *outputFilename)
-	if err := os.WriteFile(outputPath, []byte(contentBuilder.String()), 0644); err != nil {
-		fmt.Printf("Error writing output file %s: %v\n", outputPath, err)
-		os.Exit(1)
+// findCommand returns the subcommand called name, or nil.
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
 	}
-
-	fmt.Printf("Content written to %s\n", outputPath)
+	return nil
 }
 
-// normalizeExtensions converts extensions to a map with leading dots and lowercase.
-// Returns nil if no extensions provided (accept all files).
-func normalizeExtensions(extensions []string) map[string]bool {
-	if len(extensions) == 0 {
-		return nil
+// help implements "clap help [command]".
+func help(args []string) {
+	if len(args) == 0 {
+		usage()
+		return
 	}
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		fmt.Printf("Unknown command %q\n\n", args[0])
+		usage()
+		os.Exit(1)
+	}
+	fs := flag.NewFlagSet("clap "+cmd.name, flag.ExitOnError)
+	cmd.setup(fs)
+	commandUsage(cmd, fs)
+}
 
-	extMap := make(map[string]bool, len(extensions))
-	for _, ext := range extensions {
-		if !strings.HasPrefix(ext, ".") {
-			ext = "." + ext
-		}
-		extMap[strings.ToLower(ext)] = true
+// usage prints the overview of every command.
+func usage() {
+	fmt.Println("👏 Clap slaps all your files into one!")
+	fmt.Println("Usage: clap [flags] <path>... [-e extensions]")
+	fmt.Println("       clap <command> [arguments]")
+	fmt.Println()
+	fmt.Println("Commands:")
+	width := 0
+	for _, cmd := range commands {
+		width = max(width, len(cmd.name))
+	}
+	for _, cmd := range commands {
+		fmt.Printf("  %-*s %s\n", width, cmd.name, cmd.summary)
 	}
-	return extMap
+	fmt.Println()
+	fmt.Println(`Run "clap help <command>" for a command's flags.`)
 }
 
-// shouldPrintFile returns true if the file matches the extension filter.
-// If extensions is nil, all files are included.
-func shouldPrintFile(filePath string, extensions map[string]bool) bool {
-	if extensions == nil {
-		return true
+// commandUsage prints the help for one command.
+func commandUsage(cmd *command, fs *flag.FlagSet) {
+	fmt.Printf("Usage: clap %s %s\n", cmd.name, cmd.synopsis)
+	hasFlags := false
+	fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+	if !hasFlags {
+		return
 	}
-	ext := strings.ToLower(filepath.Ext(filePath))
-	return extensions[ext]
+	fmt.Println()
+	fmt.Println("Flags:")
+	fs.SetOutput(os.Stdout)
+	fs.PrintDefaults()
 }
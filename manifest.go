@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"clap/pkg/clap"
+)
+
+// manifest is the --manifest sidecar: where each file's section sits in
+// the bundle, and what its content hashes to.
+type manifest struct {
+	Bundle string          `json:"bundle,omitempty"` // relative to the manifest; "" for stdout or the clipboard
+	Parts  []string        `json:"parts,omitempty"`  // with --split, in order, like Bundle
+	Files  []manifestEntry `json:"files"`
+}
+
+type manifestEntry struct {
+	Path   string `json:"path"`
+	Part   int    `json:"part,omitempty"` // 1-based index into Parts
+	Offset int64  `json:"offset"`
+	Length int64  `json:"length"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+
+	// DuplicateOf names the earlier file whose content this one has, when
+	// it was bundled as an "identical to" stub. Size and SHA256 are the
+	// stub's.
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+}
+
+// add records a file the bundler placed.
+func (m *manifest) add(pl clap.Placement) {
+	m.Files = append(m.Files, manifestEntry{
+		Path:   pl.Path,
+		Part:   pl.Part,
+		Offset: pl.Offset,
+		Length: pl.Length,
+		Size:   pl.Size,
+		SHA256: hex.EncodeToString(pl.SHA256[:]),
+
+		DuplicateOf: pl.DuplicateOf,
+	})
+}
+
+// finish records where the bundle went. With --split, parts are the files
+// written and headers the lines before each one's content, which shift
+// its offsets.
+func (m *manifest) finish(bundle string, parts, headers []string) {
+	if parts == nil {
+		m.Bundle = bundle
+		for i := range m.Files {
+			m.Files[i].Part = 0
+		}
+		return
+	}
+	m.Parts = parts
+	for i := range m.Files {
+		f := &m.Files[i]
+		f.Offset += int64(len(headers[f.Part-1]))
+	}
+}
+
+// write saves the manifest to path through a temporary file, like the
+// bundle itself. Bundle and part names are made relative to path's
+// directory, so the two can be moved together.
+func (m *manifest) write(path string) error {
+	dir, _ := filepath.Abs(filepath.Dir(path))
+	rel := func(name string) string {
+		abs, err := filepath.Abs(name)
+		if name == "" || err != nil {
+			return name
+		}
+		if r, err := filepath.Rel(dir, abs); err == nil {
+			return filepath.ToSlash(r)
+		}
+		return name
+	}
+	m.Bundle = rel(m.Bundle)
+	for i, part := range m.Parts {
+		m.Parts[i] = rel(part)
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), outputTemp+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
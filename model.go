@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// modelPreset holds the settings that suit one target LLM, applied by
+// --model beneath the command line and the project config.
+type modelPreset struct {
+	tokenizer string // closest available encoding
+	window    int    // context window in tokens, the --max-tokens warning
+	split     string // part size for --split auto, leaving room for a reply
+
+	// The wrapper the model handles best: a format, or plain headers and
+	// footers.
+	format string
+	header string
+	footer string
+}
+
+// models lists the --model presets. Claude and Gemini tokenizers aren't
+// public, so their counts are cl100k estimates.
+var models = map[string]modelPreset{
+	"claude-sonnet": {
+		tokenizer: "cl100k",
+		window:    200_000,
+		split:     "150kt",
+		format:    "xml-docs",
+	},
+	"gpt-4o": {
+		tokenizer: "o200k",
+		window:    128_000,
+		split:     "100kt",
+		format:    "markdown",
+	},
+	"gemini-pro": {
+		tokenizer: "cl100k",
+		window:    1_000_000,
+		split:     "800kt",
+		format:    "markdown",
+	},
+}
+
+// modelNames returns the preset names, sorted.
+func modelNames() []string {
+	return slices.Sorted(maps.Keys(models))
+}
+
+// findModel returns the preset called name.
+func findModel(name string) (modelPreset, error) {
+	preset, ok := models[name]
+	if !ok {
+		return modelPreset{}, fmt.Errorf("unknown model %q (want %s)", name, strings.Join(modelNames(), ", "))
+	}
+	return preset, nil
+}
+
+// apply sets the flags the preset covers, unless the command line or the
+// config already did. The wrapper is all or nothing: giving any of
+// --format, --header, or --footer keeps the preset's out of the way.
+func (m modelPreset) apply(flags *flag.FlagSet) error {
+	explicit := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	var errs []error
+	set := func(name, value string) {
+		if !explicit[name] && value != "" {
+			errs = append(errs, flags.Set(name, value))
+		}
+	}
+	set("tokenizer", m.tokenizer)
+	set("max-tokens", strconv.Itoa(m.window))
+	if !explicit["format"] && !explicit["header"] && !explicit["footer"] {
+		set("format", m.format)
+		set("header", m.header)
+		set("footer", m.footer)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// outputVars are the fields available in an -o template. Git and user
+// lookups only run when the template uses them, and slashes in values such
+// as branch names become dashes, so they can't create directories.
+type outputVars struct {
+	now  time.Time
+	root string // the scanned path
+}
+
+// Date is the local date, e.g. 2024-06-01.
+func (v outputVars) Date() string { return v.now.Format("2006-01-02") }
+
+// Time is the local time of day, e.g. 150405.
+func (v outputVars) Time() string { return v.now.Format("150405") }
+
+// Timestamp is the Unix time in seconds.
+func (v outputVars) Timestamp() string { return fmt.Sprint(v.now.Unix()) }
+
+// GitHash is the full hash of the checked-out commit, or "" outside a
+// repository.
+func (v outputVars) GitHash() string { return v.git("rev-parse", "HEAD") }
+
+// GitShort is the abbreviated commit hash.
+func (v outputVars) GitShort() string { return v.git("rev-parse", "--short", "HEAD") }
+
+// GitBranch is the current branch, or "HEAD" when detached.
+func (v outputVars) GitBranch() string { return pathSafe(v.git("rev-parse", "--abbrev-ref", "HEAD")) }
+
+// Host is the machine's host name.
+func (v outputVars) Host() string {
+	host, _ := os.Hostname()
+	return pathSafe(host)
+}
+
+// User is the current user's login name.
+func (v outputVars) User() string {
+	if u, err := user.Current(); err == nil {
+		return pathSafe(u.Username)
+	}
+	return ""
+}
+
+// Project is the base name of the scanned directory.
+func (v outputVars) Project() string {
+	abs, err := filepath.Abs(v.root)
+	if err != nil {
+		return ""
+	}
+	return pathSafe(filepath.Base(abs))
+}
+
+func (v outputVars) git(args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = v.root
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// isOutputTemplate reports whether name has placeholders to expand.
+func isOutputTemplate(name string) bool {
+	return strings.Contains(name, "{{")
+}
+
+// expandOutput fills in the placeholders of an -o template.
+func expandOutput(name, root string, now time.Time) (string, error) {
+	tmpl, err := template.New("output").Parse(name)
+	if err != nil {
+		return "", err
+	}
+	var sb bytes.Buffer
+	if err := tmpl.Execute(&sb, outputVars{now: now, root: root}); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// pathSafe replaces path separators in s.
+func pathSafe(s string) string {
+	return strings.NewReplacer("/", "-", "\\", "-").Replace(s)
+}
+
+// placeholder matches one {{...}} action in an -o template.
+var placeholder = regexp.MustCompile(`\{\{.*?\}\}`)
+
+// outputGlob turns an -o template into a glob matching every name it can
+// expand to, so earlier bundles are still recognized as clap's own.
+func outputGlob(name string) string {
+	return placeholder.ReplaceAllString(name, "*")
+}
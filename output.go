@@ -0,0 +1,232 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// output is where a bundle is written: a file, stdout, or the clipboard.
+type output struct {
+	name string      // used in messages
+	w    io.Writer   // receives the bundle
+	info os.FileInfo // set for files, so the walk can skip the bundle itself
+
+	closeFn func() error
+	abortFn func() // discards a partly written output; nil to just close
+	closed  bool
+}
+
+// Close finishes the output. It is safe to call more than once.
+func (o *output) Close() error {
+	if o.closed {
+		return nil
+	}
+	o.closed = true
+	return o.closeFn()
+}
+
+// Abort discards the output unless Close already finished it, so a
+// failed run leaves any previous bundle untouched.
+func (o *output) Abort() {
+	if o.closed {
+		return
+	}
+	o.closed = true
+	if o.abortFn == nil {
+		o.closeFn()
+		return
+	}
+	o.abortFn()
+}
+
+// outputTemp prefixes the temporary file a bundle is written to before
+// being renamed into place.
+const outputTemp = ".clap-tmp-"
+
+// openFileOutput prepares the bundle file at path. The bundle is written
+// to a temporary file next to it and renamed over path on Close, so path
+// never holds a half-written bundle. info describes the previous bundle,
+// if there is one; with backup, Close first rotates it to path.1.
+func openFileOutput(path string, backup bool) (*output, error) {
+	temp, err := os.CreateTemp(filepath.Dir(path), outputTemp+"*")
+	if err != nil {
+		return nil, fmt.Errorf("creating output file %s: %v", path, err)
+	}
+	info, _ := os.Stat(path)
+
+	closeFn := func() error {
+		if err := temp.Chmod(0644); err != nil {
+			temp.Close()
+			os.Remove(temp.Name())
+			return err
+		}
+		if err := temp.Close(); err != nil {
+			os.Remove(temp.Name())
+			return err
+		}
+		if backup {
+			if err := rotateBackups(path); err != nil {
+				os.Remove(temp.Name())
+				return err
+			}
+		}
+		if err := os.Rename(temp.Name(), path); err != nil {
+			os.Remove(temp.Name())
+			return err
+		}
+		return nil
+	}
+	abortFn := func() {
+		temp.Close()
+		os.Remove(temp.Name())
+	}
+	return &output{name: path, w: temp, info: info, closeFn: closeFn, abortFn: abortFn}, nil
+}
+
+// maxBackups is how many earlier bundles --backup keeps.
+const maxBackups = 5
+
+// backupPath returns the name of the nth backup of path.
+func backupPath(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
+// isBackup reports whether name is a backup of output.
+func isBackup(output, name string) bool {
+	for n := 1; n <= maxBackups; n++ {
+		if name == backupPath(output, n) {
+			return true
+		}
+	}
+	return false
+}
+
+// rotateBackups moves path to path.1, path.1 to path.2, and so on, dropping
+// the oldest beyond maxBackups. A missing path is left alone.
+func rotateBackups(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+	for n := maxBackups - 1; n >= 1; n-- {
+		if err := os.Rename(backupPath(path, n), backupPath(path, n+1)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return os.Rename(path, backupPath(path, 1))
+}
+
+// stdoutOutput writes the bundle to stdout.
+func stdoutOutput() *output {
+	return &output{name: "stdout", w: os.Stdout, closeFn: func() error { return nil }}
+}
+
+// openClipboardOutput pipes the bundle into the platform's clipboard tool.
+func openClipboardOutput() (*output, error) {
+	cmd, err := clipboardCommand()
+	if err != nil {
+		return nil, err
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("starting %s: %v", cmd.Path, err)
+	}
+
+	closeFn := func() error {
+		if err := stdin.Close(); err != nil {
+			return err
+		}
+		return cmd.Wait()
+	}
+	return &output{name: "clipboard", w: stdin, closeFn: closeFn}, nil
+}
+
+// clipboardCommand returns the command that copies its stdin to the
+// system clipboard on this platform.
+func clipboardCommand() (*exec.Cmd, error) {
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("pbcopy"), nil
+	case "windows":
+		return exec.Command("clip"), nil
+	}
+
+	// Wayland first, then the common X11 tools.
+	candidates := [][]string{
+		{"xclip", "-selection", "clipboard"},
+		{"xsel", "--clipboard", "--input"},
+	}
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		candidates = append([][]string{{"wl-copy"}}, candidates...)
+	}
+	for _, candidate := range candidates {
+		if path, err := exec.LookPath(candidate[0]); err == nil {
+			return exec.Command(path, candidate[1:]...), nil
+		}
+	}
+	return nil, fmt.Errorf("no clipboard tool found (install wl-clipboard, xclip, or xsel)")
+}
+
+// outputSpec is an -o value beyond the first: another file to write the
+// same bundle to, in its own format.
+type outputSpec struct {
+	name   string
+	format string // "" for --format's
+}
+
+// outputFlag is -o. The first value names the bundle, in *name, and may
+// end in ":<format>" to set --format; each repeat adds an outputSpec to
+// *also.
+type outputFlag struct {
+	name  *string
+	also  *[]outputSpec
+	flags *flag.FlagSet
+	set   bool
+}
+
+func (o *outputFlag) String() string {
+	if o == nil || o.name == nil {
+		return ""
+	}
+	return *o.name
+}
+
+func (o *outputFlag) Set(value string) error {
+	name, format := splitOutputSpec(value)
+	if o.set {
+		*o.also = append(*o.also, outputSpec{name, format})
+		return nil
+	}
+	o.set = true
+	*o.name = name
+	if format != "" {
+		return o.flags.Set("format", format)
+	}
+	return nil
+}
+
+// formatNames lists every --format value, aliases included.
+var formatNames = []string{"plain", "markdown", "md", "json", "jsonl", "ndjson", "html", "xml-docs", "xml", "zip", "tar.gz", "tgz", "sqlite"}
+
+// splitOutputSpec splits "<name>:<format>" into its parts. Anything after
+// the last colon that isn't a format name is part of the file name, so
+// names such as C:\ctx.md are left whole.
+func splitOutputSpec(value string) (name, format string) {
+	i := strings.LastIndex(value, ":")
+	if i > 0 && slices.Contains(formatNames, value[i+1:]) {
+		return value[:i], value[i+1:]
+	}
+	return value, ""
+}
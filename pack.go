@@ -0,0 +1,1488 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"clap/pkg/clap"
+)
+
+// packer holds the flags shared by every command that builds a bundle.
+type packer struct {
+	flags *flag.FlagSet
+
+	output            *string
+	noGitignore       *bool
+	noClapignore      *bool
+	noDefaultExcludes *bool
+	noTests           *bool
+	noGenerated       *bool
+	hidden            *bool
+	exclude           stringList
+	includeRe         stringList
+	excludeRe         stringList
+	format            *string
+	chunkTokens       *int
+	chunkOverlap      *int
+	langs             stringList
+	headerMeta        commaList
+	framing           *string
+	model             *string
+	preset            commaList
+	header            *string
+	footer            *string
+	tokenizer         *string
+	maxTokens         *int
+	fitTokens         *int
+	fitPriority       stringList
+	includeBinary     *bool
+	skipEmpty         *bool
+	errors            *string
+	encoding          *string
+	maxDepth          *int
+	maxSize           *string
+	confirmOver       *string
+	newerThan         *string
+	pathStyle         *string
+	stripPrefix       *string
+	olderThan         *string
+	grep              *string
+	grepInvert        *bool
+	truncateLines     *int
+	truncateBytes     *string
+	truncateTail      *bool
+	split             *string
+	normalizeEOL      *string
+	trimTrailingSpace *bool
+	tabsToSpaces      *int
+	lineNumbers       *bool
+	noDedupe          *bool
+	redact            *bool
+	sanitize          *string
+	sanitizeEscape    *bool
+	anonymize         *bool
+	anonymizeKey      *string
+	anonymizeIdent    stringList
+	stripComments     *bool
+	signatures        *bool
+	toStdout          *bool
+	clipboard         *bool
+	skipOutput        stringList
+	tree              *bool
+	frontMatter       *bool
+	reproducible      *bool
+	sort              *string
+	goOrder           *bool
+	goPackages        *bool
+	reverse           *bool
+	weights           stringList
+	first             stringList
+	last              stringList
+	gitTracked        *bool
+	filesFrom         *string
+	filesManifest     *string
+	nulList           *bool
+	gitDiff           optionalString
+	followSymlinks    *bool
+	jobs              *int
+	walkJobs          *int
+	throttle          *string
+	nice              *bool
+	dryRun            *bool
+	noProgress        *bool
+	report            *string
+	logFormat         *string
+	useCache          *bool
+	config            *string
+	force             *bool
+	backup            *bool
+	compress          *string
+	encrypt           stringList
+	manifest          *string
+	perDir            *int
+	profile           *string
+	ref               *string
+	quiet             *bool
+	verbose           int
+
+	extensions commaList
+	names      stringList
+	paths      []string
+	path       string            // first of paths, or an archive's directory; holds the config and the output
+	cache      *clap.Cache       // loaded on the first run with --cache
+	anon       *clap.Anonymizer  // loaded on the first run with --anonymize
+	fileList   []string          // read from --files-from
+	selection  []string          // read from --files-manifest, in order
+	outName    string            // -o with its placeholders expanded, for the current run
+	also       []outputSpec      // repeated -o values
+	alsoNames  []string          // their names with placeholders expanded, for the current run
+	dirName    string            // the --per-dir directory of the current run, made path safe
+	written    map[string]bool   // outputs this process wrote, which it may overwrite
+	confirmed  bool              // --confirm-over was answered yes, so later runs don't ask
+	clones     map[string]string // remote repository URL to its clone
+}
+
+// cacheFile holds file contents and token counts between runs with --cache.
+const cacheFile = ".clap-cache"
+
+// anonymizeKeyFile is where --anonymize keeps its key and mapping unless
+// --anonymize-key says otherwise.
+const anonymizeKeyFile = ".clap-anon.json"
+
+// setupPack implements "clap pack", which also runs when no command is
+// given: it builds the bundle once.
+func setupPack(fs *flag.FlagSet) func(args []string) error {
+	p := newPacker(fs)
+	return func(args []string) error {
+		if err := p.parse(args); err != nil {
+			return err
+		}
+		// Interrupting stops the run cleanly, leaving any previous bundle
+		// in place.
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		defer p.close()
+		return p.runAll(ctx)
+	}
+}
+
+// newPacker registers the bundling flags on fs.
+func newPacker(fs *flag.FlagSet) *packer {
+	p := &packer{flags: fs}
+
+	p.output = new(string)
+	*p.output = clap.DefaultOutput
+	fs.Var(&outputFlag{name: p.output, also: &p.also, flags: fs}, "o", "output filename, optionally name:format, repeatable to write several formats from one pass; may use {{.Date}}, {{.Time}}, {{.GitShort}}, {{.GitBranch}}, {{.Host}}, {{.Project}}, ...")
+	fs.Var(&p.extensions, "e", "only include these extensions (comma-separated or repeatable)")
+	fs.Var(&p.names, "include-name", "with -e, also include files with this name, e.g. go.mod or Makefile (repeatable)")
+	fs.Var(&p.preset, "preset", "select the sources, manifests, and excludes of "+strings.Join(presetNames(), ", ")+" (comma-separated or repeatable)")
+	p.noGitignore = fs.Bool("no-gitignore", false, "include files ignored by .gitignore")
+	p.noClapignore = fs.Bool("no-clapignore", false, "include files ignored by "+clap.ClapignoreFile)
+	p.noDefaultExcludes = fs.Bool("no-default-excludes", false, "include "+strings.Join(clap.DefaultExcludes, ", ")+" directories")
+	p.hidden = fs.Bool("hidden", false, "include hidden files and directories (dotfiles, and the hidden attribute on Windows)")
+	p.noGenerated = fs.Bool("no-generated", false, "skip generated files (marked \"Code generated ... DO NOT EDIT\" or @generated, *.pb.go, *_gen.go, ...) and minified assets")
+	p.noTests = fs.Bool("no-tests", false, "skip test files and fixtures (*_test.go, *.spec.ts, test_*.py, tests/, testdata/, ...)")
+	fs.Var(&p.exclude, "exclude", "skip paths matching glob (repeatable, supports **)")
+	fs.Var(&p.includeRe, "include-re", "only include files whose relative path matches this Go regexp (repeatable)")
+	fs.Var(&p.excludeRe, "exclude-re", "skip files whose relative path matches this Go regexp (repeatable)")
+	p.format = fs.String("format", "plain", "output format: plain, markdown, json, jsonl, html, xml-docs, zip, tar.gz, or sqlite")
+	p.chunkTokens = fs.Int("chunk-tokens", 0, "with --format jsonl, cut files into chunks of about this many tokens, one per line")
+	p.chunkOverlap = fs.Int("chunk-overlap", 0, "tokens each chunk repeats from the end of the one before")
+	fs.Var(&p.langs, "lang", "name the language of an extension or file name for code fences and highlighting, e.g. .tpl=handlebars or BUILD=starlark (repeatable)")
+	p.framing = fs.String("framing", "", "delimit plain bundle files by escaping header-like lines (escape, the default) or by length (safe), which keeps any content exact")
+	fs.Var(&p.headerMeta, "header-meta", "add metadata to each file header: size, mode, mtime, sha256 (or hash), lang (comma-separated)")
+	p.model = fs.String("model", "", "preset tokenizer, --max-tokens, --split auto size, and wrapper for "+strings.Join(modelNames(), ", "))
+	p.header = fs.String("header", "", "template for the line before each file, e.g. '<file path=\"{{.Path}}\">' (plain format)")
+	p.footer = fs.String("footer", "", "template for the line after each file, e.g. '</file>' (plain format)")
+	p.tokenizer = fs.String("tokenizer", "cl100k", "token encoding: cl100k or o200k")
+	p.maxTokens = fs.Int("max-tokens", 0, "warn when the bundle exceeds this many tokens")
+	p.fitTokens = fs.Int("fit-tokens", 0, "drop or truncate files until the bundle, headers included, fits this many tokens: tests first, then the largest")
+	fs.Var(&p.fitPriority, "fit-priority", "keep files matching glob longest under --fit-tokens (repeatable, most important first)")
+	p.skipEmpty = fs.Bool("skip-empty", true, "leave out empty and whitespace-only files, marking them (empty) in the tree; --skip-empty=false keeps them")
+	p.includeBinary = fs.Bool("include-binary", false, "include files that look binary")
+	p.errors = fs.String("errors", "warn", "unreadable files and directories: warn and skip them, skip them quietly, or fail")
+	p.encoding = fs.String("encoding", "utf-8", "utf-8 transcodes Latin-1, UTF-16, and Shift-JIS files and drops BOMs; keep leaves them as is")
+	p.maxDepth = fs.Int("max-depth", 0, "only descend this many directory levels (1 = top-level files only)")
+	p.maxSize = fs.String("max-size", "", "skip files larger than this (e.g. 200KB, 1.5MB)")
+	p.pathStyle = fs.String("path-style", "", "show paths relative to each bundled directory, absolute, or under its basename (relative, absolute, or basename; default as given)")
+	p.stripPrefix = fs.String("strip-prefix", "", "remove this directory from the start of every path shown")
+	p.newerThan = fs.String("newer-than", "", "only include files modified after this date (2024-06-01) or within this age (48h, 7d, 2w)")
+	p.olderThan = fs.String("older-than", "", "only include files modified before this date or longer ago than this age")
+	p.grep = fs.String("grep", "", "only include files whose content matches this Go regexp")
+	p.grepInvert = fs.Bool("grep-invert", false, "with --grep, include only the files that don't match")
+	p.confirmOver = fs.String("confirm-over", "", "ask before bundling files that add up to more than this (e.g. 50MB), and stop if there's no terminal")
+	p.truncateLines = fs.Int("truncate-lines", 0, "cut files longer than this many lines to their first lines and a \"…[truncated N lines]…\" marker")
+	p.truncateBytes = fs.String("truncate-bytes", "", "cut files larger than this (e.g. 20KB) the same way")
+	p.truncateTail = fs.Bool("truncate-tail", false, "keep the end of truncated files too, splitting the limit between head and tail")
+	p.stripComments = fs.Bool("strip-comments", false, "remove comments from source files to save tokens")
+	p.signatures = fs.Bool("signatures", false, "keep only the declarations and function signatures of Go files, eliding bodies")
+	p.redact = fs.Bool("redact", false, "replace secrets such as API keys and private keys with placeholders")
+	p.sanitize = fs.String("sanitize", clap.SanitizeAuto, "remove ANSI escapes and control characters from files that aren't code (auto), every file (all), or none (off)")
+	p.sanitizeEscape = fs.Bool("sanitize-escape", false, "write control characters as visible escapes such as \\x1b instead of removing them")
+	p.anonymize = fs.Bool("anonymize", false, "replace file and directory names with stable pseudonyms, keeping the mapping in a key file")
+	p.anonymizeKey = fs.String("anonymize-key", "", "key file for --anonymize (default <path>/"+anonymizeKeyFile+")")
+	fs.Var(&p.anonymizeIdent, "anonymize-ident", "with --anonymize, also replace content matching this Go regexp (repeatable)")
+	p.normalizeEOL = fs.String("normalize-eol", clap.EOLKeep, "rewrite line endings: lf, crlf, or keep")
+	p.trimTrailingSpace = fs.Bool("trim-trailing-space", false, "drop spaces and tabs at the ends of lines")
+	p.tabsToSpaces = fs.Int("tabs-to-spaces", 0, "expand tabs to spaces with tab stops this many columns apart")
+	p.lineNumbers = fs.Bool("line-numbers", false, "prefix each content line with its line number")
+	p.noDedupe = fs.Bool("no-dedupe", false, "include every copy of identical files instead of an \"identical to\" stub")
+	p.split = fs.String("split", "", "write numbered parts of at most this size (e.g. 100k) or tokens (e.g. 100kt), or auto for the --model's")
+	p.force = fs.Bool("force", false, "overwrite an existing output file")
+	p.compress = fs.String("compress", "", "compress the bundle with gzip or zstd, adding .gz or .zst to its name")
+	p.manifest = fs.String("manifest", "", "also write a JSON index of each file's offset, length, size, and SHA-256 in the bundle to this file")
+	fs.Var(&p.encrypt, "encrypt", "encrypt the bundle to an age1... recipient, adding .age to its name (repeatable)")
+	p.backup = fs.Bool("backup", false, "keep an existing output file as <output>.1 (up to 5 backups) instead of refusing to overwrite it")
+	p.perDir = fs.Int("per-dir", 0, "write one bundle per directory this many levels down, named after it, e.g. clap-services-auth.file for 2")
+	p.toStdout = fs.Bool("stdout", false, "write the bundle to stdout (same as -o -)")
+	p.clipboard = fs.Bool("clipboard", false, "copy the bundle to the system clipboard instead of writing a file")
+	fs.Var(&p.skipOutput, "skip-output", "glob of previous bundles to skip (repeatable, "+clap.DefaultOutput+" always)")
+	p.gitTracked = fs.Bool("git-tracked", false, "only include files tracked by git")
+	p.gitDiff.fallback = "HEAD"
+	fs.Var(&p.gitDiff, "git-diff", "only include files changed relative to a git ref (--git-diff=<ref>, default HEAD)")
+	p.filesFrom = fs.String("files-from", "", "only include the files listed in this file, one per line (- for stdin)")
+	p.filesManifest = fs.String("files-manifest", "", "bundle exactly the files listed in this file, one per line or a previous --manifest, in that order, without walking")
+	p.nulList = fs.Bool("0", false, "--files-from entries are NUL-separated, as from find -print0 or git ls-files -z")
+	p.sort = fs.String("sort", "", "order files by path, size, mtime, ext, or go (default: by name within each directory)")
+	p.goOrder = fs.Bool("go-order", false, "bundle Go packages after the packages they import, like --sort go; imports come from go/parser, ignoring build tags and go.mod replaces")
+	p.goPackages = fs.Bool("go-packages", false, "start each Go package's files with a header naming it, in plain and markdown bundles; implies --go-order")
+	p.reverse = fs.Bool("reverse", false, "reverse the file order")
+	fs.Var(&p.weights, "weight", fmt.Sprintf("rank files matching glob by importance, e.g. 'internal/core/**=80': heavier ones come first and are dropped last by --fit-tokens (repeatable, last match wins, default %d)", clap.DefaultWeight))
+	fs.Var(&p.first, "first", "glob of files to bundle before all others, e.g. README.md (repeatable, in order)")
+	fs.Var(&p.last, "last", "glob of files to bundle after all others (repeatable, in order)")
+	p.tree = fs.Bool("tree", false, "start the bundle with a directory tree of included files")
+	p.reproducible = fs.Bool("reproducible", false, "make identical trees and flags bundle byte for byte the same: sort by path, and leave out timestamps and absolute paths")
+	p.frontMatter = fs.Bool("front-matter", false, "start the bundle with a YAML block recording the clap version, time, root, git commit, flags, and totals (plain and markdown)")
+	p.followSymlinks = fs.Bool("follow-symlinks", false, "descend into symlinked directories (loops are detected and skipped)")
+	p.jobs = fs.Int("jobs", runtime.NumCPU(), "number of files to read concurrently")
+	p.walkJobs = fs.Int("walk-jobs", 1, "number of directories to list concurrently ahead of the walk, for network file systems and huge trees")
+	p.throttle = fs.String("throttle", "", "read file contents no faster than this, e.g. 50MB/s")
+	p.nice = fs.Bool("nice", false, "go easy on a shared machine: read and list with one worker, overriding --jobs and --walk-jobs")
+	p.useCache = fs.Bool("cache", false, "remember each file's bundled content and token count in <path>/"+cacheFile+" so reruns only read changed files")
+	p.report = fs.String("report", "text", "summary after bundling: text, json, or none")
+	p.quiet = fs.Bool("q", false, "print nothing but errors")
+	fs.Var(&levelFlag{level: &p.verbose, step: 1}, "v", "also list skipped directories and show timings")
+	fs.Var(&levelFlag{level: &p.verbose, step: 2}, "vv", "like -v, and list every file the filters leave out and why")
+	p.logFormat = fs.String("log-format", "text", "progress and diagnostics: text, or json for one JSON object per line on stderr")
+	p.noProgress = fs.Bool("no-progress", false, "don't show a progress bar on a terminal's stderr")
+	p.dryRun = fs.Bool("dry-run", false, "list the files that would be bundled, without reading or writing them")
+	p.ref = fs.String("ref", "", "branch, tag, or commit to check out when a path is a git URL (default: its default branch)")
+	p.profile = fs.String("p", "", "apply this [profile.<name>] from the config on top of its top-level keys")
+	p.config = fs.String("config", "", "config file (default <path>/"+configFile+")")
+	return p
+}
+
+// parse reads the command line and the project config. It returns
+// errUsage when there's no path and no config to go on.
+func (p *packer) parse(args []string) error {
+	positional, err := parseInterleaved(p.flags, args)
+	if err != nil {
+		return err
+	}
+
+	// Older releases took extensions as positional arguments after the
+	// path. Anything that doesn't exist but looks like one is still
+	// accepted that way.
+	for i, arg := range positional {
+		if i > 0 && isLegacyExtension(arg) {
+			p.flags.Set("e", arg)
+			continue
+		}
+		p.paths = append(p.paths, hostPath(arg))
+	}
+
+	// With no paths, a project config in the current directory makes clap
+	// bundle ".".
+	p.path = "."
+	if len(p.paths) > 0 {
+		p.path = p.paths[0]
+	}
+	if isArchivePath(p.path) {
+		p.path = filepath.Dir(p.path)
+	}
+	// A remote repository is cloned to a temporary directory, so the config
+	// and the bundle stay in the current one.
+	if clap.IsGitURL(p.path) {
+		p.path = "."
+	}
+
+	cfgPath, required := findConfig(*p.config, p.path)
+	cfg, found, err := loadConfig(cfgPath, required)
+	if err != nil {
+		return fmt.Errorf("reading config %s: %v", cfgPath, err)
+	}
+	if *p.filesFrom != "" {
+		if p.fileList, err = readFileList(*p.filesFrom, *p.nulList); err != nil {
+			return fmt.Errorf("--files-from: %v", err)
+		}
+	}
+	if *p.filesManifest != "" {
+		if *p.filesFrom != "" || *p.gitTracked || p.gitDiff.set {
+			return fmt.Errorf("--files-manifest doesn't mix with --files-from, --git-tracked, or --git-diff")
+		}
+		if p.selection, err = readSelection(*p.filesManifest); err != nil {
+			return fmt.Errorf("--files-manifest: %v", err)
+		}
+	}
+	if len(p.paths) == 0 && !found && *p.filesFrom == "" && *p.filesManifest == "" {
+		return errUsage
+	}
+	if *p.profile != "" {
+		profile, err := cfg.profile(*p.profile)
+		if err != nil {
+			return fmt.Errorf("in config %s: %v", cfgPath, err)
+		}
+		cfg.override(profile)
+	}
+	if err := cfg.apply(p.flags); err != nil {
+		return fmt.Errorf("in config %s: %v", cfgPath, err)
+	}
+	if *p.model != "" {
+		preset, err := findModel(*p.model)
+		if err != nil {
+			return fmt.Errorf("--model: %v", err)
+		}
+		if err := preset.apply(p.flags); err != nil {
+			return fmt.Errorf("--model %s: %v", *p.model, err)
+		}
+	}
+	for _, name := range p.preset {
+		preset, err := findPreset(name)
+		if err != nil {
+			return fmt.Errorf("--preset: %v", err)
+		}
+		if err := preset.apply(p.flags); err != nil {
+			return fmt.Errorf("--preset %s: %v", name, err)
+		}
+	}
+	if *p.ref != "" && !slices.ContainsFunc(p.paths, clap.IsGitURL) {
+		return fmt.Errorf("--ref needs a git URL to clone")
+	}
+	if *p.quiet && p.verbose > 0 {
+		return fmt.Errorf("-q and -v can't be combined")
+	}
+	verbosity = min(p.verbose, 2)
+	if *p.quiet {
+		verbosity = -1
+	}
+	if err := setLogFormat(*p.logFormat); err != nil {
+		return err
+	}
+	if len(p.paths) == 0 {
+		p.paths = []string{p.path}
+	}
+
+	if *p.output == "-" {
+		*p.toStdout = true
+	}
+	*p.output = hostPath(*p.output)
+	return nil
+}
+
+// isLegacyExtension reports whether a positional argument is an extension
+// in the old "clap <path> [extensions...]" form rather than a path.
+func isLegacyExtension(arg string) bool {
+	if _, err := os.Stat(arg); err == nil {
+		return false
+	}
+	ext := strings.TrimPrefix(arg, ".")
+	if ext == "" || len(ext) > 16 {
+		return false
+	}
+	for _, r := range ext {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' || r == '+') {
+			return false
+		}
+	}
+	return true
+}
+
+// isArchivePath reports whether path names an archive file to bundle
+// in place of a directory.
+func isArchivePath(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular() && clap.IsArchive(path)
+}
+
+// isArchiveFormat reports whether format writes a binary archive rather
+// than text.
+func isArchiveFormat(format string) bool {
+	switch format {
+	case "zip", "tar.gz", "tgz", "sqlite":
+		return true
+	}
+	return false
+}
+
+// outputPath returns the bundle file path, or "" when the bundle goes to
+// stdout or the clipboard.
+func (p *packer) outputPath() string {
+	if *p.toStdout || *p.clipboard {
+		return ""
+	}
+	name := p.outName
+	if name == "" {
+		name = *p.output
+	}
+	return p.filePath(name)
+}
+
+// filePath turns an -o file name into the path written, adding the
+// --per-dir directory and the --compress and --encrypt extensions.
+func (p *packer) filePath(name string) string {
+	if p.dirName != "" {
+		name = perDirOutput(name, p.dirName)
+	}
+	return p.withOutputExt(p.resolveOutput(name))
+}
+
+// resolveOutput places a bare -o file name in the scanned directory, next
+// to its config. Any other name, such as /tmp/ctx.md, ./ctx.md, or
+// out/ctx.md, is a path of its own, relative to the working directory.
+func (p *packer) resolveOutput(name string) string {
+	if filepath.Base(name) != name {
+		return filepath.Clean(name)
+	}
+	return filepath.Join(p.path, name)
+}
+
+// withOutputExt appends the extensions --compress and --encrypt add to
+// name.
+func (p *packer) withOutputExt(name string) string {
+	name = withExt(name, compressExt(*p.compress))
+	if len(p.encrypt) > 0 {
+		name = withExt(name, ageExt)
+	}
+	return name
+}
+
+// encodes reports whether the bundle is compressed or encrypted on its
+// way out.
+func (p *packer) encodes() bool {
+	return *p.compress != "" || len(p.encrypt) > 0
+}
+
+// encodeOutput makes out compress and encrypt as asked.
+func (p *packer) encodeOutput(out *output) error {
+	recipients, err := parseRecipients(p.encrypt)
+	if err != nil {
+		return err
+	}
+	return encodeOutput(out, *p.compress, recipients)
+}
+
+// isOutput reports whether name is a file clap writes: the bundle (any
+// directory's with --per-dir), its parts when splitting, the cache, or
+// the --anonymize key file.
+func (p *packer) isOutput(name string) bool {
+	name = filepath.Clean(name)
+	if cache := filepath.Join(p.path, cacheFile); *p.useCache && strings.HasPrefix(name, cache) {
+		return true
+	}
+	if key := filepath.Clean(p.anonymizeKeyPath()); *p.anonymize && strings.HasPrefix(name, key) {
+		return true
+	}
+	output := p.outputPath()
+	if output == "" {
+		return false
+	}
+	output = filepath.Clean(output)
+	if samePath(name, output) || *p.split != "" && isPart(output, name) || *p.backup && isBackup(output, name) {
+		return true
+	}
+	if *p.perDir > 0 {
+		glob := p.withOutputExt(p.resolveOutput(perDirOutput(outputGlob(*p.output), "*")))
+		if matched, _ := filepath.Match(glob, name); matched || *p.split != "" && isPart(glob, name) {
+			return true
+		}
+	}
+	for _, spec := range p.also {
+		glob := outputGlob(spec.name)
+		if *p.perDir > 0 {
+			glob = perDirOutput(glob, "*")
+		}
+		if matched, _ := filepath.Match(p.withOutputExt(p.resolveOutput(glob)), name); matched {
+			return true
+		}
+	}
+	// Bundles from earlier runs of an -o template have other names.
+	if isOutputTemplate(*p.output) {
+		glob := p.resolveOutput(outputGlob(*p.output))
+		matched, _ := filepath.Match(glob, name)
+		return matched || *p.split != "" && isPart(glob, name)
+	}
+	return false
+}
+
+// openOutput opens the bundle destination selected by the flags.
+func (p *packer) openOutput() (*output, error) {
+	switch {
+	case *p.clipboard:
+		return openClipboardOutput()
+	case *p.toStdout:
+		out := stdoutOutput()
+		if p.encodes() {
+			return out, p.encodeOutput(out)
+		}
+		return out, nil
+	}
+	out, err := openFileOutput(p.outputPath(), *p.backup)
+	if err == nil && p.encodes() {
+		err = p.encodeOutput(out)
+	}
+	return out, err
+}
+
+// checkClobber refuses to replace an existing bundle at path unless
+// --force or --backup allows it, or this process wrote it (as watch does
+// on every rebuild).
+func (p *packer) checkClobber(path string) error {
+	if *p.force || *p.backup || p.written[path] {
+		return nil
+	}
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists; use --force to overwrite it or --backup to keep a copy", path)
+	}
+	return nil
+}
+
+// wrote records that path holds a bundle from this process.
+func (p *packer) wrote(path string) {
+	if p.written == nil {
+		p.written = map[string]bool{}
+	}
+	p.written[path] = true
+}
+
+// run builds the bundle once, logging per-file progress and a summary.
+func (p *packer) run(ctx context.Context) error {
+	switch *p.report {
+	case "text", "json", "none":
+	default:
+		return fmt.Errorf("--report: unknown value %q (want text, json, or none)", *p.report)
+	}
+
+	// With --report json, the JSON summary replaces all other progress
+	// output so it can be parsed. Errors and warnings are still logged.
+	// The JSON log has events of its own in place of these lines.
+	say := logf
+	if *p.report == "json" || jsonLog != nil {
+		say = func(string, ...any) {}
+	}
+
+	var sum summary
+	var tooLarge, unreadable, overBudget, truncated []string
+	var droppedTokens int
+	var redacted, redactedFiles, transcoded, sanitized, duplicates, unmatched int
+
+	now := time.Now()
+	p.outName = *p.output
+	if isOutputTemplate(*p.output) && !*p.toStdout && !*p.clipboard {
+		var err error
+		if p.outName, err = expandOutput(*p.output, p.path, now); err != nil {
+			return fmt.Errorf("-o: %v", err)
+		}
+	}
+	p.alsoNames = p.alsoNames[:0]
+	for _, spec := range p.also {
+		name, err := expandOutput(spec.name, p.path, now)
+		if err != nil {
+			return fmt.Errorf("-o: %v", err)
+		}
+		p.alsoNames = append(p.alsoNames, name)
+	}
+
+	opts, err := p.options()
+	if err != nil {
+		return err
+	}
+	var progress *progressBar
+	if !*p.noProgress && !*p.dryRun && jsonLog == nil && verbosity >= 0 {
+		progress = startProgress()
+		defer progress.finish()
+	}
+	if confirmOver, _ := p.confirmOverSize(); confirmOver > 0 && !*p.dryRun {
+		opts.Confirm = func(files int, size int64) error {
+			if size <= confirmOver || p.confirmed {
+				return nil
+			}
+			ok, err := confirm(fmt.Sprintf("Bundle %d files (%s), over --confirm-over %s?", files, clap.FormatSize(size), clap.FormatSize(confirmOver)))
+			if err != nil {
+				return fmt.Errorf("%d files (%s) are over --confirm-over %s and there's no terminal to confirm on", files, clap.FormatSize(size), clap.FormatSize(confirmOver))
+			}
+			if !ok {
+				return fmt.Errorf("stopped at the --confirm-over prompt")
+			}
+			p.confirmed = true
+			return nil
+		}
+	}
+	start := time.Now()
+	opts.Selected = func(files int) {
+		debugf(1, "Found %d files after %s\n", files, time.Since(start).Round(time.Millisecond))
+		progress.selected(files)
+	}
+	opts.Filtered = func(path string, dir bool, reason string) {
+		level := 2
+		if dir {
+			level, path = 1, path+"/"
+		}
+		if verbosity >= level {
+			debugf(level, "%s (%s, filtered)\n", path, reason)
+			logEvent(slog.LevelDebug, "filtered", "path", path, "reason", reason)
+		}
+	}
+	opts.Report = func(e clap.Event) {
+		defer progress.add(e)
+		switch {
+		case e.Err != nil:
+			unreadable = append(unreadable, e.Path)
+			switch {
+			case *p.errors == "skip":
+			case jsonLog != nil:
+				logEvent(slog.LevelError, "error", "path", e.Path, "error", e.Err.Error())
+			default:
+				logError(fmt.Errorf("reading %s: %v", e.Path, e.Err))
+			}
+		case e.Skipped == clap.SkippedTooLarge:
+			say("%s (%s, over --max-size, skipped)\n", e.Path, clap.FormatSize(e.Size))
+			logEvent(slog.LevelInfo, "skip", "path", e.Path, "bytes", e.Size, "reason", e.Skipped)
+			tooLarge = append(tooLarge, e.Path)
+		case e.Skipped == clap.SkippedOverBudget:
+			say("%s (%d tokens, over --fit-tokens, skipped)\n", e.Path, e.Tokens)
+			logEvent(slog.LevelInfo, "skip", "path", e.Path, "bytes", e.Size, "tokens", e.Tokens, "reason", e.Skipped)
+			overBudget = append(overBudget, e.Path)
+			droppedTokens += e.Tokens
+		case e.Skipped == clap.SkippedNoMatch:
+			// Like the walk's filters, these are only worth listing with -vv.
+			if verbosity >= 2 {
+				debugf(2, "%s (no --grep match, skipped)\n", e.Path)
+				logEvent(slog.LevelDebug, "skip", "path", e.Path, "reason", e.Skipped)
+			}
+			unmatched++
+		case e.Skipped != "":
+			say("%s (%s, skipped)\n", e.Path, e.Skipped)
+			logEvent(slog.LevelInfo, "skip", "path", e.Path, "reason", e.Skipped)
+		case *p.dryRun:
+			say("%s (%s)\n", e.Path, clap.FormatSize(e.Size))
+			logEvent(slog.LevelInfo, "file", "path", e.Path, "bytes", e.Size)
+			sum.add(e)
+		default:
+			say("%s (%d bytes, %d tokens)\n", e.Path, e.Size, e.Tokens)
+			logEvent(slog.LevelInfo, "file", fileAttrs(e)...)
+			for _, r := range e.Redactions {
+				say("  redacted %s on line %d\n", r.Kind, r.Line)
+			}
+			if e.DuplicateOf != "" {
+				say("  identical to %s\n", e.DuplicateOf)
+				duplicates++
+			}
+			if e.Encoding != "" {
+				say("  transcoded from %s\n", e.Encoding)
+				transcoded++
+			}
+			if e.Sanitized {
+				say("  control characters removed\n")
+				sanitized++
+			}
+			if e.Truncated {
+				say("  truncated\n")
+				truncated = append(truncated, e.Path)
+			}
+			if len(e.Redactions) > 0 {
+				redacted += len(e.Redactions)
+				redactedFiles++
+			}
+			sum.add(e)
+		}
+	}
+
+	sources, closeSources, err := p.sources(ctx)
+	defer closeSources()
+	if err != nil {
+		return err
+	}
+
+	var written string
+	if *p.dryRun {
+		if err := p.list(ctx, opts, sources); err != nil {
+			return err
+		}
+		say("Would bundle %d files (%s)\n", sum.Files, clap.FormatSize(sum.Bytes))
+	} else {
+		if *p.useCache {
+			if err := p.loadCache(); err != nil {
+				return err
+			}
+			opts.Cache = p.cache
+		}
+		written, err = p.write(ctx, opts, sources)
+		progress.finish()
+		if err == errEmptyDir {
+			say("Nothing to bundle in %s\n", p.paths[0])
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		say("Content written to %s (%d files, %d bytes, %d tokens)\n", written, sum.Files, sum.Bytes, sum.Tokens)
+		if p.cache != nil {
+			hits, misses := p.cache.Stats()
+			say("Cache: %d files unchanged, %d read\n", hits, misses)
+			logEvent(slog.LevelInfo, "cache", "unchanged", hits, "read", misses)
+			if err := p.cache.Save(filepath.Join(p.path, cacheFile)); err != nil {
+				logError(fmt.Errorf("saving cache: %v", err))
+			}
+		}
+	}
+	if p.anon != nil {
+		// Without the mapping the bundle can't be revealed, so this one
+		// is an error.
+		if err := p.anon.Save(p.anonymizeKeyPath()); err != nil {
+			return fmt.Errorf("saving %s: %v", p.anonymizeKeyPath(), err)
+		}
+	}
+	if duplicates > 0 {
+		say("Deduplicated %d files\n", duplicates)
+	}
+	if transcoded > 0 {
+		say("Transcoded %d files to UTF-8\n", transcoded)
+	}
+	if sanitized > 0 {
+		say("Removed control characters from %d files\n", sanitized)
+	}
+	if redacted > 0 {
+		say("Redacted %d secrets in %d files\n", redacted, redactedFiles)
+	}
+	if unmatched > 0 {
+		say("Left out %d files not matching --grep\n", unmatched)
+	}
+	if len(tooLarge) > 0 {
+		say("Skipped %d files larger than %s: %s\n", len(tooLarge), clap.FormatSize(opts.MaxSize), strings.Join(tooLarge, ", "))
+	}
+	if len(overBudget) > 0 {
+		say("Dropped %d files (%d tokens) to fit --fit-tokens %d: %s\n", len(overBudget), droppedTokens, opts.FitTokens, strings.Join(overBudget, ", "))
+	}
+	if len(truncated) > 0 {
+		say("Truncated %d files: %s\n", len(truncated), strings.Join(truncated, ", "))
+	}
+	if len(unreadable) > 0 && jsonLog == nil {
+		logf("Skipped %d unreadable paths: %s\n", len(unreadable), strings.Join(unreadable, ", "))
+	}
+	if *p.maxTokens > 0 && sum.Tokens > *p.maxTokens {
+		if jsonLog != nil {
+			logEvent(slog.LevelWarn, "max_tokens", "tokens", sum.Tokens, "max_tokens", *p.maxTokens)
+		} else {
+			logf("Warning: bundle has %d tokens, exceeding --max-tokens %d\n", sum.Tokens, *p.maxTokens)
+		}
+	}
+
+	sum.finish()
+	debugf(1, "Done in %s\n", time.Since(start).Round(time.Millisecond))
+	logEvent(slog.LevelInfo, "summary",
+		"output", written, "dry_run", *p.dryRun,
+		"files", sum.Files, "bytes", sum.Bytes, "tokens", sum.Tokens,
+		"duplicates", duplicates, "transcoded", transcoded, "sanitized", sanitized,
+		"redacted", redacted, "too_large", len(tooLarge), "unreadable", len(unreadable),
+		"over_budget", len(overBudget), "truncated", len(truncated), "unmatched", unmatched,
+		"largest", sum.Largest, "extensions", sum.Extensions,
+		"duration_ms", time.Since(start).Milliseconds())
+	switch *p.report {
+	case "text":
+		if jsonLog == nil && verbosity >= 0 {
+			sum.writeText(logOut)
+		}
+	case "json":
+		// The JSON report is a result, so it goes to stdout unless the
+		// bundle does.
+		out := os.Stdout
+		if *p.toStdout {
+			out = os.Stderr
+		}
+		return sum.writeJSON(out)
+	}
+	return nil
+}
+
+// fileAttrs describes an included file for the JSON log.
+func fileAttrs(e clap.Event) []any {
+	attrs := []any{"path", e.Path, "bytes", e.Size, "tokens", e.Tokens}
+	if e.DuplicateOf != "" {
+		attrs = append(attrs, "duplicate_of", e.DuplicateOf)
+	}
+	if e.Truncated {
+		attrs = append(attrs, "truncated", true)
+	}
+	if e.Encoding != "" {
+		attrs = append(attrs, "encoding", e.Encoding)
+	}
+	if e.Sanitized {
+		attrs = append(attrs, "sanitized", true)
+	}
+	if len(e.Redactions) > 0 {
+		redactions := make([]map[string]any, len(e.Redactions))
+		for i, r := range e.Redactions {
+			redactions[i] = map[string]any{"kind": r.Kind, "line": r.Line}
+		}
+		attrs = append(attrs, "redactions", redactions)
+	}
+	return attrs
+}
+
+// confirmOverSize parses --confirm-over, zero when it isn't set.
+func (p *packer) confirmOverSize() (int64, error) {
+	if *p.confirmOver == "" {
+		return 0, nil
+	}
+	size, err := clap.ParseSize(*p.confirmOver)
+	if err != nil {
+		return 0, fmt.Errorf("--confirm-over: %v", err)
+	}
+	return size, nil
+}
+
+// options translates the flags into bundler options, without a Report.
+func (p *packer) options() (clap.Options, error) {
+	maxSize := int64(0)
+	if *p.maxSize != "" {
+		var err error
+		if maxSize, err = clap.ParseSize(*p.maxSize); err != nil {
+			return clap.Options{}, fmt.Errorf("--max-size: %v", err)
+		}
+	}
+	if _, err := p.confirmOverSize(); err != nil {
+		return clap.Options{}, err
+	}
+	readRate := int64(0)
+	if *p.throttle != "" {
+		var err error
+		if readRate, err = clap.ParseSize(strings.TrimSuffix(*p.throttle, "/s")); err != nil {
+			return clap.Options{}, fmt.Errorf("--throttle: %v", err)
+		}
+	}
+	jobs, walkJobs := *p.jobs, *p.walkJobs
+	if *p.nice {
+		jobs, walkJobs = 1, 1
+	}
+	switch *p.pathStyle {
+	case "", "relative", "absolute", "basename":
+	default:
+		return clap.Options{}, fmt.Errorf("--path-style: unknown style %q (want relative, absolute, or basename)", *p.pathStyle)
+	}
+	if *p.reproducible {
+		if *p.pathStyle == "absolute" {
+			return clap.Options{}, fmt.Errorf("--reproducible leaves out absolute paths; drop --path-style absolute")
+		}
+		if len(p.encrypt) > 0 {
+			return clap.Options{}, fmt.Errorf("--reproducible doesn't work with --encrypt, which never encrypts the same way twice")
+		}
+	}
+
+	now := time.Now()
+	var newerThan, olderThan time.Time
+	if *p.newerThan != "" {
+		var err error
+		if newerThan, err = clap.ParseTime(*p.newerThan, now); err != nil {
+			return clap.Options{}, fmt.Errorf("--newer-than: %v", err)
+		}
+	}
+	if *p.olderThan != "" {
+		var err error
+		if olderThan, err = clap.ParseTime(*p.olderThan, now); err != nil {
+			return clap.Options{}, fmt.Errorf("--older-than: %v", err)
+		}
+	}
+	if *p.grepInvert && *p.grep == "" {
+		return clap.Options{}, fmt.Errorf("--grep-invert needs --grep")
+	}
+	if !*p.anonymize && (*p.anonymizeKey != "" || len(p.anonymizeIdent) > 0) {
+		return clap.Options{}, fmt.Errorf("--anonymize-key and --anonymize-ident need --anonymize")
+	}
+	if *p.anonymize {
+		if err := p.loadAnonymizer(); err != nil {
+			return clap.Options{}, err
+		}
+	}
+
+	var truncateBytes int64
+	if *p.truncateBytes != "" {
+		var err error
+		if truncateBytes, err = clap.ParseSize(*p.truncateBytes); err != nil {
+			return clap.Options{}, fmt.Errorf("--truncate-bytes: %v", err)
+		}
+	}
+	if *p.truncateLines < 0 {
+		return clap.Options{}, fmt.Errorf("--truncate-lines: want a positive number of lines")
+	}
+
+	var splitBytes int64
+	var splitTokens int
+	if *p.split != "" {
+		if *p.toStdout || *p.clipboard {
+			return clap.Options{}, fmt.Errorf("--split needs a file output")
+		}
+		split := *p.split
+		if split == "auto" {
+			if *p.model == "" {
+				return clap.Options{}, fmt.Errorf("--split auto needs --model")
+			}
+			split = models[*p.model].split
+		}
+		var err error
+		if splitBytes, splitTokens, err = parseSplit(split); err != nil {
+			return clap.Options{}, fmt.Errorf("--split: %v", err)
+		}
+	}
+
+	if *p.clipboard && isArchiveFormat(*p.format) {
+		return clap.Options{}, fmt.Errorf("--clipboard needs a text format, not %s", *p.format)
+	}
+	switch *p.compress {
+	case "":
+	case "gzip", "zstd":
+		if *p.clipboard {
+			return clap.Options{}, fmt.Errorf("--compress doesn't work with --clipboard")
+		}
+		if isArchiveFormat(*p.format) && *p.format != "sqlite" {
+			return clap.Options{}, fmt.Errorf("--compress doesn't apply to %s, which is compressed already", *p.format)
+		}
+	default:
+		return clap.Options{}, fmt.Errorf("--compress: unknown method %q (want gzip or zstd)", *p.compress)
+	}
+	if *p.manifest != "" && isArchiveFormat(*p.format) {
+		return clap.Options{}, fmt.Errorf("--manifest needs a text format, not %s", *p.format)
+	}
+	if len(p.also) > 0 {
+		switch {
+		case *p.toStdout || *p.clipboard:
+			return clap.Options{}, fmt.Errorf("-o can only be repeated to write files, not stdout or the clipboard")
+		case *p.split != "":
+			return clap.Options{}, fmt.Errorf("-o can't be repeated with --split")
+		case *p.manifest != "":
+			return clap.Options{}, fmt.Errorf("-o can't be repeated with --manifest")
+		}
+		for _, spec := range p.also {
+			if spec.format == "" {
+				continue
+			}
+			if *p.compress != "" && isArchiveFormat(spec.format) && spec.format != "sqlite" {
+				return clap.Options{}, fmt.Errorf("--compress doesn't apply to %s, which is compressed already", spec.format)
+			}
+		}
+	}
+	if len(p.encrypt) > 0 {
+		if *p.clipboard {
+			return clap.Options{}, fmt.Errorf("--encrypt doesn't work with --clipboard")
+		}
+		if _, err := parseRecipients(p.encrypt); err != nil {
+			return clap.Options{}, err
+		}
+	}
+
+	var langs map[string]string
+	for _, lang := range p.langs {
+		key, value, ok := strings.Cut(lang, "=")
+		if !ok {
+			return clap.Options{}, fmt.Errorf("--lang: want <extension or name>=<language>, not %q", lang)
+		}
+		if langs == nil {
+			langs = map[string]string{}
+		}
+		langs[key] = value
+	}
+
+	var weights []clap.Weight
+	for _, spec := range p.weights {
+		i := strings.LastIndex(spec, "=")
+		n, err := strconv.Atoi(spec[i+1:])
+		if i <= 0 || err != nil {
+			return clap.Options{}, fmt.Errorf("--weight: want <glob>=<weight>, not %q", spec)
+		}
+		weights = append(weights, clap.Weight{Pattern: spec[:i], Weight: n})
+	}
+
+	switch *p.errors {
+	case "skip", "warn", "fail":
+	default:
+		return clap.Options{}, fmt.Errorf("--errors: unknown value %q (want skip, warn, or fail)", *p.errors)
+	}
+
+	switch *p.sanitize {
+	case clap.SanitizeAuto, clap.SanitizeAll, clap.SanitizeOff:
+	default:
+		return clap.Options{}, fmt.Errorf("--sanitize: unknown value %q (want auto, all, or off)", *p.sanitize)
+	}
+
+	switch *p.normalizeEOL {
+	case clap.EOLLF, clap.EOLCRLF, clap.EOLKeep:
+	default:
+		return clap.Options{}, fmt.Errorf("--normalize-eol: unknown value %q (want lf, crlf, or keep)", *p.normalizeEOL)
+	}
+	if *p.tabsToSpaces < 0 {
+		return clap.Options{}, fmt.Errorf("--tabs-to-spaces: negative width %d", *p.tabsToSpaces)
+	}
+
+	sort := *p.sort
+	if *p.goOrder || *p.goPackages {
+		if sort != "" && sort != "go" {
+			flag := "--go-order"
+			if !*p.goOrder {
+				flag = "--go-packages"
+			}
+			return clap.Options{}, fmt.Errorf("%s and --sort %s don't mix", flag, sort)
+		}
+		sort = "go"
+	}
+
+	switch *p.encoding {
+	case "utf-8", "keep":
+	default:
+		return clap.Options{}, fmt.Errorf("--encoding: unknown value %q (want utf-8 or keep)", *p.encoding)
+	}
+
+	opts := clap.Options{
+		Extensions:        p.extensions,
+		Names:             p.names,
+		Exclude:           p.exclude,
+		IncludeRegexp:     p.includeRe,
+		ExcludeRegexp:     p.excludeRe,
+		StripPrefix:       *p.stripPrefix,
+		NewerThan:         newerThan,
+		OlderThan:         olderThan,
+		Grep:              *p.grep,
+		GrepInvert:        *p.grepInvert,
+		SkipOutput:        append(p.skipOutput, partPattern(clap.DefaultOutput), clap.DefaultOutput+".[0-9]"),
+		NoGitignore:       *p.noGitignore,
+		NoClapignore:      *p.noClapignore,
+		NoDefaultExcludes: *p.noDefaultExcludes,
+		NoTests:           *p.noTests,
+		NoGenerated:       *p.noGenerated,
+		Hidden:            *p.hidden,
+		Header:            *p.header,
+		Footer:            *p.footer,
+		Format:            *p.format,
+		ChunkTokens:       *p.chunkTokens,
+		ChunkOverlap:      *p.chunkOverlap,
+		Languages:         langs,
+		HeaderMeta:        p.headerMeta,
+		Framing:           *p.framing,
+		Tokenizer:         *p.tokenizer,
+		IncludeBinary:     *p.includeBinary,
+		KeepEmpty:         !*p.skipEmpty,
+		KeepEncoding:      *p.encoding == "keep",
+		MaxDepth:          *p.maxDepth,
+		MaxSize:           maxSize,
+		TruncateLines:     *p.truncateLines,
+		TruncateBytes:     truncateBytes,
+		TruncateTail:      *p.truncateTail,
+		FitTokens:         *p.fitTokens,
+		FitPriority:       p.fitPriority,
+		StripComments:     *p.stripComments,
+		Signatures:        *p.signatures,
+		Redact:            *p.redact,
+		Sanitize:          *p.sanitize,
+		SanitizeEscape:    *p.sanitizeEscape,
+		Anonymize:         p.anon,
+		NormalizeEOL:      *p.normalizeEOL,
+		TrimTrailingSpace: *p.trimTrailingSpace,
+		TabsToSpaces:      *p.tabsToSpaces,
+		LineNumbers:       *p.lineNumbers,
+		NoDedupe:          *p.noDedupe,
+		SplitBytes:        splitBytes,
+		SplitTokens:       splitTokens,
+		Tree:              *p.tree,
+		Reproducible:      *p.reproducible,
+		Sort:              sort,
+		GoPackageHeaders:  *p.goPackages,
+		Reverse:           *p.reverse,
+		Weights:           weights,
+		First:             p.first,
+		Last:              p.last,
+		FollowSymlinks:    *p.followSymlinks,
+		Jobs:              jobs,
+		WalkJobs:          walkJobs,
+		ReadRate:          readRate,
+		FailOnError:       *p.errors == "fail",
+	}
+	if *p.frontMatter {
+		opts.FrontMatter = p.frontMatterFields(time.Now())
+	}
+	if isOutputTemplate(*p.output) {
+		opts.SkipOutput = append(opts.SkipOutput, outputGlob(*p.output), partPattern(outputGlob(*p.output)))
+	}
+	if *p.backup {
+		opts.SkipOutput = append(opts.SkipOutput, "/"+filepath.ToSlash(p.withOutputExt(outputGlob(*p.output)))+".[0-9]")
+	}
+	if p.encodes() {
+		glob := p.withOutputExt(outputGlob(*p.output))
+		opts.SkipOutput = append(opts.SkipOutput, glob, partPattern(glob))
+	}
+	if *p.perDir > 0 {
+		glob := p.withOutputExt(perDirOutput(outputGlob(*p.output), "*"))
+		opts.SkipOutput = append(opts.SkipOutput, glob, partPattern(glob))
+	}
+	for _, spec := range p.also {
+		glob := p.withOutputExt(outputGlob(spec.name))
+		if *p.perDir > 0 {
+			glob = perDirOutput(glob, "*")
+		}
+		opts.SkipOutput = append(opts.SkipOutput, glob)
+	}
+	if *p.manifest != "" && filepath.Base(*p.manifest) == *p.manifest {
+		opts.SkipOutput = append(opts.SkipOutput, "/"+*p.manifest)
+	}
+	if !*p.noGitignore {
+		opts.GlobalExcludes = clap.GlobalExcludesFile()
+	}
+	// clap's own working files are never bundled.
+	opts.Exclude = append(opts.Exclude[:len(opts.Exclude):len(opts.Exclude)], "/"+cacheFile, "/"+anonymizeKeyFile, outputTemp+"*")
+	if rel, err := filepath.Rel(p.path, p.anonymizeKeyPath()); *p.anonymizeKey != "" && err == nil && filepath.IsLocal(rel) {
+		opts.Exclude = append(opts.Exclude, "/"+filepath.ToSlash(rel))
+	}
+	return opts, nil
+}
+
+// writeFormats writes the bundle to path and to each repeated -o file,
+// in its format, from one pass over sources. selected is the --per-dir
+// check of write; it is read once the run is done.
+func (p *packer) writeFormats(ctx context.Context, opts clap.Options, sources []clap.Source, path string, selected *int) (string, error) {
+	paths := []string{path}
+	formats := []string{*p.format}
+	for i, spec := range p.also {
+		paths = append(paths, p.filePath(p.alsoNames[i]))
+		formats = append(formats, cmp.Or(spec.format, *p.format))
+	}
+
+	var outs []*output
+	defer func() {
+		for _, out := range outs {
+			out.Abort()
+		}
+	}()
+	targets := make([]clap.FormatOutput, len(paths))
+	for i, path := range paths {
+		if slices.Contains(paths[:i], path) {
+			return "", fmt.Errorf("-o names %s more than once", path)
+		}
+		if err := p.checkClobber(path); err != nil {
+			return "", err
+		}
+		out, err := openFileOutput(path, *p.backup)
+		if err == nil && p.encodes() {
+			err = p.encodeOutput(out)
+		}
+		if err != nil {
+			return "", err
+		}
+		outs = append(outs, out)
+		targets[i] = clap.FormatOutput{Format: formats[i], W: out.w}
+	}
+	opts.Output = outs[0].info
+
+	bundler, err := clap.New(opts)
+	if err != nil {
+		return "", err
+	}
+	if err := bundler.RunFormats(ctx, sources, targets); err != nil {
+		return "", fmt.Errorf("bundling %s: %v", strings.Join(p.paths, ", "), err)
+	}
+	if *selected == 0 {
+		return "", errEmptyDir
+	}
+	for i, out := range outs {
+		if err := out.Close(); err != nil {
+			return "", fmt.Errorf("writing %s: %v", out.name, err)
+		}
+		p.wrote(paths[i])
+	}
+	return strings.Join(paths, ", "), nil
+}
+
+// writeManifest writes index to --manifest, placed like -o.
+func (p *packer) writeManifest(index *manifest) error {
+	path := p.resolveOutput(*p.manifest)
+	if p.dirName != "" {
+		path = perDirOutput(path, p.dirName)
+	}
+	if err := index.write(path); err != nil {
+		return fmt.Errorf("writing %s: %v", path, err)
+	}
+	return nil
+}
+
+// displayRoot returns what paths from the local tree at path start with,
+// following --path-style.
+func (p *packer) displayRoot(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	style := *p.pathStyle
+	if *p.reproducible && style == "" && filepath.IsAbs(path) {
+		style = "relative"
+	}
+	switch style {
+	case "relative":
+		if len(p.paths) == 1 {
+			return ""
+		}
+		// Several trees need telling apart.
+		return filepath.Base(abs)
+	case "absolute":
+		return abs
+	case "basename":
+		return filepath.Base(abs)
+	}
+	return path
+}
+
+// sources returns the trees to bundle, one per path, restricted by the git
+// and file list flags. Call the returned function once done with them.
+func (p *packer) sources(ctx context.Context) ([]clap.Source, func(), error) {
+	var closers []io.Closer
+	closeAll := func() {
+		for _, c := range closers {
+			c.Close()
+		}
+	}
+
+	var err error
+	var roots []string // with --files-manifest, the directories bundled
+	sources := make([]clap.Source, len(p.paths))
+	for i, path := range p.paths {
+		root := p.displayRoot(path)
+		if clap.IsGitURL(path) {
+			if path, err = p.clone(ctx, path); err != nil {
+				return nil, closeAll, err
+			}
+			root = ""
+			if len(p.paths) > 1 {
+				root = repoName(p.paths[i])
+			}
+		}
+		sources[i] = clap.Source{Root: root, FS: os.DirFS(path)}
+		if isArchivePath(path) {
+			if p.gitDiff.set || *p.gitTracked {
+				return nil, closeAll, fmt.Errorf("%s is an archive, not a git checkout", path)
+			}
+			fsys, closer, err := clap.OpenArchive(path)
+			if err != nil {
+				return nil, closeAll, fmt.Errorf("opening %s: %v", path, err)
+			}
+			closers = append(closers, closer)
+			sources[i].FS = fsys
+		}
+		switch {
+		case p.gitDiff.set:
+			if sources[i].Only, err = clap.GitChangedFiles(path, p.gitDiff.value); err != nil {
+				return nil, closeAll, fmt.Errorf("listing changed files in %s: %v", path, err)
+			}
+		case *p.gitTracked:
+			if sources[i].Only, err = clap.GitTrackedFiles(path); err != nil {
+				return nil, closeAll, fmt.Errorf("listing tracked files in %s: %v", path, err)
+			}
+		}
+		if p.fileList != nil {
+			listed := filesUnder(path, p.fileList)
+			if sources[i].Only != nil {
+				listed = intersect(sources[i].Only, listed)
+			}
+			sources[i].Only = listed
+		}
+		if (p.gitDiff.set || *p.gitTracked) && sources[i].Only == nil {
+			sources[i].Only = []string{}
+		}
+		if p.selection != nil {
+			sources[i].Files = filesUnder(path, p.selection)
+			roots = append(roots, path)
+		}
+	}
+	if file := outsideAll(roots, p.selection); file != "" {
+		return nil, closeAll, fmt.Errorf("--files-manifest: %s is outside %s", file, strings.Join(p.paths, ", "))
+	}
+	return sources, closeAll, nil
+}
+
+// clone makes a shallow clone of the repository at url, once per run of
+// the command, and returns its directory.
+func (p *packer) clone(ctx context.Context, url string) (string, error) {
+	if dir, ok := p.clones[url]; ok {
+		return dir, nil
+	}
+	dir, err := os.MkdirTemp("", "clap-clone-")
+	if err != nil {
+		return "", err
+	}
+	if p.clones == nil {
+		p.clones = map[string]string{}
+	}
+	p.clones[url] = dir
+	logf("Cloning %s\n", url)
+	if err := clap.GitClone(ctx, url, *p.ref, dir); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// close removes the clones of remote repositories.
+func (p *packer) close() {
+	for _, dir := range p.clones {
+		os.RemoveAll(dir)
+	}
+	p.clones = nil
+}
+
+// repoName is the name of the repository at a git URL, e.g. "clap" for
+// https://github.com/alvivar/clap.git.
+func repoName(url string) string {
+	url = strings.TrimSuffix(strings.TrimRight(url, "/"), ".git")
+	return url[strings.LastIndexAny(url, "/:")+1:]
+}
+
+// loadCache loads the token cache from the first path, once.
+func (p *packer) loadCache() error {
+	if p.cache != nil {
+		return nil
+	}
+	cache, err := clap.LoadCache(filepath.Join(p.path, cacheFile))
+	if err != nil {
+		return fmt.Errorf("reading cache: %v", err)
+	}
+	p.cache = cache
+	return nil
+}
+
+// anonymizeKeyPath returns the --anonymize key file's path.
+func (p *packer) anonymizeKeyPath() string {
+	if *p.anonymizeKey != "" {
+		return *p.anonymizeKey
+	}
+	return filepath.Join(p.path, anonymizeKeyFile)
+}
+
+// loadAnonymizer loads the --anonymize key file, once.
+func (p *packer) loadAnonymizer() error {
+	if p.anon != nil {
+		return nil
+	}
+	anon, err := clap.LoadAnonymizer(p.anonymizeKeyPath(), p.anonymizeIdent)
+	if err != nil {
+		return err
+	}
+	p.anon = anon
+	return nil
+}
+
+// list reports the files a bundle of sources would include, for
+// --dry-run.
+func (p *packer) list(ctx context.Context, opts clap.Options, sources []clap.Source) error {
+	if output := p.outputPath(); output != "" {
+		opts.Output, _ = os.Stat(output)
+	}
+	bundler, err := clap.New(opts)
+	if err != nil {
+		return err
+	}
+	if err := bundler.List(ctx, sources); err != nil {
+		return fmt.Errorf("listing %s: %v", strings.Join(p.paths, ", "), err)
+	}
+	return nil
+}
+
+// write bundles sources to the selected output, or to numbered parts with
+// --split, and returns a description of where the bundle went.
+func (p *packer) write(ctx context.Context, opts clap.Options, sources []clap.Source) (string, error) {
+	output := p.outputPath()
+	selected := -1
+	if p.dirName != "" {
+		// A directory with nothing to bundle gets no bundle.
+		next := opts.Selected
+		opts.Selected = func(files int) {
+			selected = files
+			if next != nil {
+				next(files)
+			}
+		}
+	}
+	var index *manifest
+	if *p.manifest != "" {
+		index = &manifest{}
+		opts.Placed = index.add
+	}
+	if len(p.also) > 0 {
+		return p.writeFormats(ctx, opts, sources, output, &selected)
+	}
+	if opts.SplitBytes == 0 && opts.SplitTokens == 0 {
+		if output != "" {
+			if err := p.checkClobber(output); err != nil {
+				return "", err
+			}
+		}
+		out, err := p.openOutput()
+		if err != nil {
+			return "", err
+		}
+		defer out.Abort()
+		opts.Output = out.info
+
+		bundler, err := clap.New(opts)
+		if err != nil {
+			return "", err
+		}
+		if err := bundler.RunSources(ctx, sources, out.w); err != nil {
+			return "", fmt.Errorf("bundling %s: %v", strings.Join(p.paths, ", "), err)
+		}
+		if selected == 0 {
+			return "", errEmptyDir
+		}
+		if err := out.Close(); err != nil {
+			return "", fmt.Errorf("writing %s: %v", out.name, err)
+		}
+		if output != "" {
+			p.wrote(output)
+		}
+		if index != nil {
+			index.finish(output, nil, nil)
+			if err := p.writeManifest(index); err != nil {
+				return "", err
+			}
+		}
+		return out.name, nil
+	}
+
+	if *p.backup {
+		return "", fmt.Errorf("--backup doesn't work with --split")
+	}
+	if err := p.checkClobber(partPath(output, 1)); err != nil {
+		return "", err
+	}
+	opts.SkipOutput = append(opts.SkipOutput, partPattern(output), partTemp+"*")
+	bundler, err := clap.New(opts)
+	if err != nil {
+		return "", err
+	}
+
+	recipients, err := parseRecipients(p.encrypt)
+	if err != nil {
+		return "", err
+	}
+	parts := &parts{output: output, compress: *p.compress, recipients: recipients}
+	defer parts.cleanup()
+	if err := bundler.RunParts(ctx, sources, parts.next); err != nil {
+		return "", fmt.Errorf("bundling %s: %v", strings.Join(p.paths, ", "), err)
+	}
+	if selected == 0 {
+		return "", errEmptyDir
+	}
+	names, err := parts.commit(bundler.PartHeader)
+	if err != nil {
+		return "", err
+	}
+	if err := parts.cleanup(); err != nil {
+		return "", err
+	}
+	p.wrote(partPath(output, 1))
+	if index != nil {
+		headers := make([]string, len(names))
+		for i := range names {
+			headers[i] = bundler.PartHeader(i+1, len(names))
+		}
+		index.finish("", names, headers)
+		if err := p.writeManifest(index); err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("%d parts, %s", len(names), strings.Join(names, ", ")), nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"clap/pkg/clap"
+)
+
+// errEmptyDir stops a --per-dir bundle that would have no files, so no
+// file is written for it.
+var errEmptyDir = errors.New("nothing to bundle")
+
+// runAll builds the bundle, or with --per-dir one bundle per directory at
+// that depth below the path, each named after its directory.
+func (p *packer) runAll(ctx context.Context) error {
+	if *p.perDir == 0 {
+		return p.run(ctx)
+	}
+	dirs, err := p.perDirs()
+	if err != nil {
+		return err
+	}
+	if len(dirs) == 0 {
+		return fmt.Errorf("--per-dir: no directories %d levels below %s", *p.perDir, p.path)
+	}
+
+	paths := p.paths
+	defer func() { p.paths, p.dirName = paths, "" }()
+	for _, dir := range dirs {
+		p.paths = []string{filepath.Join(p.path, dir)}
+		p.dirName = pathSafe(filepath.ToSlash(dir))
+		if err := p.run(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// perDirs returns the directories --per-dir levels below the path,
+// relative to it and sorted, leaving out those the walk would skip by
+// name: hidden ones and DefaultExcludes, unless the flags include them.
+func (p *packer) perDirs() ([]string, error) {
+	if *p.perDir < 0 {
+		return nil, fmt.Errorf("--per-dir: want a depth of 1 or more")
+	}
+	if len(p.paths) != 1 || clap.IsGitURL(p.paths[0]) || isArchivePath(p.paths[0]) {
+		return nil, fmt.Errorf("--per-dir needs a single directory to split")
+	}
+	if *p.toStdout || *p.clipboard {
+		return nil, fmt.Errorf("--per-dir writes several bundles, so it can't go to stdout or the clipboard")
+	}
+
+	dirs := []string{"."}
+	for range *p.perDir {
+		var next []string
+		for _, dir := range dirs {
+			entries, err := os.ReadDir(filepath.Join(p.path, dir))
+			if err != nil {
+				return nil, err
+			}
+			for _, entry := range entries {
+				name := entry.Name()
+				if !entry.IsDir() || strings.HasPrefix(name, ".") && !*p.hidden || slices.Contains(clap.DefaultExcludes, name) && !*p.noDefaultExcludes {
+					continue
+				}
+				next = append(next, filepath.Join(dir, name))
+			}
+		}
+		dirs = next
+	}
+	slices.Sort(dirs)
+	return dirs, nil
+}
+
+// perDirOutput adds dir to the name of an output file, before its
+// extension: clap.md for services/auth becomes clap-services-auth.md.
+func perDirOutput(name, dir string) string {
+	base := filepath.Base(name)
+	stem, ext := base, ""
+	if i := strings.Index(base[1:], "."); i >= 0 {
+		stem, ext = base[:i+1], base[i+1:]
+	}
+	return filepath.Join(filepath.Dir(name), stem+"-"+dir+ext)
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+
+	"clap/pkg/clap"
+)
+
+// setupPick implements "clap pick": it shows the files a bundle would
+// include in a terminal picker and bundles the ones chosen, with the usual
+// bundling flags.
+func setupPick(fs *flag.FlagSet) func(args []string) error {
+	p := newPacker(fs)
+	return func(args []string) error {
+		if err := p.parse(args); err != nil {
+			return err
+		}
+		if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stderr.Fd())) {
+			return fmt.Errorf("clap pick needs a terminal")
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		defer p.close()
+
+		files, err := p.candidates(ctx)
+		if err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			return fmt.Errorf("no files to pick from in %s", strings.Join(p.paths, ", "))
+		}
+		chosen, err := pickFiles(files)
+		if err != nil {
+			return err
+		}
+		if chosen == nil {
+			logf("Nothing picked\n")
+			return nil
+		}
+		p.fileList = chosen
+		return p.run(ctx)
+	}
+}
+
+// pickFile is a file offered by the picker.
+type pickFile struct {
+	path   string
+	size   int64
+	tokens int
+}
+
+// candidates reads every file the flags select and returns them with their
+// sizes and token counts, as they would be bundled.
+func (p *packer) candidates(ctx context.Context) ([]pickFile, error) {
+	opts, err := p.options()
+	if err != nil {
+		return nil, err
+	}
+	opts.Format, opts.Header, opts.Footer, opts.Tree = "", "", "", false
+	opts.FrontMatter = nil
+	opts.SplitBytes, opts.SplitTokens = 0, 0
+	opts.NoDedupe = true
+	if output := p.outputPath(); output != "" {
+		opts.Output, _ = os.Stat(output)
+	}
+	if *p.useCache {
+		if err := p.loadCache(); err != nil {
+			return nil, err
+		}
+		opts.Cache = p.cache
+	}
+
+	var files []pickFile
+	opts.Report = func(e clap.Event) {
+		if e.Err == nil && e.Skipped == "" {
+			files = append(files, pickFile{path: e.Path, size: e.Size, tokens: e.Tokens})
+		}
+	}
+
+	sources, closeSources, err := p.sources(ctx)
+	defer closeSources()
+	if err != nil {
+		return nil, err
+	}
+	bundler, err := clap.New(opts)
+	if err != nil {
+		return nil, err
+	}
+	logf("Scanning %s\n", strings.Join(p.paths, ", "))
+	if err := bundler.RunSources(ctx, sources, io.Discard); err != nil {
+		return nil, fmt.Errorf("scanning %s: %v", strings.Join(p.paths, ", "), err)
+	}
+	return files, nil
+}
+
+// pickFiles runs the picker on the terminal and returns the chosen paths,
+// or nil if the user cancelled or chose nothing.
+func pickFiles(files []pickFile) ([]string, error) {
+	state, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return nil, err
+	}
+	defer term.Restore(int(os.Stdin.Fd()), state)
+
+	// The alternate screen leaves the scrollback as it was.
+	fmt.Fprint(os.Stderr, "\x1b[?1049h\x1b[?25l")
+	defer fmt.Fprint(os.Stderr, "\x1b[?25h\x1b[?1049l")
+
+	pk := newPicker(files)
+	buf := make([]byte, 64)
+	for {
+		width, height, err := term.GetSize(int(os.Stderr.Fd()))
+		if err != nil {
+			width, height = 80, 24
+		}
+		io.WriteString(os.Stderr, pk.render(width, height))
+
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		done, ok := pk.key(string(buf[:n]), height)
+		if done && !ok {
+			return nil, nil
+		}
+		if done {
+			return pk.chosen(), nil
+		}
+	}
+}
+
+// picker is the state of the file picker. With no filter the files are
+// shown as a tree whose directory rows toggle everything below them; a
+// filter shows the matching files as a flat list.
+type picker struct {
+	files    []pickFile
+	selected []bool
+	filter   string
+	rows     []pickRow
+	cursor   int
+	top      int // first row on screen
+}
+
+// pickRow is one line of the picker.
+type pickRow struct {
+	label string
+	files []int // indexes into picker.files: the file itself, or every file below a directory
+	dir   bool
+}
+
+// pickerChrome is how many lines the header and footer take.
+const pickerChrome = 4
+
+func newPicker(files []pickFile) *picker {
+	// Ordering by path segments keeps each directory's files together, the
+	// way the walk yields them.
+	files = slices.Clone(files)
+	slices.SortStableFunc(files, func(a, b pickFile) int {
+		return strings.Compare(strings.ReplaceAll(a.path, "/", "\x00"), strings.ReplaceAll(b.path, "/", "\x00"))
+	})
+	pk := &picker{files: files, selected: make([]bool, len(files))}
+	pk.layout()
+	return pk
+}
+
+// layout rebuilds the rows for the current filter.
+func (pk *picker) layout() {
+	pk.rows = pk.rows[:0]
+	if pk.filter != "" {
+		for i, f := range pk.files {
+			if fuzzyMatch(pk.filter, f.path) {
+				pk.rows = append(pk.rows, pickRow{label: f.path, files: []int{i}})
+			}
+		}
+	} else {
+		dirs := map[string]int{} // directory path to its row
+		for i, f := range pk.files {
+			parts := strings.Split(f.path, "/")
+			for depth := range len(parts) - 1 {
+				dir := strings.Join(parts[:depth+1], "/")
+				row, ok := dirs[dir]
+				if !ok {
+					row = len(pk.rows)
+					dirs[dir] = row
+					pk.rows = append(pk.rows, pickRow{label: strings.Repeat("  ", depth) + parts[depth] + "/", dir: true})
+				}
+				pk.rows[row].files = append(pk.rows[row].files, i)
+			}
+			label := strings.Repeat("  ", len(parts)-1) + parts[len(parts)-1]
+			pk.rows = append(pk.rows, pickRow{label: label, files: []int{i}})
+		}
+	}
+	pk.cursor = min(pk.cursor, max(len(pk.rows)-1, 0))
+}
+
+// key handles one read from the terminal. It reports whether the picker
+// is done and, if so, whether the selection was confirmed.
+func (pk *picker) key(k string, height int) (done, ok bool) {
+	page := max(height-pickerChrome, 1)
+	switch k {
+	case "\r", "\n":
+		return true, true
+	case "\x03", "\x1b": // Ctrl-C, Esc
+		return true, false
+	case "\x1b[A", "\x1bOA", "\x10": // up, Ctrl-P
+		pk.cursor = max(pk.cursor-1, 0)
+	case "\x1b[B", "\x1bOB", "\x0e": // down, Ctrl-N
+		pk.cursor = min(pk.cursor+1, max(len(pk.rows)-1, 0))
+	case "\x1b[5~": // page up
+		pk.cursor = max(pk.cursor-page, 0)
+	case "\x1b[6~": // page down
+		pk.cursor = min(pk.cursor+page, max(len(pk.rows)-1, 0))
+	case " ":
+		if pk.cursor < len(pk.rows) {
+			pk.toggle(pk.rows[pk.cursor].files)
+		}
+	case "\x01": // Ctrl-A: every visible file
+		var all []int
+		for _, row := range pk.rows {
+			if !row.dir {
+				all = append(all, row.files...)
+			}
+		}
+		pk.toggle(all)
+	case "\x7f", "\b":
+		if pk.filter != "" {
+			_, size := utf8.DecodeLastRuneInString(pk.filter)
+			pk.filter = pk.filter[:len(pk.filter)-size]
+			pk.layout()
+		}
+	case "\x15": // Ctrl-U
+		pk.filter = ""
+		pk.layout()
+	default:
+		if !strings.HasPrefix(k, "\x1b") && strings.IndexFunc(k, unicode.IsControl) < 0 {
+			pk.filter += k
+			pk.cursor = 0
+			pk.layout()
+		}
+	}
+	return false, false
+}
+
+// toggle selects every file in files, or clears them all if they already
+// are.
+func (pk *picker) toggle(files []int) {
+	all := true
+	for _, i := range files {
+		all = all && pk.selected[i]
+	}
+	for _, i := range files {
+		pk.selected[i] = !all
+	}
+}
+
+// chosen returns the selected paths, or nil if there are none.
+func (pk *picker) chosen() []string {
+	var paths []string
+	for i, f := range pk.files {
+		if pk.selected[i] {
+			paths = append(paths, f.path)
+		}
+	}
+	return paths
+}
+
+// render draws the whole screen.
+func (pk *picker) render(width, height int) string {
+	var sb strings.Builder
+	sb.WriteString("\x1b[H\x1b[2J")
+	line := func(s string) {
+		sb.WriteString(truncate(s, width))
+		sb.WriteString("\x1b[K\r\n")
+	}
+
+	var files, tokens int
+	var size int64
+	for i, f := range pk.files {
+		if pk.selected[i] {
+			files++
+			size += f.size
+			tokens += f.tokens
+		}
+	}
+	line(fmt.Sprintf("👏 %d of %d files, %s, %d tokens", files, len(pk.files), clap.FormatSize(size), tokens))
+	line("Filter: " + pk.filter + "▏")
+
+	visible := max(height-pickerChrome, 1)
+	if pk.cursor < pk.top {
+		pk.top = pk.cursor
+	}
+	if pk.cursor >= pk.top+visible {
+		pk.top = pk.cursor - visible + 1
+	}
+	for i := pk.top; i < min(pk.top+visible, len(pk.rows)); i++ {
+		row := pk.rows[i]
+		marker := "  "
+		if i == pk.cursor {
+			marker = "> "
+		}
+		var rowSize int64
+		var rowTokens, picked int
+		for _, f := range row.files {
+			rowSize += pk.files[f].size
+			rowTokens += pk.files[f].tokens
+			if pk.selected[f] {
+				picked++
+			}
+		}
+		box := "[ ]"
+		switch {
+		case picked == len(row.files):
+			box = "[x]"
+		case picked > 0:
+			box = "[-]"
+		}
+		stats := fmt.Sprintf("%8s %8d tokens", clap.FormatSize(rowSize), rowTokens)
+		label := truncate(marker+box+" "+row.label, max(width-len(stats)-1, 1))
+		pad := max(width-utf8.RuneCountInString(label)-len(stats), 1)
+		line(label + strings.Repeat(" ", pad) + stats)
+	}
+	for i := len(pk.rows) - pk.top; i < visible; i++ {
+		line("")
+	}
+
+	sb.WriteString(truncate("space toggle · ctrl-a all · type to filter · enter bundle · esc cancel", width))
+	sb.WriteString("\x1b[K")
+	return sb.String()
+}
+
+// truncate cuts s to at most width runes.
+func truncate(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:max(width-1, 0)]) + "…"
+}
+
+// fuzzyMatch reports whether the characters of pattern appear in s in
+// order, ignoring case.
+func fuzzyMatch(pattern, s string) bool {
+	s = strings.ToLower(s)
+	for _, r := range strings.ToLower(pattern) {
+		i := strings.IndexRune(s, r)
+		if i < 0 {
+			return false
+		}
+		s = s[i+utf8.RuneLen(r):]
+	}
+	return true
+}
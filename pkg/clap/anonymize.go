@@ -0,0 +1,202 @@
+package clap
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Pseudonym prefixes: path components become "n" and eight or more hex
+// digits, identifiers "id" and the same.
+const (
+	namePrefix  = "n"
+	identPrefix = "id"
+)
+
+// pseudonymPattern matches anything that may be a pseudonym.
+var pseudonymPattern = regexp.MustCompile(`\b(?:` + namePrefix + `|` + identPrefix + `)[0-9a-f]{8,}\b`)
+
+// Anonymizer replaces path components, and content matching identifier
+// patterns, with stable pseudonyms. Each is a keyed hash of the original
+// under a secret kept in the key file, so the same name gets the same
+// pseudonym in every bundle made with that key, and the key file's
+// mapping turns them back with Restore.
+//
+// An Anonymizer is safe for concurrent use. Pass it in Options.Anonymize
+// and call Save after the run.
+type Anonymizer struct {
+	mu     sync.Mutex
+	secret []byte
+	idents []*regexp.Regexp
+	names  map[string]string // pseudonym to original
+	dirty  bool
+}
+
+type anonymizerFile struct {
+	Secret string            `json:"secret"`
+	Names  map[string]string `json:"names"`
+}
+
+// LoadAnonymizer reads the key file at path, or starts a new key if there
+// is none, and compiles identifiers, Go regular expressions whose matches
+// in content are replaced. Unlike a cache, a damaged key file is an error:
+// replacing it would lose the mapping.
+func LoadAnonymizer(path string, identifiers []string) (*Anonymizer, error) {
+	idents, err := compileRegexps("anonymize identifier", identifiers)
+	if err != nil {
+		return nil, err
+	}
+	a := &Anonymizer{idents: idents, names: map[string]string{}}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		a.secret = make([]byte, 32)
+		rand.Read(a.secret)
+		a.dirty = true
+		return a, nil
+	case err != nil:
+		return nil, err
+	}
+	var file anonymizerFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("reading key file %s: %v", path, err)
+	}
+	if a.secret, err = hex.DecodeString(file.Secret); err != nil || len(a.secret) == 0 {
+		return nil, fmt.Errorf("reading key file %s: invalid secret", path)
+	}
+	if file.Names != nil {
+		a.names = file.Names
+	}
+	return a, nil
+}
+
+// Save writes the key and every pseudonym handed out so far to path, if
+// anything changed. The file is private to its owner.
+func (a *Anonymizer) Save(path string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.dirty {
+		return nil
+	}
+	data, err := json.MarshalIndent(anonymizerFile{Secret: hex.EncodeToString(a.secret), Names: a.names}, "", "  ")
+	if err != nil {
+		return err
+	}
+	temp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := temp.Write(append(data, '\n')); err != nil {
+		temp.Close()
+		os.Remove(temp.Name())
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		os.Remove(temp.Name())
+		return err
+	}
+	if err := os.Rename(temp.Name(), path); err != nil {
+		os.Remove(temp.Name())
+		return err
+	}
+	a.dirty = false
+	return nil
+}
+
+// Path replaces each component of path with its pseudonym, keeping the
+// last extension so languages are still recognized. ".", "..", and
+// dotfiles such as .gitignore are kept.
+func (a *Anonymizer) Path(path string) string {
+	parts := strings.FieldsFunc(path, func(r rune) bool { return r == '/' || r == filepath.Separator })
+	if len(parts) == 0 {
+		return path
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i, part := range parts {
+		ext := filepath.Ext(part)
+		stem := strings.TrimSuffix(part, ext)
+		if part == "." || part == ".." || stem == "" {
+			continue
+		}
+		parts[i] = a.pseudonym(namePrefix, stem) + ext
+	}
+	anonymized := strings.Join(parts, string(filepath.Separator))
+	if filepath.IsAbs(path) || strings.HasPrefix(path, "/") {
+		anonymized = string(filepath.Separator) + anonymized
+	}
+	return anonymized
+}
+
+// Content replaces every match of the identifier patterns in content.
+func (a *Anonymizer) Content(content []byte) []byte {
+	if len(a.idents) == 0 {
+		return content
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, re := range a.idents {
+		content = re.ReplaceAllFunc(content, func(match []byte) []byte {
+			return []byte(a.pseudonym(identPrefix, string(match)))
+		})
+	}
+	return content
+}
+
+// Restore turns the pseudonyms in text back into what they stand for.
+// Unknown ones are left as they are.
+func (a *Anonymizer) Restore(text []byte) []byte {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return pseudonymPattern.ReplaceAllFunc(text, func(p []byte) []byte {
+		if original, ok := a.names[string(p)]; ok {
+			return []byte(original)
+		}
+		return p
+	})
+}
+
+// salt describes the settings that change anonymized content, for cache
+// keys.
+func (a *Anonymizer) salt() string {
+	if a == nil {
+		return ""
+	}
+	var patterns []string
+	for _, re := range a.idents {
+		patterns = append(patterns, re.String())
+	}
+	sum := sha256.Sum256(a.secret)
+	return hex.EncodeToString(sum[:4]) + "," + strings.Join(patterns, "\x00")
+}
+
+// pseudonym returns the pseudonym of s, recording it. A hash prefix that
+// already stands for something else is lengthened. Callers hold a.mu.
+func (a *Anonymizer) pseudonym(prefix, s string) string {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(prefix + "\x00" + s))
+	sum := hex.EncodeToString(mac.Sum(nil))
+	for n := 8; ; n += 2 {
+		p := prefix + sum[:min(n, len(sum))]
+		original, ok := a.names[p]
+		if !ok {
+			a.names[p] = s
+			a.dirty = true
+			return p
+		}
+		if original == s || n >= len(sum) {
+			return p
+		}
+	}
+}
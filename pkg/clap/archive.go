@@ -0,0 +1,188 @@
+package clap
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// IsArchive reports whether name looks like an archive OpenArchive can
+// read, judging by its extension.
+func IsArchive(name string) bool {
+	name = strings.ToLower(name)
+	for _, ext := range []string{".zip", ".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// OpenArchive opens a zip, tar, or gzip-compressed tar file as an fs.FS, so
+// it can be bundled like a directory. Call Close when done. Tar archives
+// are read into memory, since they can't be read at random.
+func OpenArchive(name string) (fs.FS, io.Closer, error) {
+	if strings.HasSuffix(strings.ToLower(name), ".zip") {
+		r, err := zip.OpenReader(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		return r, r, nil
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if !strings.HasSuffix(strings.ToLower(name), ".tar") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	fsys, err := readTar(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	return fsys, fsys, nil
+}
+
+// tarFS is an in-memory tree of the regular files in a tar archive.
+// Directories are implied by the paths of the files they contain.
+type tarFS map[string]*tarNode
+
+type tarNode struct {
+	name    string // base name
+	mode    fs.FileMode
+	modTime time.Time
+	data    []byte
+	entries []string // sorted child names, for directories
+}
+
+// readTar loads every regular file from r. Links and special files are
+// left out.
+func readTar(r io.Reader) (tarFS, error) {
+	fsys := tarFS{".": {name: ".", mode: fs.ModeDir | 0o755}}
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := path.Clean(strings.TrimPrefix(header.Name, "/"))
+		if !fs.ValidPath(name) || name == "." {
+			continue
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			fsys.dir(name).modTime = header.ModTime
+		case tar.TypeReg:
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, err
+			}
+			fsys.dir(path.Dir(name)).add(path.Base(name))
+			fsys[name] = &tarNode{
+				name:    path.Base(name),
+				mode:    fs.FileMode(header.Mode).Perm(),
+				modTime: header.ModTime,
+				data:    data,
+			}
+		}
+	}
+	for _, node := range fsys {
+		slices.Sort(node.entries)
+	}
+	return fsys, nil
+}
+
+// dir returns the directory node for name, creating it and its parents.
+func (fsys tarFS) dir(name string) *tarNode {
+	if node, ok := fsys[name]; ok {
+		return node
+	}
+	node := &tarNode{name: path.Base(name), mode: fs.ModeDir | 0o755}
+	fsys[name] = node
+	fsys.dir(path.Dir(name)).add(node.name)
+	return node
+}
+
+// add records a child name, once.
+func (n *tarNode) add(child string) {
+	if !slices.Contains(n.entries, child) {
+		n.entries = append(n.entries, child)
+	}
+}
+
+// Close does nothing; the archive is already in memory.
+func (fsys tarFS) Close() error { return nil }
+
+func (fsys tarFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	node, ok := fsys[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &tarFile{fsys: fsys, path: name, node: node, Reader: bytes.NewReader(node.data)}, nil
+}
+
+// tarFile is an open tarNode.
+type tarFile struct {
+	*bytes.Reader
+	fsys tarFS
+	path string
+	node *tarNode
+	read int // directory entries already returned by ReadDir
+}
+
+func (f *tarFile) Stat() (fs.FileInfo, error) { return tarInfo{f.node}, nil }
+func (f *tarFile) Close() error               { return nil }
+
+func (f *tarFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !f.node.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: f.path, Err: errors.New("not a directory")}
+	}
+	names := f.node.entries[f.read:]
+	if n > 0 && len(names) > n {
+		names = names[:n]
+	}
+	if n > 0 && len(names) == 0 {
+		return nil, io.EOF
+	}
+	entries := make([]fs.DirEntry, len(names))
+	for i, name := range names {
+		entries[i] = fs.FileInfoToDirEntry(tarInfo{f.fsys[path.Join(f.path, name)]})
+	}
+	f.read += len(names)
+	return entries, nil
+}
+
+// tarInfo adapts a tarNode to fs.FileInfo.
+type tarInfo struct{ node *tarNode }
+
+func (i tarInfo) Name() string       { return i.node.name }
+func (i tarInfo) Size() int64        { return int64(len(i.node.data)) }
+func (i tarInfo) Mode() fs.FileMode  { return i.node.mode }
+func (i tarInfo) ModTime() time.Time { return i.node.modTime }
+func (i tarInfo) IsDir() bool        { return i.node.mode.IsDir() }
+func (i tarInfo) Sys() any           { return nil }
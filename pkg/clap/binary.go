@@ -0,0 +1,34 @@
+package clap
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+)
+
+// sniffSize is how much of a file is inspected for NUL bytes.
+const sniffSize = 8 * 1024
+
+// binaryExtensions lists extensions that are always treated as binary,
+// even when their first bytes happen to look like text.
+var binaryExtensions = map[string]bool{
+	".7z": true, ".a": true, ".avi": true, ".bin": true, ".bmp": true,
+	".class": true, ".dat": true, ".db": true, ".dll": true, ".dylib": true,
+	".eot": true, ".exe": true, ".flac": true, ".gif": true, ".gz": true,
+	".ico": true, ".jar": true, ".jpeg": true, ".jpg": true, ".lib": true,
+	".mkv": true, ".mov": true, ".mp3": true, ".mp4": true, ".o": true,
+	".obj": true, ".ogg": true, ".otf": true, ".pdf": true, ".png": true,
+	".pyc": true, ".rar": true, ".rlib": true, ".so": true, ".sqlite": true,
+	".tar": true, ".tgz": true, ".ttf": true, ".wasm": true, ".wav": true,
+	".webm": true, ".webp": true, ".woff": true, ".woff2": true, ".xz": true,
+	".zip": true, ".zst": true,
+}
+
+// isBinary reports whether the file at path looks binary, either by its
+// extension or by a NUL byte in head, its first sniffSize bytes.
+func isBinary(path string, head []byte) bool {
+	if binaryExtensions[strings.ToLower(filepath.Ext(path))] {
+		return true
+	}
+	return bytes.IndexByte(head, 0) >= 0
+}
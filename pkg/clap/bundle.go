@@ -0,0 +1,208 @@
+package clap
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Plain bundles frame each file as "=== path ===\n", the content, then a
+// blank line. Content lines that start with "=== " (after any number of
+// backslashes) get one extra leading backslash when written and lose it
+// when read, so file content can never be mistaken for a header.
+const (
+	headerPrefix = "=== "
+	headerSuffix = " ==="
+)
+
+// Values for Options.Framing.
+const (
+	// FramingEscape is the layout above. Lines are the unit, so a file's
+	// trailing blank lines and a path with a newline in it don't survive.
+	FramingEscape = "escape"
+
+	// FramingSafe follows each header with a meta line giving the content
+	// length in bytes, then the content unescaped, so any bytes at all,
+	// NULs and header-like lines included, come back exactly. Paths with
+	// newlines or a leading quote are written as Go string literals.
+	FramingSafe = "safe"
+)
+
+// quoteHeaderPath quotes path for a FramingSafe header if it could break
+// the line or be mistaken for a quoted path.
+func quoteHeaderPath(path string) string {
+	if strings.ContainsAny(path, "\r\n") || strings.HasPrefix(path, `"`) {
+		return strconv.Quote(path)
+	}
+	return path
+}
+
+// needsEscape reports whether a content line must be escaped.
+func needsEscape(line []byte) bool {
+	return bytes.HasPrefix(bytes.TrimLeft(line, `\`), []byte(headerPrefix))
+}
+
+// copyEscaped streams r to w, escaping header-like lines.
+func copyEscaped(w io.Writer, r io.Reader) error {
+	br := bufio.NewReaderSize(r, 64*1024)
+	atLineStart := true
+	for {
+		chunk, err := br.ReadSlice('\n')
+		if err != nil && err != bufio.ErrBufferFull && err != io.EOF {
+			return err
+		}
+
+		if atLineStart && needsEscape(chunk) {
+			if _, werr := io.WriteString(w, `\`); werr != nil {
+				return werr
+			}
+		}
+		if _, werr := w.Write(chunk); werr != nil {
+			return werr
+		}
+		atLineStart = len(chunk) > 0 && chunk[len(chunk)-1] == '\n'
+
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// parseHeader returns the path from a "=== path ===" line.
+func parseHeader(line string) (string, bool) {
+	line = strings.TrimSuffix(line, "\n")
+	if len(line) < len(headerPrefix)+len(headerSuffix)+1 ||
+		!strings.HasPrefix(line, headerPrefix) || !strings.HasSuffix(line, headerSuffix) {
+		return "", false
+	}
+	return line[len(headerPrefix) : len(line)-len(headerSuffix)], true
+}
+
+// BundleFile is a file read back from a plain bundle.
+type BundleFile struct {
+	Path    string
+	Content []byte
+	Meta    map[string]string // from Options.HeaderMeta; nil if absent
+
+	// DuplicateOf is the path of the earlier file whose content a
+	// deduplicated copy was bundled as a stub for. Content is that file's.
+	DuplicateOf string
+}
+
+// readFramed reads the content of a FramingSafe file, length bytes from
+// br, and unquotes its path.
+func readFramed(br *bufio.Reader, file *BundleFile, length string) ([]byte, error) {
+	n, err := strconv.ParseInt(length, 10, 64)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("%s: invalid %s %q", file.Path, MetaLength, length)
+	}
+	if strings.HasPrefix(file.Path, `"`) {
+		if file.Path, err = strconv.Unquote(file.Path); err != nil {
+			return nil, fmt.Errorf("%s: invalid quoted path", file.Path)
+		}
+	}
+	content := make([]byte, n)
+	if _, err := io.ReadFull(br, content); err != nil {
+		return nil, fmt.Errorf("%s: content shorter than its %s: %v", file.Path, MetaLength, err)
+	}
+	return content, nil
+}
+
+// ReadBundle parses a plain bundle and calls fn with each file's path and
+// original content, in bundle order. Text before the first header is
+// ignored.
+func ReadBundle(r io.Reader, fn func(path string, content []byte) error) error {
+	return ReadBundleFiles(r, func(f BundleFile) error {
+		return fn(f.Path, f.Content)
+	})
+}
+
+// ReadBundleFiles is ReadBundle, also returning each file's metadata. It
+// reads both framings, even mixed in one bundle. Deduplicated copies get
+// their original's content, size, and hash, so the files read back are
+// the ones bundled; for that, every file's content is kept until the end.
+func ReadBundleFiles(r io.Reader, fn func(BundleFile) error) error {
+	br := bufio.NewReader(r)
+	var (
+		file    BundleFile
+		content bytes.Buffer
+		inFile  bool
+		first   bool // the next line is the first after a header
+		read    = map[string]BundleFile{}
+	)
+
+	flush := func() error {
+		if !inFile {
+			return nil
+		}
+		if file.Content == nil {
+			file.Content = bytes.Clone(bytes.TrimSuffix(content.Bytes(), []byte("\n\n")))
+		}
+		if dup := file.Meta[MetaDuplicateOf]; dup != "" {
+			original, ok := read[dup]
+			if !ok {
+				return fmt.Errorf("%s: duplicate of %s, which isn't before it in the bundle", file.Path, dup)
+			}
+			file.Content, file.DuplicateOf = original.Content, dup
+			for _, key := range []string{MetaSize, MetaSHA256} {
+				if value, ok := original.Meta[key]; ok {
+					file.Meta[key] = value
+				} else {
+					delete(file.Meta, key)
+				}
+			}
+		}
+		read[file.Path] = file
+		return fn(file)
+	}
+
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		if line != "" {
+			if header, ok := parseHeader(line); ok {
+				if ferr := flush(); ferr != nil {
+					return ferr
+				}
+				file, inFile, first = BundleFile{Path: header}, true, true
+				content.Reset()
+			} else if strings.HasPrefix(line, packagePrefix) {
+				// A package header ends the file before it.
+				if ferr := flush(); ferr != nil {
+					return ferr
+				}
+				inFile = false
+			} else if inFile {
+				if first && strings.HasPrefix(line, metaPrefix) {
+					file.Meta = parseMeta(strings.TrimPrefix(line, metaPrefix))
+					if length, ok := file.Meta[MetaLength]; ok {
+						if file.Content, err = readFramed(br, &file, length); err != nil {
+							return err
+						}
+					}
+				} else if file.Content != nil {
+					// Only the separator follows framed content.
+				} else {
+					if line[0] == '\\' && needsEscape([]byte(line)) {
+						line = line[1:]
+					}
+					content.WriteString(line)
+				}
+				first = false
+			}
+		}
+
+		if err == io.EOF {
+			if !inFile {
+				return fmt.Errorf("no %q headers found", headerPrefix+"path"+headerSuffix)
+			}
+			return flush()
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package clap
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestCopyEscapedRoundTrip(t *testing.T) {
+	long := strings.Repeat("x", 70*1024) // longer than copyEscaped's buffer
+	tests := []string{
+		"plain text\n",
+		"=== not/a/header.go ===\n",
+		"before\n=== fake ===\nafter\n",
+		`\=== escaped once` + "\n" + `\\\=== escaped thrice` + "\n",
+		"=== meta size=3\nabc\n",
+		`C:\path\with\backslashes` + "\n" + `\\server\share` + "\n",
+		"no final newline",
+		long + "=== mid-line, not a header\n=== after a long line\n",
+	}
+	for _, content := range tests {
+		var buf bytes.Buffer
+		buf.WriteString("=== f.txt ===\n")
+		if err := copyEscaped(&buf, strings.NewReader(content)); err != nil {
+			t.Fatal(err)
+		}
+		buf.WriteString("\n\n")
+
+		var got []BundleFile
+		err := ReadBundleFiles(&buf, func(f BundleFile) error {
+			got = append(got, f)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("%.40q: %v", content, err)
+		}
+		if len(got) != 1 || got[0].Path != "f.txt" || string(got[0].Content) != content {
+			t.Errorf("%.40q: read back %d files, first %.40q", content, len(got), got[0].Content)
+		}
+	}
+}
+
+func TestReadBundleFilesRoundTrip(t *testing.T) {
+	// Copies are only stubbed when the stub is shorter, in tokens.
+	program := "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"a line long enough to be worth a stub\")\n}\n"
+	notes := "=== main.go ===\nnot a header, and long enough that its copy is bundled as a stub\n"
+	files := map[string]string{
+		"main.go":               program,
+		"docs/=== notes.txt":    notes,
+		"docs/x ===.txt":        `\=== already escaped` + "\n",
+		`win\style\path.txt`:    `C:\Users\me` + "\n",
+		"=== lead.txt":          "=== lead.txt ===\n",
+		"copy/main.go":          program,
+		"docs/with space.txt":   "spaced\n",
+		"docs/copy of tail.txt": notes,
+	}
+	safeOnly := map[string]string{
+		"line\nbreak.txt":  "path with a newline\n",
+		`"quoted".txt`:     "path with a leading quote\n",
+		"blank/tail.txt":   "trailing blank lines\n\n\n",
+		"blank/crlf.txt":   "=== crlf ===\r\n\r\n",
+		"blank/nonl.txt":   "=== no final newline ===",
+		"blank/header.txt": "=== meta length=999\n",
+	}
+
+	// Sorted by path, the first of two identical files is the original.
+	duplicates := map[string]string{
+		"main.go":               "copy/main.go",
+		"docs/copy of tail.txt": "docs/=== notes.txt",
+	}
+
+	for _, framing := range []string{FramingEscape, FramingSafe} {
+		t.Run(framing, func(t *testing.T) {
+			want := map[string]string{}
+			for name, content := range files {
+				want[name] = content
+			}
+			if framing == FramingSafe {
+				for name, content := range safeOnly {
+					want[name] = content
+				}
+			}
+			fsys := fstest.MapFS{}
+			for name, content := range want {
+				fsys[name] = &fstest.MapFile{Data: []byte(content), Mode: 0o644}
+			}
+
+			b, err := New(Options{Framing: framing, HeaderMeta: []string{MetaSize, MetaSHA256}, Reproducible: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := b.Run(context.Background(), fsys, &buf); err != nil {
+				t.Fatal(err)
+			}
+			bundle := buf.String()
+			for name, original := range duplicates {
+				if !strings.Contains(bundle, "duplicate_of="+strconv.Quote(original)) && !strings.Contains(bundle, "duplicate_of="+original+"\n") {
+					t.Errorf("%s isn't marked as a duplicate of %s:\n%s", name, original, bundle)
+				}
+			}
+
+			got := map[string]BundleFile{}
+			err = ReadBundleFiles(&buf, func(f BundleFile) error {
+				got[f.Path] = f
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, content := range want {
+				f, ok := got[name]
+				switch {
+				case !ok:
+					t.Errorf("%q missing from the bundle:\n%s", name, bundle)
+				case string(f.Content) != content:
+					t.Errorf("%q read back as %q, want %q", name, f.Content, content)
+				case f.DuplicateOf != duplicates[name]:
+					t.Errorf("%q: DuplicateOf %q, want %q", name, f.DuplicateOf, duplicates[name])
+				case f.Meta[MetaSHA256] != got[cmp.Or(f.DuplicateOf, name)].Meta[MetaSHA256] || f.Meta[MetaSize] != strconv.Itoa(len(content)):
+					t.Errorf("%q: meta %v doesn't describe its content", name, f.Meta)
+				}
+			}
+			if len(got) != len(want) {
+				t.Errorf("read back %d files, want %d", len(got), len(want))
+			}
+		})
+	}
+}
+
+func TestReadBundleFilesMissingOriginal(t *testing.T) {
+	bundle := "=== b.go ===\n=== meta duplicate_of=a.go\n[duplicate of a.go]\n\n=== a.go ===\npackage a\n\n"
+	err := ReadBundleFiles(strings.NewReader(bundle), func(BundleFile) error { return nil })
+	if err == nil {
+		t.Error("read a duplicate whose original comes after it")
+	}
+}
@@ -0,0 +1,168 @@
+package clap
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// cacheVersion is bumped whenever the cache layout or the meaning of its
+// entries changes, invalidating older files.
+const cacheVersion = 2
+
+// Cache remembers what reading each file came to between runs, keyed by
+// path, size, and modification time: its content as bundled, its token
+// count, or why it was left out. Rebuilding a large tree then only opens,
+// transforms, and tokenizes the files that changed; the others' sections
+// are written straight from the cache.
+//
+// A Cache is safe for concurrent use. Pass it in Options.Cache and call
+// Save after the run.
+type Cache struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	used    map[string]bool
+	dirty   bool
+	hits    map[string]bool
+	misses  map[string]bool
+}
+
+type cacheEntry struct {
+	Size       int64
+	Mtime      int64 // Unix nanoseconds
+	Content    []byte
+	Tokens     int
+	Redactions []Redaction
+	Encoding   string
+	Truncated  bool
+	Sanitized  bool
+	Skipped    string
+}
+
+type cacheFile struct {
+	Version int
+	Entries map[string]cacheEntry
+}
+
+// NewCache returns an empty cache, for keeping file contents in memory
+// across runs in one process.
+func NewCache() *Cache {
+	return &Cache{entries: map[string]cacheEntry{}, used: map[string]bool{}, hits: map[string]bool{}, misses: map[string]bool{}}
+}
+
+// LoadCache reads the cache at path. A missing, unreadable, or outdated
+// file yields an empty cache.
+func LoadCache(path string) (*Cache, error) {
+	c := NewCache()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var file cacheFile
+	if gob.NewDecoder(bytes.NewReader(data)).Decode(&file) == nil && file.Version == cacheVersion && file.Entries != nil {
+		c.entries = file.Entries
+	}
+	return c, nil
+}
+
+// Save writes the entries used by the last run to path, dropping files
+// that no longer exist, and resets Stats for the next run. It writes
+// nothing if nothing changed.
+func (c *Cache) Save(path string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key := range c.entries {
+		if !c.used[key] {
+			delete(c.entries, key)
+			c.dirty = true
+		}
+	}
+	c.used = map[string]bool{}
+	c.hits, c.misses = map[string]bool{}, map[string]bool{}
+	if !c.dirty {
+		return nil
+	}
+
+	var data bytes.Buffer
+	if err := gob.NewEncoder(&data).Encode(cacheFile{Version: cacheVersion, Entries: c.entries}); err != nil {
+		return err
+	}
+	temp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := temp.Write(data.Bytes()); err != nil {
+		temp.Close()
+		os.Remove(temp.Name())
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		os.Remove(temp.Name())
+		return err
+	}
+	if err := os.Rename(temp.Name(), path); err != nil {
+		os.Remove(temp.Name())
+		return err
+	}
+	c.dirty = false
+	return nil
+}
+
+// Stats returns how many files were found in the cache and how many had to
+// be read since the last Save.
+func (c *Cache) Stats() (hits, misses int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.hits), len(c.misses)
+}
+
+// lookup returns what reading the file at key came to, if it hasn't
+// changed since it was stored.
+func (c *Cache) lookup(key string, info fs.FileInfo) (fileResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.used[key] = true
+	entry, ok := c.entries[key]
+	if !ok || entry.Size != info.Size() || entry.Mtime != info.ModTime().UnixNano() {
+		return fileResult{}, false
+	}
+	c.hits[key] = true
+	return fileResult{
+		content:    entry.Content,
+		tokens:     entry.Tokens,
+		redactions: entry.Redactions,
+		encoding:   entry.Encoding,
+		truncated:  entry.Truncated,
+		sanitized:  entry.Sanitized,
+		skipped:    entry.Skipped,
+	}, true
+}
+
+// store records what reading the file at key came to.
+func (c *Cache) store(key string, info fs.FileInfo, result fileResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.used[key] = true
+	c.misses[key] = true
+	c.entries[key] = cacheEntry{
+		Size:       info.Size(),
+		Mtime:      info.ModTime().UnixNano(),
+		Content:    result.content,
+		Tokens:     result.tokens,
+		Redactions: result.redactions,
+		Encoding:   result.encoding,
+		Truncated:  result.truncated,
+		Sanitized:  result.sanitized,
+		Skipped:    result.skipped,
+	}
+	c.dirty = true
+}
@@ -0,0 +1,1416 @@
+// Package clap walks a file tree, filters it, and concatenates the selected
+// files into a single bundle. Trees are read through fs.FS, so a directory,
+// an archive, or an in-memory file system all bundle the same way.
+package clap
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DefaultOutput is the bundle filename used when none is given.
+const DefaultOutput = "clap.file"
+
+// ClapignoreFile is the name of the ignore files read in every directory
+// of the tree, in .gitignore syntax, for paths to keep out of bundles but
+// not out of git.
+const ClapignoreFile = ".clapignore"
+
+// DefaultExcludes lists directory names skipped wherever they appear in
+// the tree: version control, dependency, build, and editor directories
+// hardly anyone wants in a bundle.
+var DefaultExcludes = []string{
+	".git", "node_modules", "target", "dist", "build", "__pycache__", ".venv", ".idea", ".vscode",
+}
+
+// TestPatterns lists globs, in .gitignore syntax, matching the test files
+// and fixtures skipped with Options.NoTests.
+var TestPatterns = []string{
+	"*_test.go",
+	"*.test.js", "*.test.jsx", "*.test.ts", "*.test.tsx", "*.test.mjs", "*.test.cjs",
+	"*.spec.js", "*.spec.jsx", "*.spec.ts", "*.spec.tsx", "*.spec.mjs", "*.spec.cjs",
+	"test_*.py", "*_test.py", "*_spec.rb", "*_test.rb",
+	"tests/", "__tests__/", "testdata/",
+}
+
+// Options configures a Bundler. The zero value bundles every non-binary,
+// non-ignored file in plain format.
+type Options struct {
+	// Extensions restricts the bundle to files with these extensions,
+	// with or without the leading dot. Empty includes every file.
+	Extensions []string
+
+	// Names lists file names, such as go.mod or Makefile, that Extensions
+	// lets through whatever their extension. Matching ignores case.
+	Names []string
+
+	// Exclude lists globs of paths to skip, in .gitignore syntax relative
+	// to the walk root.
+	Exclude []string
+
+	// IncludeRegexp, when set, restricts the bundle to files whose
+	// slash-separated path relative to the walk root matches one of these
+	// Go regular expressions. ExcludeRegexp skips files whose path matches
+	// any of its. Unanchored, like grep: use ^ and $ to match whole paths.
+	// They apply to files, after Extensions and Exclude.
+	IncludeRegexp []string
+	ExcludeRegexp []string
+
+	// NewerThan and OlderThan, when set, restrict the bundle to files
+	// modified after or before these times.
+	NewerThan time.Time
+	OlderThan time.Time
+
+	// Grep, when set, restricts the bundle to files whose content matches
+	// this Go regular expression, checked after transcoding to UTF-8.
+	// GrepInvert keeps the files that don't match instead. Files left out
+	// are reported as SkippedNoMatch.
+	Grep       string
+	GrepInvert bool
+
+	// SkipOutput lists globs of previous bundles to skip. DefaultOutput is
+	// always skipped.
+	SkipOutput []string
+
+	// NoDefaultExcludes disables skipping DefaultExcludes.
+	NoDefaultExcludes bool
+
+	// Hidden includes hidden files and directories: dotfiles and, on
+	// Windows, entries with the hidden attribute. They are skipped by
+	// default, though .gitignore files are still read.
+	Hidden bool
+
+	// NoTests skips test files and fixtures matching TestPatterns.
+	NoTests bool
+
+	// NoGenerated skips generated files: those matching
+	// GeneratedPatterns, those whose first 8KB carry a generator's marker
+	// such as "Code generated ... DO NOT EDIT.", and minified scripts and
+	// stylesheets.
+	NoGenerated bool
+
+	// NoGitignore disables .gitignore handling.
+	NoGitignore bool
+
+	// NoClapignore disables ClapignoreFile handling.
+	NoClapignore bool
+
+	// GlobalExcludes is a host path to the user's global git excludes file,
+	// applied together with .gitignore files. See GlobalExcludesFile.
+	GlobalExcludes string
+
+	// Format names the output format: "plain" (default), "markdown",
+	// "json", "jsonl", "html", "xml-docs", or one of the archive formats "zip" and "tar.gz".
+	// jsonl writes one object per line and flushes each file's line as
+	// soon as it's written.
+	// Archives store each file under its path with its permissions and
+	// modification time, and imply KeepEncoding.
+	Format string
+
+	// Languages adds to or overrides the table that names each file's
+	// language for Markdown fences, HTML highlighting, and
+	// TemplateData.Lang. Keys are extensions with the dot, e.g. ".tpl", or
+	// file names, e.g. "BUILD", matched case-insensitively; an empty
+	// language removes an entry.
+	Languages map[string]string
+
+	// HeaderMeta adds metadata to each file's header in the text formats:
+	// any of the Meta constants, e.g. MetaSize and MetaSHA256. Plain
+	// bundles carry it on a "=== meta" line that ReadBundleFiles returns.
+	HeaderMeta []string
+
+	// Framing selects how plain bundles delimit files: FramingEscape, the
+	// default, or FramingSafe.
+	Framing string
+
+	// Header and Footer replace the plain format's "=== path ===" line
+	// with text/template templates executed for each file, e.g.
+	// `<file path="{{.Path}}">` and `</file>`. See TemplateData for the fields
+	// available. They only apply to the plain format.
+	Header string
+	Footer string
+
+	// ChunkTokens, with the jsonl format, cuts each file into chunks of
+	// about this many tokens, one line each, for embedding. Chunks end at
+	// whole lines, preferably at a blank line or a top-level declaration.
+	ChunkTokens int
+
+	// ChunkOverlap is how many tokens of lines each chunk repeats from the
+	// end of the one before. It must be less than ChunkTokens.
+	ChunkOverlap int
+
+	// Tokenizer names the token encoding: "cl100k" (default) or "o200k".
+	Tokenizer string
+
+	// KeepEmpty bundles files that are empty or hold only whitespace,
+	// which are otherwise skipped with SkippedEmpty and marked "(empty)"
+	// in the tree. Archive formats always keep them.
+	KeepEmpty bool
+
+	// IncludeBinary bundles files that look binary instead of skipping them.
+	IncludeBinary bool
+
+	// KeepEncoding writes files in their original encoding. Otherwise
+	// files that aren't UTF-8 (UTF-16 with a byte order mark, Shift-JIS,
+	// Latin-1) are transcoded to UTF-8, byte order marks are dropped, and
+	// the source encoding is reported in Event.Encoding.
+	KeepEncoding bool
+
+	// MaxDepth limits how many directory levels are bundled: 1 includes
+	// only files directly in the root, 2 adds their subdirectories, and so
+	// on. Zero means no limit.
+	MaxDepth int
+
+	// MaxSize skips files larger than this many bytes. Zero means no limit.
+	MaxSize int64
+
+	// TruncateLines and TruncateBytes cut files with more lines or bytes
+	// than this down to their first lines, followed by a "…[truncated N
+	// lines]…" marker. With TruncateTail, the limit is split between the
+	// start and end of the file, and the marker goes between them. Zero
+	// means no limit. Truncated files are flagged in Event.Truncated.
+	TruncateLines int
+	TruncateBytes int64
+	TruncateTail  bool
+
+	// FitTokens trims the bundle to about this many tokens, counting the
+	// headers, the tree, and the format's own markup along with content,
+	// and a deduplicated copy as its stub. If the selection is larger,
+	// files are left out, with Skipped set to SkippedOverBudget and Tokens
+	// to what their content would have cost: the lightest by Weights
+	// first, then test files, then files matching no FitPriority pattern,
+	// then priority files from the last pattern to the first, the largest
+	// first within each. A file that only needs to lose part of itself is
+	// truncated instead, unless copies of it are kept, which go before it.
+	// Every file is read before any is written. Zero means no budget.
+	FitTokens int
+
+	// FitPriority lists globs, in .gitignore syntax, of files to keep
+	// longest under FitTokens, most important first.
+	FitPriority []string
+
+	// StripComments removes comments from source files in languages with a
+	// known comment syntax (Go, JavaScript and TypeScript, Python, C-style
+	// languages, shell, HTML, ...) before they are bundled.
+	StripComments bool
+
+	// Signatures cuts source files in supported languages, so far Go, down
+	// to their package clause, imports, constants, types, and function
+	// signatures with the bodies elided. Other files, and files that
+	// don't parse, are bundled whole.
+	Signatures bool
+
+	// Redact replaces secrets (private keys, cloud and API tokens,
+	// high-entropy strings) with placeholders before files are bundled.
+	// Each file's replacements are listed in Event.Redactions.
+	Redact bool
+
+	// Sanitize removes ANSI escape sequences, such as color codes, and
+	// other control characters from content: SanitizeAuto ("", the
+	// default) from files that aren't source code, like logs and terminal
+	// captures, SanitizeAll from every file, SanitizeOff from none. Tab,
+	// newline, and CRLF line endings are kept. Archive formats store files
+	// as they are.
+	Sanitize string
+
+	// SanitizeEscape writes what Sanitize would remove as visible escapes
+	// such as \x1b, sequences included, instead.
+	SanitizeEscape bool
+
+	// Anonymize, if set, replaces every path component in headers,
+	// events, and the tree with a stable pseudonym, and content matching
+	// its identifier patterns too. Save it after the run to keep the
+	// mapping.
+	Anonymize *Anonymizer
+
+	// NormalizeEOL rewrites line endings to EOLLF ("\n") or EOLCRLF
+	// ("\r\n"). EOLKeep, the default, leaves them as they are.
+	NormalizeEOL string
+
+	// TrimTrailingSpace drops spaces and tabs at the ends of lines.
+	TrimTrailingSpace bool
+
+	// TabsToSpaces, if positive, expands tabs to spaces, with tab stops
+	// this many columns apart.
+	TabsToSpaces int
+
+	// LineNumbers prefixes every content line with its right-aligned line
+	// number and " | ". Numbers refer to the bundled content, after
+	// StripComments.
+	LineNumbers bool
+
+	// NoDedupe bundles every copy of identical files. Otherwise only the
+	// first copy's content is included, and later ones get a short
+	// "identical to <path>" stub and Event.DuplicateOf. In plain bundles
+	// the stub's meta line names the original as MetaDuplicateOf, so
+	// ReadBundleFiles gives the copy its content back. Archive formats
+	// never deduplicate.
+	NoDedupe bool
+
+	// SplitBytes and SplitTokens cap the content of each part written by
+	// RunParts. Zero means no limit.
+	SplitBytes  int64
+	SplitTokens int
+
+	// FollowSymlinks descends into symlinked directories, except ones that
+	// lead back to a directory already being walked. Otherwise they are
+	// reported as SkippedSymlinkDir. Symlinked files are always bundled
+	// with their target's content.
+	FollowSymlinks bool
+
+	// Cache, when set, supplies the contents and token counts of files
+	// unchanged since an earlier run, without reading them, and records
+	// new ones. See LoadCache.
+	Cache *Cache
+
+	// Jobs is the number of files read concurrently. Zero uses one per CPU.
+	Jobs int
+
+	// WalkJobs, if more than 1, is the number of directories read
+	// concurrently ahead of the walk, which helps on network file systems
+	// and huge trees where each listing and stat waits on latency. The
+	// walk itself stays in order, so the bundle is the same.
+	WalkJobs int
+
+	// ReadRate, if positive, caps how fast file contents are read, in
+	// bytes per second across all workers, so a background run doesn't
+	// starve other work of I/O.
+	ReadRate int64
+
+	// FailOnError stops the run at the first file or directory that can't
+	// be read. By default it is reported through Report with Event.Err and
+	// left out.
+	FailOnError bool
+
+	// Root is prepended to paths in headers and events by Run, so they
+	// read the way the user named the tree. See Source for RunSources.
+	Root string
+
+	// StripPrefix is removed from the start of every path in headers,
+	// events, and the tree, whether it names part of a Root or
+	// directories within the walk. Paths outside it are left alone.
+	StripPrefix string
+
+	// Output identifies the bundle being written when it lives inside the
+	// tree, so it is never read back into itself.
+	Output fs.FileInfo
+
+	// Sort orders the bundled files by "path", "size", "mtime", or "ext"
+	// (then walk order), or with "go", Go packages after the packages
+	// they import, other files first. Empty keeps walk order: by name
+	// within each directory. Reverse inverts it. Go imports are read with
+	// go/parser, not the go command, so build constraints and go.mod
+	// replace directives are ignored.
+	Sort    string
+	Reverse bool
+
+	// GoPackageHeaders, with Sort "go", starts each Go package's files
+	// with a header naming it: a "=== package <import path>" line in
+	// plain bundles, which ReadBundleFiles skips, or a "## Package"
+	// heading in Markdown. Without a go.mod, or with Anonymize, the
+	// package's directory stands in for its import path.
+	GoPackageHeaders bool
+
+	// Reproducible makes the output a function of the files' paths, modes,
+	// and contents alone, so identical trees bundle byte for byte the same:
+	// files are sorted by path, bytewise, unless Sort says otherwise, and
+	// no modification times are written. Archives, which need one, store
+	// 1980-01-01 instead. Sorting by "mtime" and the mtime header field are refused.
+	Reproducible bool
+
+	// Weights rank files by importance: heavier files come earlier in the
+	// bundle, ahead of the Sort key, and are dropped later under
+	// FitTokens. A file takes the weight of the last entry it matches, or
+	// DefaultWeight.
+	Weights []Weight
+
+	// First and Last list globs, in .gitignore syntax, of files to bundle
+	// before and after all others, in pattern order, e.g. README.md and
+	// go.mod first. A file matching both goes first.
+	First []string
+	Last  []string
+
+	// Tree writes an ASCII directory tree of the bundled files before
+	// their contents.
+	Tree bool
+
+	// Report, when set, is called for every file that was selected by the
+	// walk, in bundle order. Entries the walk itself couldn't read are
+	// reported as it finds them, before the files.
+	Report func(Event)
+
+	// Filtered, when set, is called for every file and directory the walk
+	// leaves out before selecting files, with one of the Filtered
+	// constants. A directory's contents aren't visited, so aren't reported.
+	Filtered func(path string, dir bool, reason string)
+
+	// Selected, when set, is called once the walk is done with the number
+	// of files Report will be called for, before any of them, so progress
+	// can be shown against it. List doesn't call it.
+	Selected func(files int)
+
+	// Confirm, when set, is called once the walk is done with the number
+	// and total size of the files it selected, before Selected and before
+	// any content is read. An error stops the run with it. List doesn't
+	// call it.
+	Confirm func(files int, size int64) error
+
+	// Placed, when set, is called after each file is written with where
+	// its section landed in the output.
+	Placed func(Placement)
+
+	// FrontMatter, when non-nil, starts the bundle with a YAML front
+	// matter block of these fields, followed by the files, bytes, and
+	// tokens the bundle holds in total. Every file is read before any is
+	// written, so the totals are known. It needs the plain or markdown
+	// format, or header templates, and goes in the first part.
+	FrontMatter []FrontMatterField
+}
+
+// Reasons reported in Event.Skipped.
+const (
+	SkippedBinary     = "binary"
+	SkippedPrevious   = "previous output"
+	SkippedTooLarge   = "over max size"
+	SkippedOverBudget = "over token budget"
+	SkippedNoMatch    = "no grep match" // see Options.Grep
+	SkippedGenerated  = "generated"     // see Options.NoGenerated
+	SkippedEmpty      = "empty"         // see Options.KeepEmpty
+
+	SkippedDanglingLink = "dangling symlink"
+	SkippedSymlinkDir   = "symlinked directory" // not followed; see Options.FollowSymlinks
+	SkippedSymlinkLoop  = "symlink loop"
+)
+
+// Reasons passed to Options.Filtered.
+const (
+	FilteredDepth      = "max depth"
+	FilteredDefault    = "default exclude" // one of DefaultExcludes
+	FilteredExclude    = "excluded"        // Options.Exclude, or a test or generated name with NoTests or NoGenerated
+	FilteredNotListed  = "not listed"      // not in Source.Only
+	FilteredHidden     = "hidden"
+	FilteredGitignore  = "gitignored"
+	FilteredClapignore = "clapignored" // a ClapignoreFile rule
+	FilteredExtension  = "extension"
+	FilteredRegexp     = "regexp"      // Options.IncludeRegexp or ExcludeRegexp
+	FilteredMtime      = "mtime"       // Options.NewerThan or OlderThan
+	FilteredOutput     = "output file" // Options.Output itself
+)
+
+// Event describes what happened to one selected file.
+type Event struct {
+	Path    string // display path, as used in the bundle header
+	Size    int64  // bytes of content, or the file size when skipped
+	Tokens  int    // tokens of content
+	Skipped string // why the file was left out (one of the Skipped constants), or ""
+	Err     error  // read failure; the file, or the directory's contents, were left out
+
+	Redactions []Redaction // secrets replaced in content, with Options.Redact
+	Encoding   string      // encoding content was transcoded from (one of the Encoding constants), or ""
+	Truncated  bool        // content was cut to Options.TruncateLines or TruncateBytes, or to fit Options.FitTokens
+	Sanitized  bool        // control characters were removed or escaped, see Options.Sanitize
+
+	DuplicateOf string // path of an earlier file with identical content, replaced by a stub; see Options.NoDedupe
+}
+
+// Placement locates one file's section in the output, for Options.Placed.
+// Offsets count the bytes the Bundler wrote, so they don't include a
+// caller's part header or compression.
+type Placement struct {
+	Path   string
+	Part   int      // 1-based; always 1 unless splitting
+	Offset int64    // bytes before the section in its part
+	Length int64    // bytes in the section: header, content, and separator
+	Size   int64    // bytes of content, as bundled
+	SHA256 [32]byte // of content, as bundled
+
+	// DuplicateOf is the path of the earlier file whose content this one
+	// has, if it was bundled as a stub.
+	DuplicateOf string
+}
+
+// Bundler concatenates files from an fs.FS according to its Options.
+type Bundler struct {
+	opts       Options
+	format     formatter
+	langs      languages
+	whitespace whitespace
+	tokens     *tokenizer
+	extensions map[string]bool
+	names      map[string]bool
+	include    []*regexp.Regexp // Options.IncludeRegexp
+	exclude    []*regexp.Regexp // Options.ExcludeRegexp
+	grep       *regexp.Regexp   // Options.Grep
+	excludes   *gitIgnore
+	previous   *gitIgnore
+	skipDirs   map[string]bool
+	order      *fileOrder
+
+	fitTests    *gitIgnore
+	fitPriority []*gitIgnore
+}
+
+// New validates opts and returns a Bundler ready to Run.
+func New(opts Options) (*Bundler, error) {
+	format, err := newBundleFormatter(opts, opts.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	if isArchive(format) {
+		opts.KeepEncoding = true
+	}
+	switch opts.Sanitize {
+	case "", SanitizeAuto, SanitizeAll, SanitizeOff:
+	default:
+		return nil, fmt.Errorf("unknown sanitize mode %q (want %s, %s, or %s)", opts.Sanitize, SanitizeAuto, SanitizeAll, SanitizeOff)
+	}
+	langs, err := newLanguages(opts.Languages)
+	if err != nil {
+		return nil, err
+	}
+	ws, err := newWhitespace(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := newTokenizer(opts.Tokenizer)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Reproducible {
+		switch opts.Sort {
+		case "":
+			opts.Sort = "path"
+		case "mtime":
+			return nil, fmt.Errorf("reproducible output can't be sorted by mtime")
+		}
+	}
+	if opts.GoPackageHeaders && opts.Sort != "go" {
+		return nil, fmt.Errorf("package headers need the go sort order")
+	}
+	order, err := newFileOrder(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Jobs <= 0 {
+		opts.Jobs = runtime.NumCPU()
+	}
+
+	includeRegexp, err := compileRegexps("include regexp", opts.IncludeRegexp)
+	if err != nil {
+		return nil, err
+	}
+	excludeRegexp, err := compileRegexps("exclude regexp", opts.ExcludeRegexp)
+	if err != nil {
+		return nil, err
+	}
+
+	var grep *regexp.Regexp
+	if opts.Grep != "" {
+		if grep, err = regexp.Compile(opts.Grep); err != nil {
+			return nil, fmt.Errorf("grep: %v", err)
+		}
+	}
+
+	var fitPriority []*gitIgnore
+	for _, pattern := range opts.FitPriority {
+		fitPriority = append(fitPriority, newExcludes([]string{pattern}))
+	}
+
+	excludes := opts.Exclude
+	if opts.NoTests {
+		excludes = append(slices.Clip(excludes), TestPatterns...)
+	}
+	if opts.NoGenerated {
+		excludes = append(slices.Clip(excludes), GeneratedPatterns...)
+	}
+
+	skipDirs := map[string]bool{}
+	if !opts.NoDefaultExcludes {
+		for _, name := range DefaultExcludes {
+			skipDirs[name] = true
+		}
+	}
+
+	return &Bundler{
+		opts:       opts,
+		format:     format,
+		langs:      langs,
+		whitespace: ws,
+		tokens:     tokens,
+		extensions: normalizeExtensions(opts.Extensions),
+		names:      normalizeNames(opts.Names),
+		excludes:   newExcludes(excludes),
+		include:    includeRegexp,
+		exclude:    excludeRegexp,
+		grep:       grep,
+		previous:   newExcludes(append([]string{DefaultOutput}, opts.SkipOutput...)),
+		skipDirs:   skipDirs,
+		order:      order,
+
+		fitTests:    newExcludes(TestPatterns),
+		fitPriority: fitPriority,
+	}, nil
+}
+
+// newBundleFormatter returns the formatter for format name, set up for
+// opts' languages, header metadata, framing, and header templates.
+func newBundleFormatter(opts Options, name string) (formatter, error) {
+	langs, err := newLanguages(opts.Languages)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := normalizeMeta(opts.HeaderMeta)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Reproducible && slices.Contains(meta, MetaMtime) {
+		return nil, fmt.Errorf("reproducible output has no mtime header metadata")
+	}
+	switch opts.Framing {
+	case "", FramingEscape, FramingSafe:
+	default:
+		return nil, fmt.Errorf("unknown framing %q (want %s or %s)", opts.Framing, FramingEscape, FramingSafe)
+	}
+	format, err := newFormatter(name, formatOptions{langs: langs, meta: meta})
+	if err != nil {
+		return nil, err
+	}
+	if sqlite, ok := format.(*sqliteFormatter); ok {
+		sqlite.undated = opts.Reproducible
+	}
+	if opts.Framing == FramingSafe {
+		plain, ok := format.(plainFormatter)
+		if !ok {
+			return nil, fmt.Errorf("safe framing needs the plain format")
+		}
+		plain.safe = true
+		format = plain
+	}
+	if opts.ChunkTokens != 0 || opts.ChunkOverlap != 0 {
+		jsonl, ok := format.(*jsonlFormatter)
+		if !ok {
+			return nil, fmt.Errorf("chunks need the jsonl format")
+		}
+		if opts.ChunkTokens <= 0 || opts.ChunkOverlap < 0 || opts.ChunkOverlap >= opts.ChunkTokens {
+			return nil, fmt.Errorf("chunk overlap %d must be at least 0 and less than the chunk size %d", opts.ChunkOverlap, opts.ChunkTokens)
+		}
+		tokens, err := newTokenizer(opts.Tokenizer)
+		if err != nil {
+			return nil, err
+		}
+		jsonl.chunks = &chunker{tokens: tokens, size: opts.ChunkTokens, overlap: opts.ChunkOverlap}
+	}
+	if opts.FrontMatter != nil {
+		if _, ok := format.(frontMatterWriter); !ok {
+			return nil, fmt.Errorf("front matter needs the plain or markdown format")
+		}
+	}
+	if opts.Header != "" || opts.Footer != "" {
+		if _, plain := format.(plainFormatter); !plain {
+			return nil, fmt.Errorf("header and footer templates need the plain format")
+		}
+		if opts.Framing == FramingSafe {
+			return nil, fmt.Errorf("safe framing doesn't apply to header templates")
+		}
+		if meta != nil {
+			return nil, fmt.Errorf("header metadata doesn't apply to header templates; use {{.Size}}, {{.Mode}}, {{.Mtime}}, {{.SHA256}}, and {{.Lang}} instead")
+		}
+		if format, err = newTemplateFormatter(opts.Header, opts.Footer, langs); err != nil {
+			return nil, err
+		}
+	}
+	if opts.GoPackageHeaders {
+		if _, ok := format.(packageHeaderWriter); !ok {
+			return nil, fmt.Errorf("package headers need the plain or markdown format")
+		}
+	}
+	return format, nil
+}
+
+// Source is one tree to bundle. Root is prepended to its paths in headers
+// and events, so they read the way the user named the tree.
+type Source struct {
+	Root string
+	FS   fs.FS
+
+	// Only, when non-nil, restricts the walk to these slash-separated
+	// paths relative to FS, e.g. from GitTrackedFiles. The other filters
+	// still apply.
+	Only []string
+
+	// Files, when non-nil, replaces the walk: exactly these slash-separated
+	// paths relative to FS are bundled, in this order, and the path
+	// filters, ignore files, and Only don't apply. Checks that need the
+	// content, such as for binaries, still do.
+	Files []string
+}
+
+// Run walks fsys and writes the bundle to w, using Options.Root as the
+// display root. Unreadable files and directories are reported through
+// Options.Report and left out, unless Options.FailOnError is set; write
+// errors stop the run.
+func (b *Bundler) Run(ctx context.Context, fsys fs.FS, w io.Writer) error {
+	return b.RunSources(ctx, []Source{{Root: b.opts.Root, FS: fsys}}, w)
+}
+
+// RunSources is like Run but bundles several trees, in order, into a
+// single output. Split limits are ignored; see RunParts.
+func (b *Bundler) RunSources(ctx context.Context, sources []Source, w io.Writer) error {
+	opened := false
+	return b.run(ctx, sources, false, func() (io.Writer, error) {
+		if opened {
+			return nil, fmt.Errorf("RunSources writes a single part")
+		}
+		opened = true
+		return w, nil
+	})
+}
+
+// RunParts is like RunSources but, when Options.SplitBytes or SplitTokens
+// is set, calls next for a new part whenever the next file would push the
+// current one past the limit. Files are never split; one larger than the
+// limit gets a part of its own. Each part is a complete document in the
+// chosen format, and the tree, if enabled, goes in the first.
+func (b *Bundler) RunParts(ctx context.Context, sources []Source, next func() (io.Writer, error)) error {
+	return b.run(ctx, sources, true, next)
+}
+
+// List walks sources and applies every filter that doesn't need file
+// contents, then reports each file a bundle would consider without
+// reading it or writing anything. Sizes come from the walk; binaries are
+// only recognized by extension, empty files only by size, and token
+// counts are zero. Only the grep
+// filter and Options.NoGenerated's markers look at content.
+func (b *Bundler) List(ctx context.Context, sources []Source) error {
+	var jobs []*fileJob
+	for i := range sources {
+		selected, err := b.selectFiles(ctx, &sources[i])
+		if err != nil {
+			return err
+		}
+		jobs = append(jobs, selected...)
+	}
+	// Grep has to read content; binaries are still left to the extension.
+	grep := &fileReader{includeBinary: true, keepEncoding: b.opts.KeepEncoding, grep: b.grep, grepInvert: b.opts.GrepInvert, noGenerated: b.opts.NoGenerated, throttle: newThrottle(b.opts.ReadRate)}
+	for _, job := range b.order.apply(jobs) {
+		event := Event{Path: job.path, Size: job.info.Size(), Skipped: job.skipped}
+		if event.Skipped == "" && !b.opts.IncludeBinary && isBinary(job.rel, nil) {
+			event.Skipped = SkippedBinary
+		}
+		if event.Skipped == "" && !b.opts.KeepEmpty && !isArchive(b.format) && job.info.Size() == 0 {
+			event.Skipped = SkippedEmpty
+		}
+		if event.Skipped == "" && (b.grep != nil || b.opts.NoGenerated) {
+			event.Skipped = grep.probeFile(job)
+		}
+		b.report(event)
+	}
+	return nil
+}
+
+// PartHeader returns the line that labels part (1-based) of total in the
+// chosen format, or "" if the format has no room for one.
+func (b *Bundler) PartHeader(part, total int) string {
+	return b.format.partHeader(part, total)
+}
+
+// run implements RunSources and RunParts.
+func (b *Bundler) run(ctx context.Context, sources []Source, split bool, next func() (io.Writer, error)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var jobs []*fileJob
+	for i := range sources {
+		selected, err := b.selectFiles(ctx, &sources[i])
+		if err != nil {
+			return err
+		}
+		jobs = append(jobs, selected...)
+	}
+	if b.opts.Confirm != nil {
+		files, size := 0, int64(0)
+		for _, job := range jobs {
+			if job.skipped == "" {
+				files++
+				size += job.info.Size()
+			}
+		}
+		if err := b.opts.Confirm(files, size); err != nil {
+			return err
+		}
+	}
+	if b.opts.Selected != nil {
+		b.opts.Selected(len(jobs))
+	}
+
+	readers := &fileReader{
+		tokens:        b.tokens,
+		includeBinary: b.opts.IncludeBinary,
+		keepEncoding:  b.opts.KeepEncoding,
+		keepEmpty:     b.opts.KeepEmpty || isArchive(b.format),
+		stripComments: b.opts.StripComments,
+		signatures:    b.opts.Signatures,
+		redact:        b.opts.Redact,
+		sanitize:      cmp.Or(b.opts.Sanitize, SanitizeAuto),
+		escape:        b.opts.SanitizeEscape,
+		langs:         b.langs,
+		whitespace:    b.whitespace,
+		lineNumbers:   b.opts.LineNumbers,
+		truncate:      truncator{lines: b.opts.TruncateLines, bytes: b.opts.TruncateBytes, tail: b.opts.TruncateTail},
+		dedupe:        !b.opts.NoDedupe && !isArchive(b.format),
+		grep:          b.grep,
+		grepInvert:    b.opts.GrepInvert,
+		noGenerated:   b.opts.NoGenerated,
+		anonymize:     b.opts.Anonymize,
+		throttle:      newThrottle(b.opts.ReadRate),
+		cache:         b.opts.Cache,
+		cacheSalt:     fmt.Sprintf("%s,%t,%t,%t,%t,%d,%d,%t", b.opts.Tokenizer, b.opts.KeepEncoding, b.opts.StripComments, b.opts.Redact, b.opts.LineNumbers, b.opts.TruncateLines, b.opts.TruncateBytes, b.opts.TruncateTail) + b.opts.Anonymize.salt(),
+	}
+	if isArchive(b.format) {
+		readers.sanitize = SanitizeOff
+	}
+	readers.cacheSalt += fmt.Sprintf(",%s,%t,%+v,%t,%v", readers.sanitize, b.opts.SanitizeEscape, b.whitespace, b.opts.Signatures, b.langs)
+	// The filters that skip files as they are read decide what is cached too.
+	readers.cacheSalt += fmt.Sprintf(",%t,%t,%t,%v,%t", readers.includeBinary, readers.keepEmpty, readers.noGenerated, readers.grep, readers.grepInvert)
+	if b.opts.Tree && (!b.opts.IncludeBinary || !readers.keepEmpty || readers.grep != nil || readers.noGenerated) {
+		// The tree is written before any content, so binaries, empty and
+		// generated files, and files the grep filter leaves out have to be
+		// weeded out up front for it to match the bundle.
+		readers.probe(ctx, jobs, b.opts.Jobs)
+	}
+	if b.opts.FitTokens > 0 {
+		if err := b.fit(ctx, readers, sources, jobs); err != nil {
+			return err
+		}
+	}
+	// The tree keeps walk order, so it reads like a directory listing;
+	// contents follow Options.Sort, First, and Last.
+	ordered := b.order.apply(jobs)
+
+	var frontMatter string
+	if b.opts.FrontMatter != nil {
+		// The totals need every file read, and deduplicated, up front.
+		if err := b.readAhead(ctx, readers, ordered); err != nil {
+			return err
+		}
+		var err error
+		if frontMatter, err = b.frontMatter(ordered, readers.dedupe); err != nil {
+			return err
+		}
+	}
+
+	part := &partWriter{format: b.format, next: next}
+	if err := part.start(); err != nil {
+		return err
+	}
+	if frontMatter != "" {
+		if err := b.format.(frontMatterWriter).writeFrontMatter(part.out, frontMatter); err != nil {
+			return err
+		}
+	}
+	if b.opts.Tree {
+		if err := b.format.writeTree(part.out, renderTree(sources, jobs, b.opts.StripPrefix, b.opts.Anonymize)); err != nil {
+			return err
+		}
+	}
+	jobs = ordered
+
+	// Jobs are handed to the readers in order, at most window ahead of the
+	// writer, and written as each one's result arrives.
+	work := readers.startReaders(b.opts.Jobs)
+	window := make(chan struct{}, 4*b.opts.Jobs)
+	go func() {
+		defer close(work)
+		for _, job := range jobs {
+			if job.skipped != "" || job.pre != nil {
+				continue
+			}
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			work <- job
+		}
+	}()
+
+	seen := map[[32]byte]string{} // content hash to the first path with it
+	var pkg *goPackage            // of the last file written, for GoPackageHeaders
+	pkgPart := 0
+	for _, job := range jobs {
+		if job.skipped != "" {
+			event := Event{Path: job.path, Size: job.info.Size(), Skipped: job.skipped}
+			if job.pre != nil {
+				event.Tokens = job.pre.tokens
+			}
+			b.report(event)
+			continue
+		}
+
+		var result fileResult
+		if job.pre != nil {
+			result = *job.pre
+		} else {
+			select {
+			case result = <-job.result:
+				<-window
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		event := Event{Path: job.path, Skipped: result.skipped, Err: result.err}
+		if event.Err != nil && b.opts.FailOnError {
+			return fmt.Errorf("reading %s: %w", job.path, event.Err)
+		}
+		if event.Err != nil || event.Skipped != "" {
+			event.Size = job.info.Size()
+			b.report(event)
+			continue
+		}
+
+		if readers.dedupe {
+			first, err := b.stubDuplicate(seen, job.path, &result)
+			if err != nil {
+				return err
+			}
+			event.DuplicateOf = first
+		}
+
+		event.Size = int64(len(result.content))
+		event.Tokens = result.tokens
+		event.Redactions = result.redactions
+		event.Encoding = result.encoding
+		event.Truncated = result.truncated
+		event.Sanitized = result.sanitized
+		b.report(event)
+
+		if split && part.files > 0 && b.exceedsSplit(part, event) {
+			if err := part.finish(); err != nil {
+				return err
+			}
+			if err := part.start(); err != nil {
+				return err
+			}
+		}
+		info := job.info
+		if b.opts.Reproducible {
+			info = undatedInfo{info}
+		}
+		if event.DuplicateOf != "" {
+			info = duplicateInfo{info, event.DuplicateOf}
+		}
+		if b.opts.GoPackageHeaders {
+			// A package split across parts gets a header in each.
+			next := b.order.packages[job]
+			if next != nil && (next != pkg || part.part != pkgPart) {
+				if err := b.format.(packageHeaderWriter).writePackageHeader(part.out, b.packageHeader(next)); err != nil {
+					return err
+				}
+			}
+			pkg, pkgPart = next, part.part
+		}
+		offset := part.offset()
+		if err := b.format.writeFile(part.out, job.path, info, bytes.NewReader(result.content)); err != nil {
+			return fmt.Errorf("writing %s: %w", job.path, err)
+		}
+		if b.opts.Placed != nil {
+			b.opts.Placed(Placement{
+				Path:        job.path,
+				Part:        part.part,
+				Offset:      offset,
+				Length:      part.offset() - offset,
+				Size:        event.Size,
+				SHA256:      sha256.Sum256(result.content),
+				DuplicateOf: event.DuplicateOf,
+			})
+		}
+		part.files++
+		part.bytes += event.Size
+		part.tokens += event.Tokens
+	}
+
+	return part.finish()
+}
+
+// stubDuplicate replaces result's content with a stub when an earlier
+// file in seen had the same content, and returns that file's path. Tiny
+// files cost less than a stub pointing at them, so they are kept, and ""
+// is returned.
+func (b *Bundler) stubDuplicate(seen map[[32]byte]string, path string, result *fileResult) (string, error) {
+	first, ok := seen[result.hash]
+	if !ok {
+		seen[result.hash] = path
+		return "", nil
+	}
+	stub := duplicateStub(first)
+	tokens, err := b.tokens.count(bytes.NewReader(stub))
+	if err != nil {
+		return "", err
+	}
+	if tokens >= result.tokens {
+		return "", nil
+	}
+	result.content, result.tokens, result.redactions = stub, tokens, nil
+	return first, nil
+}
+
+// undatedInfo hides a file's modification time from the formatters, for
+// Options.Reproducible. They write no time for the zero time.
+type undatedInfo struct{ fs.FileInfo }
+
+func (undatedInfo) ModTime() time.Time { return time.Time{} }
+
+// duplicateInfo tells the formatters that a file's content is a stub for
+// the earlier file of, so plain bundles can record it.
+type duplicateInfo struct {
+	fs.FileInfo
+	of string
+}
+
+// duplicateOf returns the path of the file info's content is a stub for,
+// or "".
+func duplicateOf(info fs.FileInfo) string {
+	if d, ok := info.(duplicateInfo); ok {
+		return d.of
+	}
+	return ""
+}
+
+// mtime formats t for the formats that record it, in RFC 3339 in UTC, or
+// returns "" for the zero time.
+func mtime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// duplicateStub is the content written in place of a file identical to
+// first.
+func duplicateStub(first string) []byte {
+	return []byte("identical to " + first + "\n")
+}
+
+// exceedsSplit reports whether adding the file described by e would push
+// the current part past a split limit.
+func (b *Bundler) exceedsSplit(part *partWriter, e Event) bool {
+	if b.opts.SplitBytes > 0 && part.bytes+e.Size > b.opts.SplitBytes {
+		return true
+	}
+	return b.opts.SplitTokens > 0 && part.tokens+e.Tokens > b.opts.SplitTokens
+}
+
+// partWriter tracks the part currently being written.
+type partWriter struct {
+	format formatter
+	next   func() (io.Writer, error)
+
+	out     *bufio.Writer
+	written *trackingWriter // under out, counting what reaches w
+	part    int             // 1-based number of the current part
+	files   int
+	bytes   int64
+	tokens  int
+}
+
+// offset returns the bytes written to the current part so far.
+func (p *partWriter) offset() int64 {
+	return p.written.n + int64(p.out.Buffered())
+}
+
+// start opens the next part and writes the format's preamble.
+func (p *partWriter) start() error {
+	w, err := p.next()
+	if err != nil {
+		return err
+	}
+	p.written = &trackingWriter{w: w}
+	p.out = bufio.NewWriterSize(p.written, 64*1024)
+	p.part++
+	p.files, p.bytes, p.tokens = 0, 0, 0
+	return p.format.begin(p.out)
+}
+
+// finish completes the current part.
+func (p *partWriter) finish() error {
+	if err := p.format.end(p.out); err != nil {
+		return err
+	}
+	return p.out.Flush()
+}
+
+// selectFiles walks src and returns every file that passes the path
+// filters, in walk order. Previous bundles are kept but marked skipped so
+// they are still reported in order.
+func (b *Bundler) selectFiles(ctx context.Context, src *Source) ([]*fileJob, error) {
+	if src.Files != nil {
+		return b.listedFiles(ctx, src)
+	}
+	fsys := src.FS
+	only, onlyDirs := allowSet(src.Only)
+	var ignore *gitIgnore
+	if !b.opts.NoGitignore {
+		ignore = newGitIgnore(fsys, b.opts.GlobalExcludes)
+	}
+	var clapignore *gitIgnore
+	if !b.opts.NoClapignore {
+		clapignore = &gitIgnore{}
+	}
+
+	// dirFilter returns why the directory d at rel is filtered out, or "".
+	dirFilter := func(rel string, d fs.DirEntry) string {
+		name := d.Name()
+		switch {
+		case b.opts.MaxDepth > 0 && strings.Count(rel, "/")+1 >= b.opts.MaxDepth:
+			return FilteredDepth
+		case b.skipDirs[name]:
+			return FilteredDefault
+		case b.excludes.match(rel, true):
+			return FilteredExclude
+		case only != nil && !onlyDirs[rel]:
+			return FilteredNotListed
+		case !b.opts.Hidden && isHidden(d):
+			return FilteredHidden
+		case ignore != nil && (name == ".git" || ignore.match(rel, true)):
+			return FilteredGitignore
+		case clapignore != nil && clapignore.match(rel, true):
+			return FilteredClapignore
+		}
+		return ""
+	}
+	// skipDir reports whether the directory d at rel is filtered out.
+	skipDir := func(rel string, d fs.DirEntry) bool {
+		reason := dirFilter(rel, d)
+		if reason != "" {
+			b.filtered(b.displayPath(src, rel), true, reason)
+		}
+		return reason != ""
+	}
+	// skipFile reports a file filtered out for reason.
+	skipFile := func(rel, reason string) error {
+		b.filtered(b.displayPath(src, rel), false, reason)
+		return nil
+	}
+
+	var prefetch *prefetchFS
+	if b.opts.WalkJobs > 1 {
+		// Directories are read ahead unless dirFilter can already tell
+		// they'll be skipped; the ignore files are left to the walk,
+		// which loads them as it goes, and prunes what they rule out.
+		prefetch = newPrefetchFS(fsys, b.opts.WalkJobs, func(rel string, d fs.DirEntry) bool {
+			name := d.Name()
+			return (b.opts.MaxDepth <= 0 || strings.Count(rel, "/")+1 < b.opts.MaxDepth) &&
+				!b.skipDirs[name] && !(ignore != nil && name == ".git") && !b.excludes.match(rel, true) &&
+				(only == nil || onlyDirs[rel]) && (b.opts.Hidden || !isHidden(d))
+		})
+		defer prefetch.stop()
+		fsys = prefetch
+	}
+
+	// With FollowSymlinks, dirs records every directory walked so far, so a
+	// link back to one of its own ancestors can be recognized.
+	dirs := map[string]fs.FileInfo{}
+
+	var jobs []*fileJob
+	addJob := func(rel string, info fs.FileInfo, skipped string) {
+		jobs = append(jobs, &fileJob{src: src, rel: rel, path: b.displayPath(src, rel), info: info, skipped: skipped, result: make(chan fileResult, 1)})
+	}
+
+	// walkError handles an entry the walk couldn't read. The tree's root
+	// always stops the walk; anything below it only does with FailOnError.
+	walkError := func(rel string, err error) error {
+		if b.opts.FailOnError || rel == "." {
+			return err
+		}
+		b.report(Event{Path: b.displayPath(src, rel), Err: err})
+		return nil
+	}
+
+	var visit fs.WalkDirFunc
+	visit = func(rel string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return walkError(rel, err)
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if rel != "." && skipDir(rel, d) {
+				if prefetch != nil {
+					prefetch.prune(rel)
+				}
+				return fs.SkipDir
+			}
+			if ignore != nil {
+				ignore.loadDir(fsys, rel, ".gitignore")
+			}
+			if clapignore != nil {
+				clapignore.loadDir(fsys, rel, ClapignoreFile)
+			}
+			if b.opts.FollowSymlinks {
+				if info, err := d.Info(); err == nil {
+					dirs[rel] = info
+				}
+			}
+			return nil
+		}
+
+		// Links are judged by what they point to. A link to a directory is
+		// filtered like one, then either walked or reported. Windows
+		// junctions, which Go reports as irregular files, count as links,
+		// so a junction to an ancestor can't loop the walk either.
+		var target fs.FileInfo
+		var dangling bool
+		if d.Type()&(fs.ModeSymlink|fs.ModeIrregular) != 0 {
+			if target, err = fs.Stat(fsys, rel); err != nil {
+				target, dangling = nil, true
+			}
+		}
+		if target != nil && target.IsDir() {
+			if skipDir(rel, d) {
+				return nil
+			}
+			link, err := d.Info()
+			if err != nil {
+				return walkError(rel, err)
+			}
+			switch {
+			case !b.opts.FollowSymlinks:
+				addJob(rel, link, SkippedSymlinkDir)
+			case isAncestor(dirs, rel, target):
+				addJob(rel, link, SkippedSymlinkLoop)
+			default:
+				return fs.WalkDir(fsys, rel, visit)
+			}
+			return nil
+		}
+
+		if only != nil && !only[rel] {
+			return skipFile(rel, FilteredNotListed)
+		}
+		if !b.opts.Hidden && isHidden(d) {
+			return skipFile(rel, FilteredHidden)
+		}
+		if b.excludes.match(rel, false) {
+			return skipFile(rel, FilteredExclude)
+		}
+		if ignore != nil && ignore.match(rel, false) {
+			return skipFile(rel, FilteredGitignore)
+		}
+		if clapignore != nil && clapignore.match(rel, false) {
+			return skipFile(rel, FilteredClapignore)
+		}
+		if !shouldPrintFile(rel, b.extensions, b.names) {
+			return skipFile(rel, FilteredExtension)
+		}
+		if b.include != nil && !matchRegexps(b.include, rel) || matchRegexps(b.exclude, rel) {
+			return skipFile(rel, FilteredRegexp)
+		}
+
+		info := target
+		if info == nil {
+			if info, err = d.Info(); err != nil {
+				return walkError(rel, err)
+			}
+		}
+
+		// The output file may live inside the tree; never read it back.
+		if b.opts.Output != nil && os.SameFile(info, b.opts.Output) {
+			return skipFile(rel, FilteredOutput)
+		}
+		if mtime := info.ModTime(); !b.opts.NewerThan.IsZero() && !mtime.After(b.opts.NewerThan) || !b.opts.OlderThan.IsZero() && !mtime.Before(b.opts.OlderThan) {
+			return skipFile(rel, FilteredMtime)
+		}
+
+		switch {
+		case dangling:
+			addJob(rel, info, SkippedDanglingLink)
+		case b.previous.match(rel, false):
+			addJob(rel, info, SkippedPrevious)
+		case b.opts.MaxSize > 0 && info.Size() > b.opts.MaxSize:
+			addJob(rel, info, SkippedTooLarge)
+		default:
+			addJob(rel, info, "")
+		}
+		return nil
+	}
+
+	err := fs.WalkDir(fsys, ".", visit)
+	return jobs, err
+}
+
+// listedFiles returns the jobs for src.Files, in order, without walking.
+// Missing files and directories are reported like unreadable ones, and a
+// file listed twice is only bundled once.
+func (b *Bundler) listedFiles(ctx context.Context, src *Source) ([]*fileJob, error) {
+	var jobs []*fileJob
+	seen := map[string]bool{}
+	for _, rel := range src.Files {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		rel = path.Clean(rel)
+		if seen[rel] {
+			continue
+		}
+		seen[rel] = true
+
+		display := b.displayPath(src, rel)
+		info, err := fs.Stat(src.FS, rel)
+		if err == nil && info.IsDir() {
+			err = errors.New("is a directory")
+		}
+		if err != nil {
+			if b.opts.FailOnError {
+				return nil, err
+			}
+			b.report(Event{Path: display, Err: err})
+			continue
+		}
+		if b.opts.Output != nil && os.SameFile(info, b.opts.Output) {
+			b.filtered(display, false, FilteredOutput)
+			continue
+		}
+		jobs = append(jobs, &fileJob{src: src, rel: rel, path: display, info: info, result: make(chan fileResult, 1)})
+	}
+	return jobs, nil
+}
+
+// isAncestor reports whether target is the same directory as one of the
+// directories leading to rel, so following it would loop forever.
+func isAncestor(dirs map[string]fs.FileInfo, rel string, target fs.FileInfo) bool {
+	for dir := path.Dir(rel); ; dir = path.Dir(dir) {
+		if info, ok := dirs[dir]; ok && os.SameFile(info, target) {
+			return true
+		}
+		if dir == "." {
+			return false
+		}
+	}
+}
+
+// allowSet indexes a Source.Only list, along with every directory that
+// leads to one of its files so the walk can prune the rest. Both maps are
+// nil when files is nil.
+func allowSet(files []string) (only, dirs map[string]bool) {
+	if files == nil {
+		return nil, nil
+	}
+	only = make(map[string]bool, len(files))
+	dirs = map[string]bool{}
+	for _, file := range files {
+		file = path.Clean(file)
+		only[file] = true
+		for dir := path.Dir(file); dir != "." && !dirs[dir]; dir = path.Dir(dir) {
+			dirs[dir] = true
+		}
+	}
+	return only, dirs
+}
+
+// displayPath returns the path headers and events show for rel in src.
+func (b *Bundler) displayPath(src *Source, rel string) string {
+	path := stripPrefix(displayPath(src.Root, rel), b.opts.StripPrefix)
+	if b.opts.Anonymize != nil {
+		path = b.opts.Anonymize.Path(path)
+	}
+	return path
+}
+
+// displayPath joins rel onto root using host path separators.
+func displayPath(root, rel string) string {
+	if root == "" {
+		return rel
+	}
+	return filepath.Join(root, filepath.FromSlash(rel))
+}
+
+// stripPrefix removes the directory prefix from the start of path, whole
+// segments only. It returns "" if path is prefix itself.
+func stripPrefix(path, prefix string) string {
+	if prefix == "" {
+		return path
+	}
+	path, prefix = filepath.Clean(path), filepath.Clean(prefix)
+	if path == prefix {
+		return ""
+	}
+	if rest, ok := strings.CutPrefix(path, strings.TrimSuffix(prefix, string(filepath.Separator))+string(filepath.Separator)); ok {
+		return rest
+	}
+	return path
+}
+
+// filtered forwards a filter decision to Options.Filtered, if set.
+func (b *Bundler) filtered(path string, dir bool, reason string) {
+	if b.opts.Filtered != nil {
+		b.opts.Filtered(path, dir, reason)
+	}
+}
+
+// report forwards an event to Options.Report, if set.
+func (b *Bundler) report(e Event) {
+	if b.opts.Report != nil {
+		b.opts.Report(e)
+	}
+}
+
+// normalizeExtensions converts extensions to a map with leading dots and lowercase.
+// Returns nil if no extensions provided (accept all files).
+func normalizeExtensions(extensions []string) map[string]bool {
+	if len(extensions) == 0 {
+		return nil
+	}
+
+	extMap := make(map[string]bool, len(extensions))
+	for _, ext := range extensions {
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		extMap[strings.ToLower(ext)] = true
+	}
+	return extMap
+}
+
+// normalizeNames converts names to a lowercase set, or nil if there are
+// none.
+func normalizeNames(names []string) map[string]bool {
+	if len(names) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[strings.ToLower(name)] = true
+	}
+	return set
+}
+
+// shouldPrintFile returns true if the file matches the extension filter
+// or is one of names. If extensions is nil, all files are included.
+func shouldPrintFile(filePath string, extensions, names map[string]bool) bool {
+	if extensions == nil {
+		return true
+	}
+	ext := strings.ToLower(path.Ext(filePath))
+	return extensions[ext] || names[strings.ToLower(path.Base(filePath))]
+}
@@ -0,0 +1,94 @@
+package clap
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// irregularFS reports the symlinks of an os.DirFS tree as irregular
+// files, the way Go sees Windows junctions.
+type irregularFS struct{ fs.FS }
+
+func (f irregularFS) Stat(name string) (fs.FileInfo, error) { return fs.Stat(f.FS, name) }
+
+func (f irregularFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := fs.ReadDir(f.FS, name)
+	for i, e := range entries {
+		if e.Type()&fs.ModeSymlink != 0 {
+			entries[i] = irregularEntry{e}
+		}
+	}
+	return entries, err
+}
+
+type irregularEntry struct{ fs.DirEntry }
+
+func (e irregularEntry) Type() fs.FileMode { return fs.ModeIrregular }
+
+func TestWalkLinkLoop(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "src", "pkg"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "src", "pkg", "main.go"), []byte("package main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("..", filepath.Join(dir, "src", "pkg", "up")); err != nil {
+		t.Skipf("can't create symlinks: %v", err)
+	}
+	if err := os.Symlink("pkg", filepath.Join(dir, "src", "next")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		fsys   fs.FS
+		follow bool
+		want   map[string]string // path to Event.Skipped
+	}{
+		{"not followed", os.DirFS(dir), false, map[string]string{
+			"src/next":        SkippedSymlinkDir,
+			"src/pkg/main.go": "",
+			"src/pkg/up":      SkippedSymlinkDir,
+		}},
+		{"symlink", os.DirFS(dir), true, map[string]string{
+			"src/next/main.go": "",
+			"src/next/up":      SkippedSymlinkLoop,
+			"src/pkg/main.go":  "",
+			"src/pkg/up":       SkippedSymlinkLoop,
+		}},
+		{"junction", irregularFS{os.DirFS(dir)}, true, map[string]string{
+			"src/next/main.go": "",
+			"src/next/up":      SkippedSymlinkLoop,
+			"src/pkg/main.go":  "",
+			"src/pkg/up":       SkippedSymlinkLoop,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := map[string]string{}
+			b, err := New(Options{
+				FollowSymlinks: tt.follow,
+				Report:         func(e Event) { got[e.Path] = e.Skipped },
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := b.Run(context.Background(), tt.fsys, io.Discard); err != nil {
+				t.Fatal(err)
+			}
+			for path, skipped := range tt.want {
+				if s, ok := got[path]; !ok || s != skipped {
+					t.Errorf("%s: skipped %q (reported %v), want %q", path, s, ok, skipped)
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("reported %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package clap
+
+import (
+	"bytes"
+	"path"
+	"strings"
+)
+
+// commentSyntax describes how one family of languages writes comments
+// and the string literals comment markers may hide in.
+type commentSyntax struct {
+	line       []string // line comment markers
+	blockStart string
+	blockEnd   string
+	quotes     string // characters that open a string, closed by the same
+	raw        string // quotes whose strings have no escapes
+	triple     bool   // """ and ''' open strings that span lines
+	wordStart  bool   // line markers only count at the start of a word
+}
+
+var (
+	cSyntax      = &commentSyntax{line: []string{"//"}, blockStart: "/*", blockEnd: "*/", quotes: `"'`}
+	goSyntax     = &commentSyntax{line: []string{"//"}, blockStart: "/*", blockEnd: "*/", quotes: "\"'`", raw: "`"}
+	jsSyntax     = &commentSyntax{line: []string{"//"}, blockStart: "/*", blockEnd: "*/", quotes: "\"'`"}
+	cssSyntax    = &commentSyntax{blockStart: "/*", blockEnd: "*/", quotes: `"'`}
+	scssSyntax   = &commentSyntax{line: []string{"//"}, blockStart: "/*", blockEnd: "*/", quotes: `"'`, wordStart: true} // so url(//cdn/x.png) survives
+	hashSyntax   = &commentSyntax{line: []string{"#"}, quotes: `"'`, wordStart: true}
+	pythonSyntax = &commentSyntax{line: []string{"#"}, quotes: `"'`, triple: true}
+	sqlSyntax    = &commentSyntax{line: []string{"--"}, blockStart: "/*", blockEnd: "*/", quotes: `"'`}
+	htmlSyntax   = &commentSyntax{blockStart: "<!--", blockEnd: "-->"}
+)
+
+// commentSyntaxes maps file extensions to their comment syntax.
+// Extensions not listed are bundled unchanged by Options.StripComments.
+var commentSyntaxes = map[string]*commentSyntax{
+	".go": goSyntax,
+
+	".js": jsSyntax, ".jsx": jsSyntax, ".mjs": jsSyntax, ".cjs": jsSyntax,
+	".ts": jsSyntax, ".tsx": jsSyntax,
+
+	".c": cSyntax, ".h": cSyntax, ".cc": cSyntax, ".cpp": cSyntax, ".hpp": cSyntax,
+	".cs": cSyntax, ".java": cSyntax, ".kt": cSyntax, ".scala": cSyntax,
+	".rs": cSyntax, ".swift": cSyntax, ".dart": cSyntax, ".php": cSyntax,
+
+	".css": cssSyntax, ".scss": scssSyntax, ".less": scssSyntax,
+
+	".py": pythonSyntax,
+
+	".sh": hashSyntax, ".bash": hashSyntax, ".zsh": hashSyntax, ".fish": hashSyntax,
+	".rb": hashSyntax, ".pl": hashSyntax, ".r": hashSyntax,
+	".yaml": hashSyntax, ".yml": hashSyntax, ".toml": hashSyntax,
+
+	".sql": sqlSyntax,
+
+	".html": htmlSyntax, ".htm": htmlSyntax, ".xml": htmlSyntax, ".svg": htmlSyntax, ".vue": htmlSyntax,
+}
+
+// stripComments removes comments from content according to the syntax
+// for name's extension. Lines left blank by the removal are dropped, and
+// lines that must survive (shebangs, Go build and generate directives) are
+// kept.
+func stripComments(name string, content []byte) []byte {
+	syntax := commentSyntaxes[strings.ToLower(path.Ext(name))]
+	if syntax == nil {
+		return content
+	}
+	return syntax.strip(content)
+}
+
+// strip removes every comment in src outside of string literals.
+func (s *commentSyntax) strip(src []byte) []byte {
+	var out, line bytes.Buffer
+	stripped := false // line had a comment removed
+
+	// flush ends the current line. A line that held only a comment goes
+	// away entirely; otherwise trailing space left by the comment does.
+	flush := func() bool {
+		text := line.Bytes()
+		if stripped {
+			text = bytes.TrimRight(text, " \t")
+		}
+		kept := !stripped || len(text) > 0
+		if kept {
+			out.Write(text)
+			out.WriteByte('\n')
+		}
+		line.Reset()
+		stripped = false
+		return kept
+	}
+
+	for i := 0; i < len(src); {
+		c := src[i]
+		rest := src[i:]
+		atLineStart := line.Len() == 0 && (i == 0 || src[i-1] == '\n')
+
+		switch {
+		case c == '\n':
+			flush()
+			i++
+
+		case s.keepLine(rest, i == 0, atLineStart):
+			end := bytes.IndexByte(rest, '\n')
+			if end < 0 {
+				end = len(rest)
+			}
+			line.Write(rest[:end])
+			i += end
+
+		case s.blockStart != "" && bytes.HasPrefix(rest, []byte(s.blockStart)):
+			end := bytes.Index(rest[len(s.blockStart):], []byte(s.blockEnd))
+			if end < 0 {
+				i = len(src)
+			} else {
+				i += len(s.blockStart) + end + len(s.blockEnd)
+			}
+			stripped = true
+
+		case s.isLineComment(src, i):
+			end := bytes.IndexByte(rest, '\n')
+			if end < 0 {
+				end = len(rest)
+			}
+			i += end
+			stripped = true
+
+		case strings.IndexByte(s.quotes, c) >= 0:
+			n := s.stringLen(rest)
+			line.Write(rest[:n])
+			i += n
+
+		default:
+			line.WriteByte(c)
+			i++
+		}
+	}
+
+	// The source didn't end in a newline; neither should the result.
+	if (line.Len() > 0 || stripped) && flush() {
+		out.Truncate(out.Len() - 1)
+	}
+	return out.Bytes()
+}
+
+// keepLine reports whether the line starting at rest is a comment that
+// must not be removed.
+func (s *commentSyntax) keepLine(rest []byte, first, atLineStart bool) bool {
+	if first && bytes.HasPrefix(rest, []byte("#!")) {
+		return true
+	}
+	if s != goSyntax || !atLineStart {
+		return false
+	}
+	return bytes.HasPrefix(rest, []byte("//go:")) || bytes.HasPrefix(rest, []byte("// +build"))
+}
+
+// isLineComment reports whether a line comment starts at src[i].
+func (s *commentSyntax) isLineComment(src []byte, i int) bool {
+	for _, marker := range s.line {
+		if !bytes.HasPrefix(src[i:], []byte(marker)) {
+			continue
+		}
+		if !s.wordStart || i == 0 || src[i-1] == ' ' || src[i-1] == '\t' || src[i-1] == '\n' {
+			return true
+		}
+	}
+	return false
+}
+
+// stringLen returns the length of the string literal at the start of
+// rest, including its quotes. An unterminated string runs to the end of
+// the line, or of the input for triple-quoted and raw strings.
+func (s *commentSyntax) stringLen(rest []byte) int {
+	quote := rest[0]
+	if s.triple && len(rest) >= 3 && rest[1] == quote && rest[2] == quote {
+		end := bytes.Index(rest[3:], rest[:3])
+		if end < 0 {
+			return len(rest)
+		}
+		return 3 + end + 3
+	}
+
+	raw := strings.IndexByte(s.raw, quote) >= 0
+	for i := 1; i < len(rest); i++ {
+		switch {
+		case rest[i] == '\\' && !raw:
+			i++
+		case rest[i] == quote:
+			return i + 1
+		case rest[i] == '\n' && !raw && quote != '`':
+			return i
+		}
+	}
+	return len(rest)
+}
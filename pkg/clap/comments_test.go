@@ -0,0 +1,30 @@
+package clap
+
+import "testing"
+
+func TestStripComments(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"a.go", "package a // trailing\n// whole line\nvar s = \"http://x\" // c\n", "package a\nvar s = \"http://x\"\n"},
+		{"a.go", "//go:build linux\n\npackage a\n", "//go:build linux\n\npackage a\n"},
+		{"a.go", "var r = `raw // not a comment`\n", "var r = `raw // not a comment`\n"},
+		{"a.js", "a = 'it\\'s // fine' /* block */ + 1\n", "a = 'it\\'s // fine'  + 1\n"},
+		{"a.py", "#!/usr/bin/env python\nx = '#' # note\ns = \"\"\"\n# kept\n\"\"\"\n", "#!/usr/bin/env python\nx = '#'\ns = \"\"\"\n# kept\n\"\"\"\n"},
+		{"a.sh", "echo a#b # note\n", "echo a#b\n"},
+		{"a.css", "a { color: red; } /* note */\n", "a { color: red; }\n"},
+		{"a.css", "a { background: url(//cdn.example.com/x.png); }\n", "a { background: url(//cdn.example.com/x.png); }\n"},
+		{"a.scss", "a { background: url(//cdn.example.com/x.png); } // note\n", "a { background: url(//cdn.example.com/x.png); }\n"},
+		{"a.scss", "// whole line\n$cdn: \"http://cdn.example.com\"; // note\n", "$cdn: \"http://cdn.example.com\";\n"},
+		{"a.less", "@font: url('//fonts.example.com/a.woff');\n.b{c:url(http://x/y)}\n", "@font: url('//fonts.example.com/a.woff');\n.b{c:url(http://x/y)}\n"},
+		{"a.sql", "select 1 -- one\n", "select 1\n"},
+		{"a.html", "<p>a</p><!-- note -->\n", "<p>a</p>\n"},
+		{"a.txt", "// not code\n", "// not code\n"},
+		{"a.go", "x := 1 // no newline", "x := 1"},
+	}
+	for _, tt := range tests {
+		if got := string(stripComments(tt.name, []byte(tt.in))); got != tt.want {
+			t.Errorf("stripComments(%s, %q) = %q, want %q", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
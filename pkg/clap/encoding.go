@@ -0,0 +1,88 @@
+package clap
+
+import (
+	"bytes"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// Source encodings reported in Event.Encoding.
+const (
+	EncodingUTF8BOM     = "utf-8 with bom"
+	EncodingUTF16LE     = "utf-16le"
+	EncodingUTF16BE     = "utf-16be"
+	EncodingShiftJIS    = "shift-jis"
+	EncodingWindows1252 = "windows-1252"
+)
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// hasUTF16BOM reports whether head starts with a UTF-16 byte order mark.
+// Such files are full of NUL bytes but are still text.
+func hasUTF16BOM(head []byte) bool {
+	return bytes.HasPrefix(head, bomUTF16LE) || bytes.HasPrefix(head, bomUTF16BE)
+}
+
+// toUTF8 transcodes content to UTF-8 and drops any byte order mark. It
+// returns the encoding it converted from, or "" when content was already
+// plain UTF-8.
+//
+// UTF-16 is only recognized by its BOM. Anything else that isn't valid
+// UTF-8 is read as Shift-JIS when it decodes cleanly into mostly Japanese
+// text, and as Windows-1252, the superset of Latin-1 that most "Latin-1"
+// files really are, otherwise.
+func toUTF8(content []byte) ([]byte, string) {
+	switch {
+	case bytes.HasPrefix(content, bomUTF8):
+		return content[len(bomUTF8):], EncodingUTF8BOM
+	case bytes.HasPrefix(content, bomUTF16LE):
+		return decode(unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM), content), EncodingUTF16LE
+	case bytes.HasPrefix(content, bomUTF16BE):
+		return decode(unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM), content), EncodingUTF16BE
+	case utf8.Valid(content):
+		return content, ""
+	}
+
+	if text := decode(japanese.ShiftJIS, content); looksJapanese(text) {
+		return text, EncodingShiftJIS
+	}
+	return decode(charmap.Windows1252, content), EncodingWindows1252
+}
+
+// decode converts content from enc, replacing invalid sequences with
+// U+FFFD.
+func decode(enc encoding.Encoding, content []byte) []byte {
+	text, err := enc.NewDecoder().Bytes(content)
+	if err != nil {
+		return bytes.ToValidUTF8(content, []byte("�"))
+	}
+	return text
+}
+
+// looksJapanese reports whether text decoded without errors and at least
+// half of its non-ASCII characters are kana, CJK punctuation, or full-width
+// forms. Latin-1 accented letters decoded as Shift-JIS turn into kanji and
+// half-width katakana instead, so they fail the test.
+func looksJapanese(text []byte) bool {
+	var japanese, other int
+	for _, r := range string(text) {
+		switch {
+		case r == utf8.RuneError:
+			return false
+		case r < utf8.RuneSelf:
+		case r >= 0x3000 && r <= 0x30FF, r >= 0xFF01 && r <= 0xFF5E:
+			japanese++
+		default:
+			other++
+		}
+	}
+	return japanese > 0 && japanese >= other
+}
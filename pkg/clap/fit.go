@@ -0,0 +1,276 @@
+package clap
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"io/fs"
+	"slices"
+)
+
+// readAhead reads every selected file that hasn't been read yet ahead of
+// the writer, keeping the results on the jobs.
+func (b *Bundler) readAhead(ctx context.Context, readers *fileReader, jobs []*fileJob) error {
+	work := readers.startReaders(b.opts.Jobs)
+	go func() {
+		defer close(work)
+		for _, job := range jobs {
+			if job.skipped != "" || job.pre != nil {
+				continue
+			}
+			select {
+			case work <- job:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for _, job := range jobs {
+		if job.skipped != "" || job.pre != nil {
+			continue
+		}
+		select {
+		case result := <-job.result:
+			job.pre = &result
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// fit reads every selected file ahead of the writer and, if the bundle
+// would exceed Options.FitTokens, marks files SkippedOverBudget until it
+// fits: the lightest files by Options.Weights first, then within a weight,
+// test files, files matching no FitPriority pattern, and the priority
+// files from the last pattern to the first, the largest first within
+// each group. When less than a whole file needs to go, that file is
+// truncated instead. Results are kept on the jobs for the writer.
+//
+// The budget counts what the writer will write: the format's preamble and
+// the tree, each file's header, and content, with a copy that dedupe
+// replaces by a stub costing only the stub. A file that kept copies point
+// to is never truncated or dropped: its copies go first.
+func (b *Bundler) fit(ctx context.Context, readers *fileReader, sources []Source, jobs []*fileJob) error {
+	if err := b.readAhead(ctx, readers, jobs); err != nil {
+		return err
+	}
+
+	var kept []*fileJob
+	for _, job := range jobs {
+		if job.skipped == "" && job.pre.err == nil && job.pre.skipped == "" {
+			kept = append(kept, job)
+		}
+	}
+	files, err := b.fitFiles(kept, readers.dedupe)
+	if err != nil {
+		return err
+	}
+	total, err := b.fitOverhead(sources, jobs)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		total += f.cost()
+	}
+	if total <= b.opts.FitTokens {
+		return nil
+	}
+
+	// rank is 0 for tests, 1 for other files, and higher for earlier
+	// FitPriority patterns. Lower ranks go first.
+	rank := func(job *fileJob) int {
+		if i := matchAny(b.fitPriority, job.rel); i >= 0 {
+			return 1 + len(b.fitPriority) - i
+		}
+		if matchAny([]*gitIgnore{b.fitTests}, job.rel) >= 0 {
+			return 0
+		}
+		return 1
+	}
+	// A file goes no earlier than the most important of its copies, since
+	// dropping it drops them.
+	type key struct{ weight, rank int }
+	keys := make(map[*fitFile]key, len(files))
+	for _, f := range files {
+		keys[f] = key{b.order.weightOf(f.job), rank(f.job)}
+	}
+	for _, f := range files {
+		if o := f.original; o != nil {
+			k := keys[o]
+			keys[o] = key{max(k.weight, keys[f].weight), max(k.rank, keys[f].rank)}
+		}
+	}
+	slices.SortStableFunc(files, func(x, y *fitFile) int {
+		kx, ky := keys[x], keys[y]
+		if c := cmp.Compare(kx.weight, ky.weight); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(kx.rank, ky.rank); c != 0 {
+			return c
+		}
+		return cmp.Compare(y.tokens, x.tokens)
+	})
+
+	drop := func(f *fitFile) {
+		total -= f.cost()
+		f.job.skipped = SkippedOverBudget
+		if o := f.original; o != nil {
+			o.copies = slices.DeleteFunc(o.copies, func(c *fitFile) bool { return c == f })
+		}
+	}
+	for _, f := range files {
+		over := total - b.opts.FitTokens
+		if over <= 0 {
+			break
+		}
+		if f.job.skipped != "" {
+			continue
+		}
+		// Its copies are cheap, so they go first, the last one first.
+		for len(f.copies) > 0 && over > 0 {
+			drop(f.copies[len(f.copies)-1])
+			over = total - b.opts.FitTokens
+		}
+		if over <= 0 {
+			break
+		}
+		if f.tokens > over {
+			tokens := f.job.pre.tokens
+			shrunk, err := b.shrink(f.job.pre, tokens-over, readers.dedupe)
+			if err != nil {
+				return err
+			}
+			if shrunk {
+				total -= tokens - f.job.pre.tokens
+				f.tokens = f.job.pre.tokens
+				continue
+			}
+		}
+		drop(f)
+	}
+	return nil
+}
+
+// fitFile is a file that counts against Options.FitTokens.
+type fitFile struct {
+	job      *fileJob
+	tokens   int        // of its content, or of its stub if it's a copy
+	header   int        // of the rest of its section, escaping included
+	original *fitFile   // the file this one is a stubbed copy of, or nil
+	copies   []*fitFile // kept files stubbed as copies of this one
+}
+
+// cost returns the tokens f adds to the bundle.
+func (f *fitFile) cost() int { return f.tokens + f.header }
+
+// fitFiles returns the files the writer would bundle from jobs, in bundle
+// order, working out as it does which copies dedupe would stub.
+func (b *Bundler) fitFiles(jobs []*fileJob, dedupe bool) ([]*fitFile, error) {
+	format, err := newBundleFormatter(b.opts, b.opts.Format)
+	if err != nil {
+		return nil, err
+	}
+	var files []*fitFile
+	first := map[[32]byte]*fitFile{}
+	for _, job := range b.order.apply(jobs) {
+		f := &fitFile{job: job, tokens: job.pre.tokens}
+		info, content := job.info, job.pre.content
+		if b.opts.Reproducible {
+			info = undatedInfo{info}
+		}
+		if original, ok := first[job.pre.hash]; dedupe && ok {
+			stub := duplicateStub(original.job.path)
+			tokens, err := b.tokens.count(bytes.NewReader(stub))
+			if err != nil {
+				return nil, err
+			}
+			if tokens < f.tokens {
+				f.tokens, f.original = tokens, original
+				original.copies = append(original.copies, f)
+				info, content = duplicateInfo{info, original.job.path}, stub
+			}
+		} else if dedupe {
+			first[job.pre.hash] = f
+		}
+		if f.header, err = b.fitHeader(format, job.path, info, content, f.tokens); err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// fitHeader returns the tokens a file's section takes beyond the tokens
+// of its content: the header and metadata, and whatever escaping the
+// format adds.
+func (b *Bundler) fitHeader(format formatter, path string, info fs.FileInfo, content []byte, tokens int) (int, error) {
+	if isArchive(format) {
+		return 0, nil
+	}
+	var buf bytes.Buffer
+	if err := format.writeFile(&buf, path, info, bytes.NewReader(content)); err != nil {
+		return 0, err
+	}
+	section, err := b.tokens.count(&buf)
+	return max(section-tokens, 0), err
+}
+
+// fitOverhead returns the tokens the bundle takes besides its files: the
+// format's preamble and closing, and the tree of every file selected, an
+// upper bound on the tree of those that fit. With RunFormats, it counts
+// them as Options.Format writes them.
+func (b *Bundler) fitOverhead(sources []Source, jobs []*fileJob) (int, error) {
+	if isArchive(b.format) {
+		return 0, nil
+	}
+	format, err := newBundleFormatter(b.opts, b.opts.Format)
+	if err != nil {
+		return 0, err
+	}
+	var buf bytes.Buffer
+	if err := format.begin(&buf); err != nil {
+		return 0, err
+	}
+	if b.opts.Tree {
+		if err := format.writeTree(&buf, renderTree(sources, jobs, b.opts.StripPrefix, b.opts.Anonymize)); err != nil {
+			return 0, err
+		}
+	}
+	if err := format.end(&buf); err != nil {
+		return 0, err
+	}
+	return b.tokens.count(&buf)
+}
+
+// shrink truncates result's content to at most target tokens, and reports
+// whether anything was left. Token counts aren't proportional to bytes, so
+// it narrows in over a few tries.
+func (b *Bundler) shrink(result *fileResult, target int, rehash bool) (bool, error) {
+	content := result.content
+	keep := int64(len(content)) * int64(target) / int64(result.tokens)
+	for range 5 {
+		if keep <= 0 {
+			return false, nil
+		}
+		cut, ok := truncator{bytes: keep, tail: b.opts.TruncateTail}.truncate(content)
+		if !ok {
+			return false, nil
+		}
+		tokens, err := b.tokens.count(bytes.NewReader(cut))
+		if err != nil {
+			return false, err
+		}
+		if tokens <= target {
+			result.content, result.tokens, result.truncated = cut, tokens, true
+			if rehash {
+				result.hash = sha256.Sum256(cut)
+			}
+			return true, nil
+		}
+		keep = keep * int64(target) / int64(tokens) * 9 / 10
+	}
+	return false, nil
+}
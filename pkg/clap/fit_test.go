@@ -0,0 +1,93 @@
+package clap
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// bundleTokens bundles fsys with opts and returns the output, its tokens,
+// and the events reported by path.
+func bundleTokens(t *testing.T, fsys fstest.MapFS, opts Options) (string, int, map[string]Event) {
+	t.Helper()
+	events := map[string]Event{}
+	opts.Report = func(e Event) { events[e.Path] = e }
+	b, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := b.Run(context.Background(), fsys, &buf); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := b.tokens.count(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.String(), tokens, events
+}
+
+func TestFitDuplicates(t *testing.T) {
+	var body strings.Builder
+	for i := range 60 {
+		fmt.Fprintf(&body, "line %d alpha beta gamma delta\n", i)
+	}
+	fsys := fstest.MapFS{}
+	for i := 1; i <= 8; i++ {
+		fsys[fmt.Sprintf("f%d.txt", i)] = &fstest.MapFile{Data: []byte(body.String())}
+	}
+	_, full, _ := bundleTokens(t, fsys, Options{})
+
+	for _, budget := range []int{1500, full, full - 20, 450, 200} {
+		t.Run(fmt.Sprint(budget), func(t *testing.T) {
+			out, tokens, events := bundleTokens(t, fsys, Options{FitTokens: budget})
+			if tokens > budget {
+				t.Errorf("bundle has %d tokens, over the budget", tokens)
+			}
+			dropped := 0
+			for _, e := range events {
+				if e.Skipped == SkippedOverBudget {
+					dropped++
+				}
+			}
+			switch {
+			case budget >= full && dropped > 0:
+				t.Errorf("dropped %d files, but the deduplicated bundle fits in %d tokens", dropped, full)
+			case budget < full && dropped == 0:
+				t.Errorf("dropped nothing, though the bundle needs %d tokens", full)
+			}
+			// Every stub's original is still there, in full.
+			err := ReadBundleFiles(strings.NewReader(out), func(f BundleFile) error {
+				if f.DuplicateOf != "" && string(f.Content) != string(fsys[f.DuplicateOf].Data) && !events[f.DuplicateOf].Truncated {
+					return fmt.Errorf("%s: content of %s doesn't match", f.Path, f.DuplicateOf)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+			if events["f1.txt"].Truncated && strings.Contains(out, "duplicate_of") {
+				t.Error("truncated a file that copies still point to")
+			}
+		})
+	}
+}
+
+func TestFitHeaders(t *testing.T) {
+	// Many small files, where headers and the tree cost more than content.
+	fsys := fstest.MapFS{}
+	for i := range 40 {
+		fsys[fmt.Sprintf("pkg/dir%02d/file%02d.txt", i, i)] = &fstest.MapFile{Data: []byte(fmt.Sprintf("%d\n", i))}
+	}
+	for _, opts := range []Options{{}, {Tree: true}, {Format: "json", HeaderMeta: []string{MetaSize, MetaSHA256}}} {
+		_, full, _ := bundleTokens(t, fsys, opts)
+		opts.FitTokens = full * 2 / 3
+		_, tokens, _ := bundleTokens(t, fsys, opts)
+		if tokens > opts.FitTokens {
+			t.Errorf("format %q, tree %v: bundle has %d tokens, over the budget of %d", opts.Format, opts.Tree, tokens, opts.FitTokens)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package clap
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"strconv"
+	"strings"
+)
+
+// formatter renders the bundle. begin and end wrap the whole output,
+// writeTree (when enabled) follows begin, and writeFile is called once per
+// included file, in walk order. Content is streamed from r; formatters that
+// need to inspect it first may seek back to the start.
+type formatter interface {
+	begin(w io.Writer) error
+	writeTree(w io.Writer, tree string) error
+	partHeader(part, total int) string
+	writeFile(w io.Writer, path string, info fs.FileInfo, r io.ReadSeeker) error
+	end(w io.Writer) error
+}
+
+// formatOptions are the Options that text formatters share.
+type formatOptions struct {
+	langs languages
+	meta  []string // Options.HeaderMeta, normalized
+	safe  bool     // Options.Framing is FramingSafe; plain only
+}
+
+// describe returns the metadata to write for a file.
+func (o formatOptions) describe(path string, info fs.FileInfo, r io.ReadSeeker) ([]fileMeta, error) {
+	return describe(o.meta, o.langs, path, info, r)
+}
+
+// plainMeta is describe, followed by MetaDuplicateOf for a deduplicated
+// copy, so ReadBundleFiles can give it back its original's content.
+func (o formatOptions) plainMeta(path string, info fs.FileInfo, r io.ReadSeeker) ([]fileMeta, error) {
+	meta, err := o.describe(path, info, r)
+	if first := duplicateOf(info); first != "" && err == nil {
+		meta = append(meta, fileMeta{MetaDuplicateOf, first})
+	}
+	return meta, err
+}
+
+// newFormatter returns the formatter registered under name.
+func newFormatter(name string, fo formatOptions) (formatter, error) {
+	switch name {
+	case "", "plain":
+		return plainFormatter{fo}, nil
+	case "markdown", "md":
+		return markdownFormatter{fo}, nil
+	case "json":
+		return &jsonFormatter{formatOptions: fo}, nil
+	case "jsonl", "ndjson":
+		return &jsonlFormatter{formatOptions: fo}, nil
+	case "html":
+		return &htmlFormatter{formatOptions: fo}, nil
+	case "xml-docs", "xml":
+		return &xmlDocsFormatter{formatOptions: fo}, nil
+	case "zip":
+		return &zipFormatter{}, nil
+	case "sqlite":
+		return &sqliteFormatter{}, nil
+	case "tar.gz", "tgz":
+		return &tarFormatter{}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q (want plain, markdown, json, jsonl, html, xml-docs, zip, tar.gz, or sqlite)", name)
+}
+
+// plainFormatter writes the original "=== path ===" delimited layout, which
+// ReadBundle can parse back. Metadata, if any, follows the header on a
+// line of its own.
+type plainFormatter struct {
+	formatOptions
+}
+
+func (plainFormatter) begin(w io.Writer) error { return nil }
+
+// writeTree writes the tree as-is; ReadBundle ignores text before the
+// first header.
+func (plainFormatter) writeTree(w io.Writer, tree string) error {
+	_, err := fmt.Fprintf(w, "%s\n", tree)
+	return err
+}
+
+// writeFrontMatter writes the block as-is, like the tree.
+func (plainFormatter) writeFrontMatter(w io.Writer, block string) error {
+	_, err := io.WriteString(w, block)
+	return err
+}
+
+// partHeader is plain text, which ReadBundle skips like any text before the
+// first file header.
+func (plainFormatter) partHeader(part, total int) string {
+	return fmt.Sprintf("--- part %d/%d ---\n\n", part, total)
+}
+
+func (f plainFormatter) writeFile(w io.Writer, path string, info fs.FileInfo, r io.ReadSeeker) error {
+	if f.safe {
+		return f.writeSafe(w, path, info, r)
+	}
+	if _, err := fmt.Fprintf(w, "%s%s%s\n", headerPrefix, path, headerSuffix); err != nil {
+		return err
+	}
+	meta, err := f.plainMeta(path, info, r)
+	if err != nil {
+		return err
+	}
+	if meta != nil {
+		if _, err := fmt.Fprintf(w, "%s%s\n", metaPrefix, formatMeta(meta)); err != nil {
+			return err
+		}
+	}
+	if err := copyEscaped(w, r); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n\n")
+	return err
+}
+
+// writeSafe writes a file framed by its length: the header, a meta line
+// starting with MetaLength, and the content verbatim. Paths that could
+// break the header line are quoted.
+func (f plainFormatter) writeSafe(w io.Writer, path string, info fs.FileInfo, r io.ReadSeeker) error {
+	length, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	meta, err := f.plainMeta(path, info, r)
+	if err != nil {
+		return err
+	}
+	meta = append([]fileMeta{{MetaLength, strconv.FormatInt(length, 10)}}, meta...)
+
+	if _, err := fmt.Fprintf(w, "%s%s%s\n%s%s\n", headerPrefix, quoteHeaderPath(path), headerSuffix, metaPrefix, formatMeta(meta)); err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n\n")
+	return err
+}
+
+func (plainFormatter) end(w io.Writer) error { return nil }
+
+// markdownFormatter writes each file as a "### path" heading followed by a
+// fenced code block tagged with the file's language. Metadata, if any, is
+// a line between the two.
+type markdownFormatter struct {
+	formatOptions
+}
+
+func (markdownFormatter) begin(w io.Writer) error { return nil }
+
+func (markdownFormatter) writeTree(w io.Writer, tree string) error {
+	_, err := fmt.Fprintf(w, "```text\n%s```\n\n", tree)
+	return err
+}
+
+// writeFrontMatter writes the block as-is: YAML front matter is how
+// Markdown documents carry metadata.
+func (markdownFormatter) writeFrontMatter(w io.Writer, block string) error {
+	_, err := io.WriteString(w, block)
+	return err
+}
+
+func (markdownFormatter) partHeader(part, total int) string {
+	return fmt.Sprintf("<!-- part %d/%d -->\n\n", part, total)
+}
+
+func (f markdownFormatter) writeFile(w io.Writer, path string, info fs.FileInfo, r io.ReadSeeker) error {
+	fence, err := codeFence(r)
+	if err != nil {
+		return err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	meta, err := f.describe(path, info, r)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(w, "### %s\n\n", path); err != nil {
+		return err
+	}
+	if meta != nil {
+		if _, err := fmt.Fprintf(w, "`%s`\n\n", formatMeta(meta)); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(w, "%s%s\n", fence, f.langs.of(path)); err != nil {
+		return err
+	}
+	tw := &trackingWriter{w: w}
+	if _, err := io.Copy(tw, r); err != nil {
+		return err
+	}
+	if tw.n > 0 && tw.last != '\n' {
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "%s\n\n", fence)
+	return err
+}
+
+func (markdownFormatter) end(w io.Writer) error { return nil }
+
+// codeFence reads r and returns a backtick fence longer than any backtick
+// run in it, so embedded fences (e.g. in Markdown files) can't close it.
+func codeFence(r io.Reader) (string, error) {
+	br := bufio.NewReader(r)
+	longest, run := 0, 0
+	for {
+		c, err := br.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if c == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return strings.Repeat("`", max(3, longest+1)), nil
+}
+
+// trackingWriter counts bytes written and remembers the last one, so
+// formatters can tell whether streamed content ended with a newline.
+type trackingWriter struct {
+	w    io.Writer
+	n    int64
+	last byte
+}
+
+func (t *trackingWriter) Write(p []byte) (int, error) {
+	n, err := t.w.Write(p)
+	if n > 0 {
+		t.n += int64(n)
+		t.last = p[n-1]
+	}
+	return n, err
+}
@@ -0,0 +1,136 @@
+package clap
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+)
+
+// zipFormatter packages the files into a zip archive instead of
+// concatenating them. Like the other archive formats it has no tree and no
+// part header; each part is a standalone archive.
+type zipFormatter struct {
+	zw *zip.Writer
+}
+
+func (f *zipFormatter) begin(w io.Writer) error {
+	f.zw = zip.NewWriter(w)
+	return nil
+}
+
+func (f *zipFormatter) writeTree(w io.Writer, tree string) error { return nil }
+
+func (f *zipFormatter) partHeader(part, total int) string { return "" }
+
+func (f *zipFormatter) writeFile(w io.Writer, path string, info fs.FileInfo, r io.ReadSeeker) error {
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	header := &zip.FileHeader{
+		Name:               archivePath(path),
+		Method:             zip.Deflate,
+		Modified:           archiveTime(info.ModTime()),
+		UncompressedSize64: uint64(size),
+	}
+	header.SetMode(info.Mode().Perm())
+	entry, err := f.zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, r)
+	return err
+}
+
+func (f *zipFormatter) end(w io.Writer) error {
+	return f.zw.Close()
+}
+
+// tarFormatter packages the files into a gzip-compressed tar archive.
+type tarFormatter struct {
+	gz *gzip.Writer
+	tw *tar.Writer
+}
+
+func (f *tarFormatter) begin(w io.Writer) error {
+	f.gz = gzip.NewWriter(w)
+	f.tw = tar.NewWriter(f.gz)
+	return nil
+}
+
+func (f *tarFormatter) writeTree(w io.Writer, tree string) error { return nil }
+
+func (f *tarFormatter) partHeader(part, total int) string { return "" }
+
+func (f *tarFormatter) writeFile(w io.Writer, path string, info fs.FileInfo, r io.ReadSeeker) error {
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     archivePath(path),
+		Size:     size,
+		Mode:     int64(info.Mode().Perm()),
+		ModTime:  archiveTime(info.ModTime()),
+		Format:   tar.FormatPAX,
+	}
+	if err := f.tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = io.Copy(f.tw, r)
+	return err
+}
+
+func (f *tarFormatter) end(w io.Writer) error {
+	if err := f.tw.Close(); err != nil {
+		return err
+	}
+	return f.gz.Close()
+}
+
+// isArchive reports whether format stores files byte for byte rather than
+// as text.
+func isArchive(format formatter) bool {
+	switch format := format.(type) {
+	case *zipFormatter, *tarFormatter, *sqliteFormatter:
+		return true
+	case *teeFormatter:
+		// RunFormats doesn't mix archives with text.
+		return len(format.formats) > 0 && isArchive(format.formats[0])
+	}
+	return false
+}
+
+// archivePath turns a display path into an entry name that stays inside
+// the directory the archive is extracted to.
+func archivePath(name string) string {
+	name = path.Clean("/" + strings.ReplaceAll(name, "\\", "/"))
+	return strings.TrimPrefix(name, "/")
+}
+
+// reproducibleTime is what archives store for files without a
+// modification time, under Options.Reproducible: the earliest time a zip
+// file can hold.
+var reproducibleTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// archiveTime returns t, or reproducibleTime for the zero time.
+func archiveTime(t time.Time) time.Time {
+	if t.IsZero() {
+		return reproducibleTime
+	}
+	return t
+}
@@ -0,0 +1,138 @@
+package clap
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"unicode/utf8"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+// htmlStyle is the chroma style used for highlighting.
+const htmlStyle = "github"
+
+// htmlHead opens the page. Layout and highlighting CSS are inlined so the
+// bundle is a single self-contained file.
+const htmlHead = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>clap bundle</title>
+<style>
+body { margin: 0; display: grid; grid-template-columns: 18rem 1fr; font: 14px/1.5 system-ui, sans-serif; color: #1f2328; }
+nav { grid-column: 1; grid-row: 1; position: sticky; top: 0; height: 100vh; overflow: auto; padding: 1rem; box-sizing: border-box; background: #f6f8fa; border-right: 1px solid #d0d7de; }
+nav h2 { margin-top: 0; font-size: 1rem; }
+nav ol { margin: 0; padding-left: 1.5rem; font: 12px/1.8 ui-monospace, monospace; word-break: break-all; }
+nav a { color: #0969da; text-decoration: none; }
+main { grid-column: 2; grid-row: 1; min-width: 0; padding: 1rem 2rem; }
+section { margin-bottom: 2rem; }
+h3 { font: 600 14px ui-monospace, monospace; padding: .5rem; margin: 0; background: #f6f8fa; border: 1px solid #d0d7de; border-bottom: 0; border-radius: 6px 6px 0 0; }
+pre { margin: 0; padding: .75rem; overflow: auto; border: 1px solid #d0d7de; border-radius: 0 0 6px 6px; font: 12px/1.45 ui-monospace, monospace; }
+pre.tree { border-radius: 6px; margin-bottom: 2rem; }
+p.meta { margin: 0; padding: .25rem .5rem; font: 12px ui-monospace, monospace; color: #59636e; border: 1px solid #d0d7de; border-bottom: 0; }
+`
+
+// htmlFormatter writes a browsable page with a sidebar index of files and
+// chroma syntax highlighting. The index is written after the content, once
+// every path is known, and placed beside it with CSS.
+type htmlFormatter struct {
+	formatOptions
+	paths []string
+}
+
+func (f *htmlFormatter) begin(w io.Writer) error {
+	f.paths = f.paths[:0]
+	if _, err := io.WriteString(w, htmlHead); err != nil {
+		return err
+	}
+	if err := chromahtml.New(chromahtml.WithClasses(true)).WriteCSS(w, styles.Get(htmlStyle)); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "</style>\n</head>\n<body>\n<main>\n")
+	return err
+}
+
+func (f *htmlFormatter) writeTree(w io.Writer, tree string) error {
+	_, err := fmt.Fprintf(w, "<pre class=\"tree\">%s</pre>\n", html.EscapeString(tree))
+	return err
+}
+
+// partHeader is an HTML comment, which may precede the doctype.
+func (f *htmlFormatter) partHeader(part, total int) string {
+	return fmt.Sprintf("<!-- part %d/%d -->\n", part, total)
+}
+
+func (f *htmlFormatter) writeFile(w io.Writer, path string, info fs.FileInfo, r io.ReadSeeker) error {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	f.paths = append(f.paths, path)
+	id := len(f.paths)
+
+	if _, err := fmt.Fprintf(w, "<section id=\"file-%d\">\n<h3>%s</h3>\n", id, html.EscapeString(path)); err != nil {
+		return err
+	}
+	meta, err := f.describe(path, info, r)
+	if err != nil {
+		return err
+	}
+	if meta != nil {
+		if _, err := fmt.Fprintf(w, "<p class=\"meta\">%s</p>\n", html.EscapeString(formatMeta(meta))); err != nil {
+			return err
+		}
+	}
+	if !utf8.Valid(content) {
+		_, err := fmt.Fprintf(w, "<pre>binary file, %d bytes</pre>\n</section>\n", len(content))
+		return err
+	}
+
+	if err := highlight(w, path, f.langs.of(path), string(content)); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "</section>\n")
+	return err
+}
+
+func (f *htmlFormatter) end(w io.Writer) error {
+	if _, err := io.WriteString(w, "</main>\n<nav>\n<h2>Files</h2>\n<ol>\n"); err != nil {
+		return err
+	}
+	for i, path := range f.paths {
+		if _, err := fmt.Fprintf(w, "<li><a href=\"#file-%d\">%s</a></li>\n", i+1, html.EscapeString(path)); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "</ol>\n</nav>\n</body>\n</html>\n")
+	return err
+}
+
+// highlight writes content as a highlighted <pre> block, picking the lexer
+// for lang, then from the file name or, failing that, the content.
+func highlight(w io.Writer, path, lang, content string) error {
+	var lexer chroma.Lexer
+	if lang != "" {
+		lexer = lexers.Get(lang)
+	}
+	if lexer == nil {
+		lexer = lexers.Match(path)
+	}
+	if lexer == nil {
+		lexer = lexers.Analyse(content)
+	}
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+
+	tokens, err := chroma.Coalesce(lexer).Tokenise(nil, content)
+	if err != nil {
+		return err
+	}
+	return chromahtml.New(chromahtml.WithClasses(true)).Format(w, styles.Get(htmlStyle), tokens)
+}
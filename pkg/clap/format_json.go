@@ -0,0 +1,116 @@
+package clap
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"unicode/utf8"
+)
+
+// jsonFile is one element of the JSON bundle array.
+type jsonFile struct {
+	Path     string `json:"path"`
+	Size     int64  `json:"size"`
+	Mode     string `json:"mode"`
+	Mtime    string `json:"mtime,omitempty"` // omitted with Options.Reproducible
+	Content  string `json:"content"`
+	Encoding string `json:"encoding,omitempty"` // "base64" when content isn't valid UTF-8
+	SHA256   string `json:"sha256,omitempty"`   // with Options.HeaderMeta
+	Lang     string `json:"lang,omitempty"`     // with Options.HeaderMeta
+}
+
+// jsonFormatter writes the bundle as a JSON array with one object per file
+// on its own line. The tree preamble is omitted; paths already describe it.
+type jsonFormatter struct {
+	formatOptions
+	count int
+}
+
+func (f *jsonFormatter) begin(w io.Writer) error {
+	f.count = 0
+	_, err := io.WriteString(w, "[")
+	return err
+}
+
+func (f *jsonFormatter) writeTree(w io.Writer, tree string) error { return nil }
+
+// partHeader is empty: each part is a standalone JSON array.
+func (f *jsonFormatter) partHeader(part, total int) string { return "" }
+
+func (f *jsonFormatter) writeFile(w io.Writer, path string, info fs.FileInfo, r io.ReadSeeker) error {
+	file, err := f.jsonRecord(path, info, r)
+	if err != nil {
+		return err
+	}
+
+	sep := ",\n  "
+	if f.count == 0 {
+		sep = "\n  "
+	}
+	f.count++
+	if _, err := io.WriteString(w, sep); err != nil {
+		return err
+	}
+	return writeJSON(w, file)
+}
+
+func (f *jsonFormatter) end(w io.Writer) error {
+	closing := "\n]\n"
+	if f.count == 0 {
+		closing = "]\n"
+	}
+	_, err := io.WriteString(w, closing)
+	return err
+}
+
+// jsonRecord builds the JSON object for a file, as written by the json
+// and jsonl formats.
+func (o formatOptions) jsonRecord(path string, info fs.FileInfo, r io.ReadSeeker) (jsonFile, error) {
+	meta, err := o.describe(path, info, r)
+	if err != nil {
+		return jsonFile{}, err
+	}
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return jsonFile{}, err
+	}
+
+	file := jsonFile{
+		Path:  path,
+		Size:  int64(len(content)),
+		Mode:  info.Mode().String(),
+		Mtime: mtime(info.ModTime()),
+	}
+	// Size and mode are always present, and so is mtime unless the output
+	// is reproducible.
+	for _, m := range meta {
+		switch m.key {
+		case MetaSHA256:
+			file.SHA256 = m.value
+		case MetaLang:
+			file.Lang = m.value
+		}
+	}
+	if utf8.Valid(content) {
+		file.Content = string(content)
+	} else {
+		file.Content = base64.StdEncoding.EncodeToString(content)
+		file.Encoding = "base64"
+	}
+	return file, nil
+}
+
+// writeJSON writes v compactly, without the trailing newline json.Encoder
+// adds and without HTML escaping.
+func writeJSON(w io.Writer, v any) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	_, err := w.Write(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+	return err
+}
@@ -0,0 +1,185 @@
+package clap
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"io/fs"
+	"strings"
+	"unicode/utf8"
+)
+
+// jsonlChunk is one line of a chunked JSON Lines bundle. Lines are
+// 1-based and inclusive.
+type jsonlChunk struct {
+	Path      string `json:"path"`
+	Chunk     int    `json:"chunk"` // 0-based, within the file
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+	Tokens    int    `json:"tokens"`
+	Content   string `json:"content"`
+	Encoding  string `json:"encoding,omitempty"` // "base64" when content isn't valid UTF-8
+	Lang      string `json:"lang,omitempty"`
+}
+
+// jsonlFormatter writes the bundle as JSON Lines: one object per file,
+// shaped like the elements of the json format, or with a chunker, one per
+// chunk. There is no tree, and no framing around the lines, so parts and
+// concatenated bundles stay valid. Each file's lines are flushed as soon as
+// they're written, so a consumer can start on them while later files are
+// still being read.
+type jsonlFormatter struct {
+	formatOptions
+	chunks *chunker
+}
+
+func (f *jsonlFormatter) begin(w io.Writer) error { return nil }
+
+func (f *jsonlFormatter) writeTree(w io.Writer, tree string) error { return nil }
+
+func (f *jsonlFormatter) partHeader(part, total int) string { return "" }
+
+func (f *jsonlFormatter) writeFile(w io.Writer, path string, info fs.FileInfo, r io.ReadSeeker) error {
+	if f.chunks == nil {
+		file, err := f.jsonRecord(path, info, r)
+		if err != nil {
+			return err
+		}
+		if err := writeJSONLine(w, file); err != nil {
+			return err
+		}
+		return flush(w)
+	}
+
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	lang := f.langs.of(path)
+	if !utf8.Valid(content) {
+		lines := bytes.Count(content, []byte("\n"))
+		if len(content) > 0 && content[len(content)-1] != '\n' {
+			lines++
+		}
+		if err := writeJSONLine(w, jsonlChunk{Path: path, StartLine: 1, EndLine: lines, Content: base64.StdEncoding.EncodeToString(content), Encoding: "base64", Lang: lang}); err != nil {
+			return err
+		}
+		return flush(w)
+	}
+	for i, c := range f.chunks.split(string(content)) {
+		chunk := jsonlChunk{Path: path, Chunk: i, StartLine: c.start + 1, EndLine: c.end, Tokens: c.tokens, Content: c.text, Lang: lang}
+		if err := writeJSONLine(w, chunk); err != nil {
+			return err
+		}
+	}
+	return flush(w)
+}
+
+func (f *jsonlFormatter) end(w io.Writer) error { return nil }
+
+// writeJSONLine writes v as one line of JSON.
+func writeJSONLine(w io.Writer, v any) error {
+	if err := writeJSON(w, v); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// flush passes what w has buffered on to the writer under it, if w is
+// buffered.
+func flush(w io.Writer) error {
+	if f, ok := w.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// chunker cuts files into pieces of about size tokens for embedding, each
+// repeating up to overlap tokens from the end of the one before.
+type chunker struct {
+	tokens  *tokenizer
+	size    int
+	overlap int
+}
+
+// chunk is a run of whole lines, start (0-based) up to end (exclusive).
+type chunk struct {
+	start, end int
+	tokens     int
+	text       string
+}
+
+// split cuts content into chunks of whole lines, each at most size tokens
+// unless a single line is larger. A chunk that has to end early ends at
+// the best break in its second half: before a line that follows a blank
+// one, else before a line that starts a top-level declaration.
+func (c *chunker) split(content string) []chunk {
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	cost := make([]int, len(lines))
+	for i, line := range lines {
+		cost[i] = len(c.tokens.enc.EncodeOrdinary(line))
+	}
+
+	var chunks []chunk
+	for start := 0; start < len(lines); {
+		end, sum := start, 0
+		for end < len(lines) && (end == start || sum+cost[end] <= c.size) {
+			sum += cost[end]
+			end++
+		}
+		if end < len(lines) {
+			end = bestBreak(lines, start, end)
+		}
+		text := strings.Join(lines[start:end], "")
+		chunks = append(chunks, chunk{start: start, end: end, tokens: len(c.tokens.enc.EncodeOrdinary(text)), text: text})
+		if end == len(lines) {
+			break
+		}
+
+		// Back up over the last lines for the overlap, always moving on
+		// by at least one.
+		next, overlap := end, 0
+		for next > start+1 && overlap+cost[next-1] <= c.overlap {
+			overlap += cost[next-1]
+			next--
+		}
+		start = next
+	}
+	return chunks
+}
+
+// bestBreak returns where to end a chunk from start that fits up to end,
+// looking for a natural boundary in its second half.
+func bestBreak(lines []string, start, end int) int {
+	declaration := -1
+	for i := end; i > start+(end-start)/2; i-- {
+		if strings.TrimSpace(lines[i-1]) == "" {
+			return i
+		}
+		// A declaration starts with its doc comment or decorators.
+		if declaration < 0 && startsDeclaration(lines[i]) && !startsDeclaration(lines[i-1]) {
+			declaration = i
+		}
+	}
+	if declaration > 0 {
+		return declaration
+	}
+	return end
+}
+
+// startsDeclaration reports whether line is unindented code that opens
+// something, rather than closing a block or continuing an expression.
+func startsDeclaration(line string) bool {
+	if line == "" || strings.TrimSpace(line) == "" {
+		return false
+	}
+	switch line[0] {
+	case ' ', '\t', '}', ')', ']', '\r', '\n':
+		return false
+	}
+	return true
+}
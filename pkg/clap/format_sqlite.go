@@ -0,0 +1,372 @@
+package clap
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"time"
+	"unicode/utf8"
+)
+
+// sqliteFormatter writes the bundle as a SQLite database with a files
+// table, one row per file, and a runs table describing the bundle:
+//
+//	CREATE TABLE files(path TEXT NOT NULL, size INTEGER NOT NULL, mtime TEXT, hash TEXT, content)
+//	CREATE TABLE runs(created TEXT, generator TEXT, files INTEGER, bytes INTEGER, tree TEXT)
+//
+// content is TEXT for UTF-8 files and a BLOB otherwise; hash is the hex
+// SHA-256 of content. Like the archive formats it stores files byte for
+// byte, and each part is a standalone database. The database is built in
+// memory and written whole at the end.
+type sqliteFormatter struct {
+	files   []sqliteRow
+	tree    string
+	bytes   int64
+	undated bool // Options.Reproducible: no creation time for the run
+}
+
+// sqliteTables are the tables written, in rootpage order.
+var sqliteTables = []struct{ name, sql string }{
+	{"files", "CREATE TABLE files(path TEXT NOT NULL, size INTEGER NOT NULL, mtime TEXT, hash TEXT, content)"},
+	{"runs", "CREATE TABLE runs(created TEXT, generator TEXT, files INTEGER, bytes INTEGER, tree TEXT)"},
+}
+
+func (f *sqliteFormatter) begin(w io.Writer) error {
+	f.files, f.tree, f.bytes = nil, "", 0
+	return nil
+}
+
+func (f *sqliteFormatter) writeTree(w io.Writer, tree string) error {
+	f.tree = tree
+	return nil
+}
+
+func (f *sqliteFormatter) partHeader(part, total int) string { return "" }
+
+func (f *sqliteFormatter) writeFile(w io.Writer, path string, info fs.FileInfo, r io.ReadSeeker) error {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(content)
+	var value any = content
+	if utf8.Valid(content) {
+		value = string(content)
+	}
+	var modified any
+	if t := mtime(info.ModTime()); t != "" {
+		modified = t
+	}
+	f.files = append(f.files, sqliteRecord(path, int64(len(content)), modified, hex.EncodeToString(sum[:]), value))
+	f.bytes += int64(len(content))
+	return nil
+}
+
+func (f *sqliteFormatter) end(w io.Writer) error {
+	var tree any
+	if f.tree != "" {
+		tree = f.tree
+	}
+	var created any
+	if !f.undated {
+		created = time.Now().UTC().Format(time.RFC3339)
+	}
+	run := sqliteRecord(created, "clap", int64(len(f.files)), f.bytes, tree)
+
+	db := &sqliteDB{pages: [][]byte{make([]byte, sqlitePageSize)}}
+	roots := []uint32{db.buildTable(f.files), db.buildTable([]sqliteRow{run})}
+	var schema []sqliteRow
+	for i, table := range sqliteTables {
+		schema = append(schema, sqliteRecord("table", table.name, table.name, int64(roots[i]), table.sql))
+	}
+	if err := db.writeSchema(schema); err != nil {
+		return err
+	}
+	for _, page := range db.pages {
+		if _, err := w.Write(page); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sqlitePageSize is the page size of the databases written. No bytes of a
+// page are reserved, so it is also the usable size.
+const sqlitePageSize = 4096
+
+// B-tree page types.
+const (
+	sqliteInteriorTable = 0x05
+	sqliteLeafTable     = 0x0d
+)
+
+// sqliteRow is a record in SQLite's record format. Rows get rowids 1, 2,
+// ... in order.
+type sqliteRow []byte
+
+// sqliteDB assembles the pages of a database. pages[0] is page 1, which
+// holds the file header and the schema table and is filled in last.
+type sqliteDB struct {
+	pages [][]byte
+}
+
+// allocate adds a zeroed page and returns its number.
+func (db *sqliteDB) allocate() uint32 {
+	db.pages = append(db.pages, make([]byte, sqlitePageSize))
+	return uint32(len(db.pages))
+}
+
+// page returns the contents of page number n.
+func (db *sqliteDB) page(n uint32) []byte {
+	return db.pages[n-1]
+}
+
+// buildTable writes rows as a table b-tree and returns its root page:
+// leaves first, then as many interior levels as it takes to reach one
+// page.
+func (db *sqliteDB) buildTable(rows []sqliteRow) uint32 {
+	type child struct {
+		page   uint32
+		maxKey int64
+	}
+
+	var level []child
+	var cells [][]byte
+	var used int
+	var lastKey int64
+	flushLeaf := func() {
+		page := db.allocate()
+		writeBtreePage(db.page(page), 0, sqliteLeafTable, cells, 0)
+		level = append(level, child{page, lastKey})
+		cells, used = nil, 0
+	}
+	for i, row := range rows {
+		rowid := int64(i + 1)
+		cell := db.leafCell(rowid, row)
+		if len(cells) > 0 && 8+used+2*(len(cells)+1)+len(cell) > sqlitePageSize {
+			flushLeaf()
+		}
+		cells = append(cells, cell)
+		used += len(cell)
+		lastKey = rowid
+	}
+	if len(cells) > 0 || len(level) == 0 {
+		flushLeaf()
+	}
+
+	for len(level) > 1 {
+		var next []child
+		var cells [][]byte
+		used := 0
+		for i, c := range level {
+			if i == len(level)-1 {
+				page := db.allocate()
+				writeBtreePage(db.page(page), 0, sqliteInteriorTable, cells, c.page)
+				next = append(next, child{page, c.maxKey})
+				break
+			}
+			cell := binary.BigEndian.AppendUint32(nil, c.page)
+			cell = appendVarint(cell, uint64(c.maxKey))
+			if 12+used+2*(len(cells)+1)+len(cell) > sqlitePageSize {
+				// The previous child becomes the full page's right-most.
+				prev := level[i-1]
+				page := db.allocate()
+				writeBtreePage(db.page(page), 0, sqliteInteriorTable, cells[:len(cells)-1], prev.page)
+				next = append(next, child{page, prev.maxKey})
+				cells, used = nil, 0
+			}
+			cells = append(cells, cell)
+			used += len(cell)
+		}
+		level = next
+	}
+	return level[0].page
+}
+
+// leafCell encodes a table leaf cell, spilling what doesn't fit in the
+// page to a chain of overflow pages as SQLite's format prescribes.
+func (db *sqliteDB) leafCell(rowid int64, payload []byte) []byte {
+	const usable = sqlitePageSize
+	maxLocal := usable - 35
+	minLocal := (usable-12)*32/255 - 23
+	local := len(payload)
+	if local > maxLocal {
+		local = minLocal + (len(payload)-minLocal)%(usable-4)
+		if local > maxLocal {
+			local = minLocal
+		}
+	}
+
+	cell := appendVarint(nil, uint64(len(payload)))
+	cell = appendVarint(cell, uint64(rowid))
+	cell = append(cell, payload[:local]...)
+	rest := payload[local:]
+	if len(rest) == 0 {
+		return cell
+	}
+
+	first := db.allocate()
+	cell = binary.BigEndian.AppendUint32(cell, first)
+	for page := first; ; {
+		n := copy(db.page(page)[4:], rest)
+		rest = rest[n:]
+		if len(rest) == 0 {
+			return cell
+		}
+		next := db.allocate()
+		binary.BigEndian.PutUint32(db.page(page), next)
+		page = next
+	}
+}
+
+// writeSchema fills in page 1: the file header and the schema table,
+// which must fit on that one page.
+func (db *sqliteDB) writeSchema(rows []sqliteRow) error {
+	var cells [][]byte
+	size := 100 + 8
+	for i, row := range rows {
+		cell := appendVarint(nil, uint64(len(row)))
+		cell = appendVarint(cell, uint64(i+1))
+		cell = append(cell, row...)
+		cells = append(cells, cell)
+		size += 2 + len(cell)
+	}
+	if size > sqlitePageSize {
+		return fmt.Errorf("sqlite schema doesn't fit on one page")
+	}
+
+	page := db.page(1)
+	copy(page, "SQLite format 3\x00")
+	binary.BigEndian.PutUint16(page[16:], sqlitePageSize)
+	page[18], page[19] = 1, 1 // legacy journal mode
+	page[21], page[22], page[23] = 64, 32, 32
+	binary.BigEndian.PutUint32(page[24:], 1) // change counter
+	binary.BigEndian.PutUint32(page[28:], uint32(len(db.pages)))
+	binary.BigEndian.PutUint32(page[40:], 1) // schema cookie
+	binary.BigEndian.PutUint32(page[44:], 4) // schema format
+	binary.BigEndian.PutUint32(page[56:], 1) // UTF-8
+	binary.BigEndian.PutUint32(page[92:], 1) // version-valid-for, the change counter
+	binary.BigEndian.PutUint32(page[96:], 3045000)
+	writeBtreePage(page, 100, sqliteLeafTable, cells, 0)
+	return nil
+}
+
+// writeBtreePage lays out a b-tree page whose header starts at offset:
+// the header, the cell pointers in key order, and the cells packed at the
+// end of the page. rightmost is the right-most child of interior pages.
+func writeBtreePage(page []byte, offset int, kind byte, cells [][]byte, rightmost uint32) {
+	header := 8
+	if kind == sqliteInteriorTable {
+		header = 12
+		binary.BigEndian.PutUint32(page[offset+8:], rightmost)
+	}
+	page[offset] = kind
+	binary.BigEndian.PutUint16(page[offset+3:], uint16(len(cells)))
+
+	content := len(page)
+	pointers := offset + header
+	for i, cell := range cells {
+		content -= len(cell)
+		copy(page[content:], cell)
+		binary.BigEndian.PutUint16(page[pointers+2*i:], uint16(content))
+	}
+	binary.BigEndian.PutUint16(page[offset+5:], uint16(content))
+}
+
+// sqliteRecord encodes values, each nil, int64, string, or []byte, in
+// SQLite's record format.
+func sqliteRecord(values ...any) sqliteRow {
+	var types, body []byte
+	for _, v := range values {
+		switch v := v.(type) {
+		case nil:
+			types = appendVarint(types, 0)
+		case int64:
+			switch {
+			case v == 0:
+				types = appendVarint(types, 8)
+			case v == 1:
+				types = appendVarint(types, 9)
+			default:
+				serial, size := sqliteIntType(v)
+				types = appendVarint(types, serial)
+				for i := size - 1; i >= 0; i-- {
+					body = append(body, byte(v>>(8*i)))
+				}
+			}
+		case string:
+			types = appendVarint(types, uint64(len(v))*2+13)
+			body = append(body, v...)
+		case []byte:
+			types = appendVarint(types, uint64(len(v))*2+12)
+			body = append(body, v...)
+		default:
+			panic(fmt.Sprintf("sqliteRecord: unsupported %T", v))
+		}
+	}
+
+	// The header size counts its own varint.
+	size := len(types) + 1
+	if size > 127 {
+		size++
+	}
+	record := appendVarint(nil, uint64(size))
+	record = append(record, types...)
+	return append(record, body...)
+}
+
+// sqliteIntType returns the serial type and byte size of the smallest
+// integer encoding that holds v.
+func sqliteIntType(v int64) (uint64, int) {
+	switch {
+	case v >= -1<<7 && v < 1<<7:
+		return 1, 1
+	case v >= -1<<15 && v < 1<<15:
+		return 2, 2
+	case v >= -1<<23 && v < 1<<23:
+		return 3, 3
+	case v >= -1<<31 && v < 1<<31:
+		return 4, 4
+	case v >= -1<<47 && v < 1<<47:
+		return 5, 6
+	}
+	return 6, 8
+}
+
+// appendVarint appends v as a SQLite varint: big-endian groups of seven
+// bits with the high bit set on all but the last, except that a ninth
+// byte carries a full eight bits.
+func appendVarint(buf []byte, v uint64) []byte {
+	if v > 1<<56-1 {
+		var groups [8]byte
+		last := byte(v)
+		v >>= 8
+		for i := 7; i >= 0; i-- {
+			groups[i] = byte(v&0x7f) | 0x80
+			v >>= 7
+		}
+		buf = append(buf, groups[:]...)
+		return append(buf, last)
+	}
+	var groups [8]byte
+	n := 0
+	for {
+		groups[n] = byte(v & 0x7f)
+		n++
+		v >>= 7
+		if v == 0 {
+			break
+		}
+	}
+	for i := n - 1; i >= 0; i-- {
+		b := groups[i]
+		if i > 0 {
+			b |= 0x80
+		}
+		buf = append(buf, b)
+	}
+	return buf
+}
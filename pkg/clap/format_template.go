@@ -0,0 +1,121 @@
+package clap
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"text/template"
+)
+
+// TemplateData is the data available to Options.Header and Options.Footer
+// templates for each file.
+type TemplateData struct {
+	Path   string // display path, as used in plain headers
+	Size   int64
+	Mode   string // permissions, e.g. -rw-r--r--
+	Mtime  string // modification time, RFC 3339 in UTC
+	SHA256 string // hex SHA-256 of the content, as bundled
+	Lang   string // language of the file, as in Markdown fences
+	Index  int    // 1-based position in the bundle
+}
+
+// templateFormatter is the plain layout with user-defined delimiters
+// around each file. Content is written verbatim, so the result can't be
+// read back with ReadBundle.
+type templateFormatter struct {
+	header, footer *template.Template
+	langs          languages
+	index          int
+}
+
+// newTemplateFormatter parses the header and footer templates. An empty
+// header keeps the plain "=== path ===" line; an empty footer writes none.
+func newTemplateFormatter(header, footer string, langs languages) (*templateFormatter, error) {
+	if header == "" {
+		header = headerPrefix + "{{.Path}}" + headerSuffix
+	}
+	f := &templateFormatter{langs: langs}
+	var err error
+	if f.header, err = template.New("header").Parse(header); err != nil {
+		return nil, fmt.Errorf("parsing header template: %v", err)
+	}
+	if footer != "" {
+		if f.footer, err = template.New("footer").Parse(footer); err != nil {
+			return nil, fmt.Errorf("parsing footer template: %v", err)
+		}
+	}
+
+	// Catch references to unknown fields before any output is written.
+	if err := f.header.Execute(io.Discard, TemplateData{}); err != nil {
+		return nil, fmt.Errorf("header template: %v", err)
+	}
+	if f.footer != nil {
+		if err := f.footer.Execute(io.Discard, TemplateData{}); err != nil {
+			return nil, fmt.Errorf("footer template: %v", err)
+		}
+	}
+	return f, nil
+}
+
+func (f *templateFormatter) begin(w io.Writer) error {
+	f.index = 0
+	return nil
+}
+
+func (f *templateFormatter) writeTree(w io.Writer, tree string) error {
+	_, err := fmt.Fprintf(w, "%s\n", tree)
+	return err
+}
+
+func (f *templateFormatter) writeFrontMatter(w io.Writer, block string) error {
+	return plainFormatter{}.writeFrontMatter(w, block)
+}
+
+func (f *templateFormatter) partHeader(part, total int) string {
+	return plainFormatter{}.partHeader(part, total)
+}
+
+func (f *templateFormatter) writeFile(w io.Writer, path string, info fs.FileInfo, r io.ReadSeeker) error {
+	f.index++
+	meta, err := describe([]string{MetaSHA256}, f.langs, path, info, r)
+	if err != nil {
+		return err
+	}
+	data := TemplateData{
+		Path:   path,
+		Size:   info.Size(),
+		Mode:   info.Mode().String(),
+		Mtime:  mtime(info.ModTime()),
+		SHA256: meta[0].value,
+		Lang:   f.langs.of(path),
+		Index:  f.index,
+	}
+
+	if err := f.header.Execute(w, data); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, "\n"); err != nil {
+		return err
+	}
+	tw := &trackingWriter{w: w}
+	if _, err := io.Copy(tw, r); err != nil {
+		return err
+	}
+
+	if f.footer == nil {
+		_, err := io.WriteString(w, "\n\n")
+		return err
+	}
+	if tw.n > 0 && tw.last != '\n' {
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+	}
+	if err := f.footer.Execute(w, data); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n\n")
+	return err
+}
+
+func (f *templateFormatter) end(w io.Writer) error { return nil }
@@ -0,0 +1,85 @@
+package clap
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+var update = flag.Bool("update", false, "rewrite the testdata/*.golden files")
+
+// goldenFS is a small tree with the content each format has to escape.
+var goldenFS = fstest.MapFS{
+	"main.go":        {Data: []byte("package main\n\nfunc main() {\n\tprintln(\"<hi> & \\\"bye\\\"\")\n}\n"), Mode: 0o644},
+	"docs/README.md": {Data: []byte("# Title\n\n```go\nfenced()\n```\n\n=== not a header ===\n]]> </file>\n"), Mode: 0o644},
+	"no-newline.txt": {Data: []byte("last line"), Mode: 0o600},
+}
+
+func TestFormatGolden(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"plain", Options{Format: "plain"}},
+		{"plain-meta", Options{Format: "plain", HeaderMeta: []string{MetaSize, MetaMode, MetaSHA256, MetaLang}}},
+		{"plain-safe", Options{Format: "plain", Framing: FramingSafe}},
+		{"markdown", Options{Format: "markdown"}},
+		{"json", Options{Format: "json"}},
+		{"jsonl", Options{Format: "jsonl"}},
+		{"html", Options{Format: "html"}},
+		{"xml-docs", Options{Format: "xml-docs"}},
+		{"template", Options{Header: `<file path="{{.Path}}" lang="{{.Lang}}">`, Footer: `</file>`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Reproducible = true
+			b, err := New(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			if err := b.Run(context.Background(), goldenFS, &buf); err != nil {
+				t.Fatal(err)
+			}
+
+			golden := filepath.Join("testdata", tt.name+".golden")
+			if *update {
+				if err := os.WriteFile(golden, buf.Bytes(), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v; run go test -update to create it", err)
+			}
+			if got := buf.String(); got != string(want) {
+				t.Errorf("output differs from %s:\n%s", golden, diffLines(string(want), got))
+			}
+		})
+	}
+}
+
+// diffLines shows the first line where got departs from want.
+func diffLines(want, got string) string {
+	wantLines, gotLines := strings.Split(want, "\n"), strings.Split(got, "\n")
+	for i := 0; i < max(len(wantLines), len(gotLines)); i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w != g {
+			return fmt.Sprintf("line %d:\n- %s\n+ %s", i+1, w, g)
+		}
+	}
+	return ""
+}
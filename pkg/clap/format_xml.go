@@ -0,0 +1,99 @@
+package clap
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"unicode/utf8"
+)
+
+// xmlEscaper escapes text for element content, leaving newlines alone.
+var xmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// xmlAttrEscaper escapes text for a double-quoted attribute value.
+var xmlAttrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+
+// xmlDocsFormatter writes the <documents> structure Anthropic recommends
+// for long documents in Claude prompts: one <document> per file with its
+// <source> path and <document_contents>.
+type xmlDocsFormatter struct {
+	formatOptions
+	index int
+}
+
+func (f *xmlDocsFormatter) begin(w io.Writer) error {
+	f.index = 0
+	_, err := io.WriteString(w, "<documents>\n")
+	return err
+}
+
+func (f *xmlDocsFormatter) writeTree(w io.Writer, tree string) error {
+	_, err := fmt.Fprintf(w, "<directory_tree>\n%s</directory_tree>\n", xmlEscaper.Replace(tree))
+	return err
+}
+
+// partHeader is an XML comment, which may precede the root element.
+func (f *xmlDocsFormatter) partHeader(part, total int) string {
+	return fmt.Sprintf("<!-- part %d/%d -->\n", part, total)
+}
+
+func (f *xmlDocsFormatter) writeFile(w io.Writer, path string, info fs.FileInfo, r io.ReadSeeker) error {
+	meta, err := f.describe(path, info, r)
+	if err != nil {
+		return err
+	}
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	f.index++
+
+	// Metadata goes in attributes of the document, beside its index.
+	var attrs strings.Builder
+	for _, m := range meta {
+		fmt.Fprintf(&attrs, " %s=\"%s\"", m.key, xmlAttrEscaper.Replace(m.value))
+	}
+	if _, err := fmt.Fprintf(w, "<document index=\"%d\"%s>\n<source>%s</source>\n", f.index, attrs.String(), xmlEscaper.Replace(path)); err != nil {
+		return err
+	}
+
+	text := bytes.TrimSuffix(content, []byte("\n"))
+	switch {
+	case !isXMLText(content):
+		_, err = fmt.Fprintf(w, "<document_contents encoding=\"base64\">\n%s\n", base64.StdEncoding.EncodeToString(content))
+	case bytes.ContainsAny(text, "<&"):
+		// CDATA keeps code readable; a "]]>" inside is split across two
+		// sections.
+		escaped := bytes.ReplaceAll(text, []byte("]]>"), []byte("]]]]><![CDATA[>"))
+		_, err = fmt.Fprintf(w, "<document_contents><![CDATA[\n%s\n]]>", escaped)
+	default:
+		_, err = fmt.Fprintf(w, "<document_contents>\n%s\n", text)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "</document_contents>\n</document>\n")
+	return err
+}
+
+func (f *xmlDocsFormatter) end(w io.Writer) error {
+	_, err := io.WriteString(w, "</documents>\n")
+	return err
+}
+
+// isXMLText reports whether content is UTF-8 made only of characters XML
+// allows; control characters other than tab and newlines are not.
+func isXMLText(content []byte) bool {
+	if !utf8.Valid(content) {
+		return false
+	}
+	for _, r := range string(content) {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' || r == 0xFFFE || r == 0xFFFF {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,65 @@
+package clap
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// FrontMatterField is one "key: value" line of Options.FrontMatter.
+type FrontMatterField struct {
+	Key, Value string
+}
+
+// frontMatterWriter is implemented by the formats a bundle can start with
+// a front matter block in: those whose readers skip text before the first
+// file, as ReadBundle does and Markdown tools expect.
+type frontMatterWriter interface {
+	writeFrontMatter(w io.Writer, block string) error
+}
+
+// frontMatter renders Options.FrontMatter and the totals of jobs, which
+// have all been read, as they will be written.
+func (b *Bundler) frontMatter(jobs []*fileJob, dedupe bool) (string, error) {
+	files, size, tokens := 0, 0, 0
+	seen := map[[32]byte]string{}
+	for _, job := range jobs {
+		if job.skipped != "" || job.pre.err != nil || job.pre.skipped != "" {
+			continue
+		}
+		result := *job.pre
+		if dedupe {
+			if _, err := b.stubDuplicate(seen, job.path, &result); err != nil {
+				return "", err
+			}
+		}
+		files++
+		size += len(result.content)
+		tokens += result.tokens
+	}
+
+	var sb strings.Builder
+	sb.WriteString("---\n")
+	for _, f := range b.opts.FrontMatter {
+		sb.WriteString(f.Key + ": " + yamlScalar(f.Value) + "\n")
+	}
+	fmt.Fprintf(&sb, "files: %d\nbytes: %d\ntokens: %d\n---\n\n", files, size, tokens)
+	return sb.String(), nil
+}
+
+// yamlScalar returns s as a YAML scalar: as is when it reads back the
+// same, else double-quoted.
+func yamlScalar(s string) string {
+	plain := s != "" && s == strings.TrimSpace(s) && !strings.ContainsAny(s[:1], "-?:,[]{}#&*!|>'\"%@`") &&
+		!strings.Contains(s, ": ") && !strings.Contains(s, " #") && !strings.HasSuffix(s, ":")
+	for _, r := range s {
+		if r < ' ' || r == 0x7f {
+			plain = false
+		}
+	}
+	if plain {
+		return s
+	}
+	return strconv.Quote(s)
+}
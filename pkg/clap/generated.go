@@ -0,0 +1,45 @@
+package clap
+
+import (
+	"bytes"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// GeneratedPatterns lists globs, in .gitignore syntax, matching the names
+// of generated files and minified assets skipped with Options.NoGenerated.
+var GeneratedPatterns = []string{
+	"*.pb.go", "*_gen.go", "*.gen.go", "*_generated.go", "zz_generated.*.go",
+	"*.pb.cc", "*.pb.h", "*_pb2.py", "*_pb2_grpc.py",
+	"*.g.dart", "*.freezed.dart",
+	"*.min.js", "*.min.mjs", "*.min.css", "*.map",
+}
+
+// generatedMarker matches the comments code generators leave near the top
+// of their output, alone on a line after any comment marker: Go's "Code
+// generated ... DO NOT EDIT." and the "@generated" tag of Facebook's tools,
+// Rust, and others.
+var generatedMarker = regexp.MustCompile(`(?m)^[ \t]*(?://|#|/?\*+|--|;+|<!--)?[ \t]*(?:Code generated .* DO NOT EDIT|@generated\b)`)
+
+// minifiedExtensions are the extensions whose files are checked for
+// minification.
+var minifiedExtensions = []string{".js", ".mjs", ".cjs", ".css"}
+
+// minifiedLine is the average line length, in bytes, above which a
+// script or stylesheet counts as minified.
+const minifiedLine = 500
+
+// isGenerated reports whether a file looks generated from its first bytes:
+// it carries a generator's marker, or it is a script or stylesheet with
+// lines too long for anyone to have written by hand.
+func isGenerated(name string, head []byte) bool {
+	if generatedMarker.Match(head) {
+		return true
+	}
+	if !slices.Contains(minifiedExtensions, strings.ToLower(path.Ext(name))) || len(head) < 2*minifiedLine {
+		return false
+	}
+	return len(head)/(bytes.Count(head, []byte("\n"))+1) > minifiedLine
+}
@@ -0,0 +1,99 @@
+package clap
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// GitTrackedFiles returns the files git tracks under dir, as slash-
+// separated paths relative to dir.
+func GitTrackedFiles(dir string) ([]string, error) {
+	return gitFiles(dir, "ls-files", "-z", "--cached", "--", ".")
+}
+
+// GitChangedFiles returns the files under dir that differ from ref, in the
+// index or the working tree, plus untracked files that aren't ignored.
+// Paths are slash-separated and relative to dir.
+func GitChangedFiles(dir, ref string) ([]string, error) {
+	changed, err := gitFiles(dir, "diff", "--name-only", "-z", "--relative", ref, "--")
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := gitFiles(dir, "ls-files", "-z", "--others", "--exclude-standard", "--", ".")
+	if err != nil {
+		return nil, err
+	}
+	return append(changed, untracked...), nil
+}
+
+// gitFiles runs a git command in dir that prints NUL-separated paths
+// relative to dir, and returns them.
+func gitFiles(dir string, args ...string) ([]string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return nil, fmt.Errorf("git %s: %v", args[0], err)
+	}
+
+	var files []string
+	for _, name := range strings.Split(string(out), "\x00") {
+		if name != "" {
+			files = append(files, filepath.ToSlash(name))
+		}
+	}
+	return files, nil
+}
+
+// scpURL matches the scp-like form of an ssh URL, user@host:path.
+var scpURL = regexp.MustCompile(`^[\w.-]+@[\w.-]+:[^/\\]`)
+
+// IsGitURL reports whether s names a remote git repository rather than a
+// local path: an http, https, ssh, git, or file URL, or user@host:path.
+func IsGitURL(s string) bool {
+	for _, scheme := range []string{"https://", "http://", "ssh://", "git://", "file://"} {
+		if strings.HasPrefix(s, scheme) {
+			return true
+		}
+	}
+	return scpURL.MatchString(s)
+}
+
+// GitClone makes a shallow clone of the repository at url in dir, which
+// must be empty or not exist, checked out at ref: a branch, a tag, or a
+// full commit hash. An empty ref checks out the default branch.
+func GitClone(ctx context.Context, url, ref, dir string) error {
+	if ref == "" {
+		ref = "HEAD"
+	}
+	// Fetching the one ref works for branches, tags, and commits alike,
+	// where clone --branch takes only the first two.
+	steps := [][]string{
+		{"init", "--quiet", dir},
+		{"-C", dir, "fetch", "--quiet", "--depth", "1", "--no-tags", url, ref},
+		{"-C", dir, "checkout", "--quiet", "--detach", "FETCH_HEAD"},
+	}
+	for _, args := range steps {
+		cmd := exec.CommandContext(ctx, "git", args...)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return fmt.Errorf("cloning %s: %s", url, msg)
+			}
+			return fmt.Errorf("cloning %s: %v", url, err)
+		}
+	}
+	return nil
+}
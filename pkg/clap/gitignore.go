@@ -0,0 +1,160 @@
+package clap
+
+import (
+	"bufio"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreRule is a single parsed line from a .gitignore file.
+type ignoreRule struct {
+	base    string // slash-separated directory the rule is relative to ("" for root)
+	pattern string // glob matched against the path relative to base
+	negate  bool   // "!pattern" re-includes a previously ignored path
+	dirOnly bool   // "pattern/" only matches directories
+}
+
+// gitIgnore accumulates rules from every .gitignore seen during the walk.
+// Rules are kept in load order, so deeper files override their parents.
+type gitIgnore struct {
+	rules []ignoreRule
+}
+
+// newGitIgnore creates a matcher preloaded with the global excludes file
+// (a host path, skipped when empty) and the tree's .git/info/exclude.
+func newGitIgnore(fsys fs.FS, globalExcludes string) *gitIgnore {
+	g := &gitIgnore{}
+	if globalExcludes != "" {
+		if f, err := os.Open(globalExcludes); err == nil {
+			g.load(f, "")
+			f.Close()
+		}
+	}
+	if f, err := fsys.Open(".git/info/exclude"); err == nil {
+		g.load(f, "")
+		f.Close()
+	}
+	return g
+}
+
+// loadDir reads the ignore file called name in dir, if any, such as
+// .gitignore. dir is relative to the walk root and becomes the base for
+// the rules it contains. Missing or unreadable files are silently
+// ignored, matching git's behavior.
+func (g *gitIgnore) loadDir(fsys fs.FS, dir, name string) {
+	f, err := fsys.Open(path.Join(dir, name))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	g.load(f, dir)
+}
+
+// load parses ignore rules from r and appends them.
+func (g *gitIgnore) load(r io.Reader, base string) {
+	if base == "." {
+		base = ""
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreLine(scanner.Text(), base); ok {
+			g.rules = append(g.rules, rule)
+		}
+	}
+}
+
+// parseIgnoreLine converts a .gitignore line into a rule. Blank lines and
+// comments report ok=false.
+func parseIgnoreLine(line, base string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+
+	rule := ignoreRule{base: base}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\#`) || strings.HasPrefix(line, `\!`) {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+
+	// A slash anywhere but the end anchors the pattern to the file's
+	// directory; otherwise it matches at any depth below it.
+	if strings.Contains(line, "/") {
+		line = strings.TrimPrefix(line, "/")
+	} else {
+		line = "**/" + line
+	}
+
+	rule.pattern = strings.ReplaceAll(line, "[!", "[^")
+	return rule, true
+}
+
+// match reports whether the slash-separated path relative to the walk root
+// is ignored. The last matching rule wins.
+func (g *gitIgnore) match(rel string, isDir bool) bool {
+	ignored := false
+	for _, rule := range g.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+
+		name := rel
+		if rule.base != "" {
+			if !strings.HasPrefix(rel, rule.base+"/") {
+				continue
+			}
+			name = rel[len(rule.base)+1:]
+		}
+
+		if matchGlob(rule.pattern, name) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// GlobalExcludesFile returns the user's global git excludes file, taken
+// from core.excludesFile or git's XDG default location.
+func GlobalExcludesFile() string {
+	if out, err := exec.Command("git", "config", "--path", "--get", "core.excludesFile").Output(); err == nil {
+		if file := strings.TrimSpace(string(out)); file != "" {
+			return file
+		}
+	}
+
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		return filepath.Join(xdg, "git", "ignore")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".config", "git", "ignore")
+	}
+	return ""
+}
+
+// newExcludes builds a matcher from --exclude patterns, which follow the
+// same syntax as .gitignore lines relative to the walk root.
+func newExcludes(patterns []string) *gitIgnore {
+	g := &gitIgnore{}
+	for _, pattern := range patterns {
+		if rule, ok := parseIgnoreLine(pattern, ""); ok {
+			g.rules = append(g.rules, rule)
+		}
+	}
+	return g
+}
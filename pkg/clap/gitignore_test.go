@@ -0,0 +1,80 @@
+package clap
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestGitIgnore(t *testing.T) {
+	fsys := fstest.MapFS{
+		".gitignore": {Data: []byte(
+			"# build output\n" +
+				"*.log\n" +
+				"!keep.log\n" +
+				"/dist\n" +
+				"build/\n" +
+				"docs/*.html\n" +
+				`\#literal` + "\n" +
+				"trailing.txt   \n" +
+				"\n")},
+		"src/.gitignore": {Data: []byte("gen/\n*.tmp\n!important.tmp\n/local.go\n")},
+	}
+	g := &gitIgnore{}
+	g.loadDir(fsys, ".", ".gitignore")
+	g.loadDir(fsys, "src", ".gitignore")
+	g.loadDir(fsys, "missing", ".gitignore")
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"app.log", false, true},
+		{"logs/deep/app.log", false, true},
+		{"keep.log", false, false},
+		{"logs/keep.log", false, false},
+		{"dist", true, true},
+		{"dist", false, true},
+		{"src/dist", true, false},
+		{"build", true, true},
+		{"build", false, false}, // a file named like a directory-only rule
+		{"src/build", true, true},
+		{"docs/index.html", false, true},
+		{"docs/api/index.html", false, false},
+		{"#literal", false, true},
+		{"trailing.txt", false, true},
+		{"main.go", false, false},
+		{"src/gen", true, true},
+		{"gen", true, false}, // src's rules don't reach above it
+		{"src/a/b.tmp", false, true},
+		{"b.tmp", false, false},
+		{"src/important.tmp", false, false},
+		{"src/local.go", false, true},
+		{"src/pkg/local.go", false, false},
+	}
+	for _, tt := range tests {
+		if got := g.match(tt.path, tt.isDir); got != tt.want {
+			t.Errorf("match(%q, isDir=%v) = %v, want %v", tt.path, tt.isDir, got, tt.want)
+		}
+	}
+}
+
+func TestExcludes(t *testing.T) {
+	g := newExcludes([]string{"*_test.go", "testdata/", "!keep_test.go", "", "# comment"})
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"clap_test.go", false, true},
+		{"pkg/clap/clap_test.go", false, true},
+		{"pkg/keep_test.go", false, false},
+		{"pkg/clap/testdata", true, true},
+		{"clap.go", false, false},
+	}
+	for _, tt := range tests {
+		if got := g.match(tt.path, tt.isDir); got != tt.want {
+			t.Errorf("match(%q, isDir=%v) = %v, want %v", tt.path, tt.isDir, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package clap
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// matchGlob reports whether the slash-separated name matches pattern.
+// Within a segment *, ? and [...] behave like path.Match; a "**" segment
+// matches zero or more whole segments.
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+// matchSegments matches pattern segments against name segments, expanding
+// "**" by trying every possible number of consumed name segments.
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for len(pattern) > 0 && pattern[0] == "**" {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		ok, err := path.Match(pattern[0], name[0])
+		if err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// compileRegexps compiles patterns, Go regular expressions, naming the
+// option in errors.
+func compileRegexps(option string, patterns []string) ([]*regexp.Regexp, error) {
+	var res []*regexp.Regexp
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", option, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// matchRegexps reports whether any of res matches name.
+func matchRegexps(res []*regexp.Regexp, name string) bool {
+	for _, re := range res {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,38 @@
+package clap
+
+import "testing"
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"main.go", "main.go", true},
+		{"main.go", "cmd/main.go", false},
+		{"*.go", "main.go", true},
+		{"*.go", "cmd/main.go", false},
+		{"cmd/*.go", "cmd/main.go", true},
+		{"cmd/*.go", "cmd/sub/main.go", false},
+		{"?.go", "a.go", true},
+		{"?.go", "ab.go", false},
+		{"[ab].go", "b.go", true},
+		{"[^ab].go", "c.go", true},
+		{"[^ab].go", "a.go", false},
+		{"**/main.go", "main.go", true},
+		{"**/main.go", "a/b/c/main.go", true},
+		{"**/main.go", "a/b/c/main.go.bak", false},
+		{"vendor/**", "vendor/x/y.go", true},
+		{"vendor/**", "vendor", true},
+		{"vendor/**", "src/vendor/x.go", false},
+		{"a/**/b", "a/b", true},
+		{"a/**/b", "a/x/y/b", true},
+		{"a/**/b", "a/x/y/c", false},
+		{"a/**/**/b", "a/x/b", true},
+		{"[", "[", false}, // malformed patterns match nothing
+	}
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package clap
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// goPackage is a directory of Go files in one source, as "go" sorting
+// sees it.
+type goPackage struct {
+	src     *Source
+	dir     string          // slash-separated, within src.FS
+	path    string          // import path, or "" without a go.mod
+	shown   string          // directory as bundled, for headers
+	imports map[string]bool // import paths of its files
+	rank    int             // position in dependency order
+}
+
+// goPackages orders the Go packages among jobs so that every package
+// comes after the packages it imports, keeping walk order where imports
+// don't decide, and returns each .go job's package with its 1-based rank.
+// Other files are missing from the map, so they sort first. A package's
+// import path is its directory under the module path in the source's
+// go.mod, or, without one, any import path ending in the directory.
+//
+// This approximates what the go command would load: imports are read
+// with go/parser from every .go file, whatever its build constraints,
+// and go.mod replace directives and other modules in the tree aren't
+// consulted, so only imports within the bundled module order packages.
+func goPackages(jobs []*fileJob) map[*fileJob]*goPackage {
+	type key struct {
+		src *Source
+		dir string
+	}
+	var order []*goPackage
+	packages := map[key]*goPackage{}
+	modules := map[*Source]string{}
+	for _, job := range jobs {
+		if !strings.EqualFold(path.Ext(job.rel), ".go") {
+			continue
+		}
+		k := key{job.src, path.Dir(job.rel)}
+		pkg := packages[k]
+		if pkg == nil {
+			pkg = &goPackage{src: job.src, dir: k.dir, shown: filepath.Dir(job.path), imports: map[string]bool{}}
+			packages[k] = pkg
+			order = append(order, pkg)
+			if _, ok := modules[job.src]; !ok {
+				modules[job.src] = goModulePath(job.src.FS)
+			}
+			if module := modules[job.src]; module != "" {
+				pkg.path = module
+				if pkg.dir != "." {
+					pkg.path += "/" + pkg.dir
+				}
+			}
+		}
+		for _, imp := range goImports(job.src.FS, job.rel) {
+			pkg.imports[imp] = true
+		}
+	}
+
+	// provides reports whether pkg is the package imp names.
+	provides := func(pkg *goPackage, imp string) bool {
+		if pkg.path != "" {
+			return imp == pkg.path
+		}
+		return pkg.dir != "." && (imp == pkg.dir || strings.HasSuffix(imp, "/"+pkg.dir))
+	}
+
+	// Depth-first, in walk order: a package is ranked once everything it
+	// imports is. Import cycles, which Go doesn't allow, are cut where
+	// they're found.
+	state := map[*goPackage]int{} // 1 while visiting, 2 when ranked
+	next := 1
+	var visit func(pkg *goPackage)
+	visit = func(pkg *goPackage) {
+		if state[pkg] != 0 {
+			return
+		}
+		state[pkg] = 1
+		for _, dep := range order {
+			if dep != pkg && dep.src == pkg.src && importsAny(pkg.imports, dep, provides) {
+				visit(dep)
+			}
+		}
+		state[pkg] = 2
+		pkg.rank = next
+		next++
+	}
+	for _, pkg := range order {
+		visit(pkg)
+	}
+
+	byJob := map[*fileJob]*goPackage{}
+	for _, job := range jobs {
+		if pkg := packages[key{job.src, path.Dir(job.rel)}]; pkg != nil && strings.EqualFold(path.Ext(job.rel), ".go") {
+			byJob[job] = pkg
+		}
+	}
+	return byJob
+}
+
+// packageHeaderWriter is implemented by the formats that can start each
+// Go package's files with a header, for Options.GoPackageHeaders.
+type packageHeaderWriter interface {
+	writePackageHeader(w io.Writer, name string) error
+}
+
+// packageHeader returns the name the header for pkg gives it: its import
+// path, or the directory of its files as bundled if that is unknown or
+// Options.Anonymize would hide it.
+func (b *Bundler) packageHeader(pkg *goPackage) string {
+	if pkg.path == "" || b.opts.Anonymize != nil {
+		return filepath.ToSlash(pkg.shown)
+	}
+	return pkg.path
+}
+
+// packagePrefix starts a plain bundle's package header line. Like
+// metaPrefix, it can't be mistaken for a content line, which would have
+// been escaped.
+const packagePrefix = headerPrefix + "package "
+
+// writePackageHeader writes the header line, and a blank line after it,
+// between files, where ReadBundleFiles knows to skip it.
+func (plainFormatter) writePackageHeader(w io.Writer, name string) error {
+	_, err := fmt.Fprintf(w, "%s%s\n\n", packagePrefix, quoteHeaderPath(name))
+	return err
+}
+
+// writePackageHeader writes a heading a level above the files'.
+func (markdownFormatter) writePackageHeader(w io.Writer, name string) error {
+	_, err := fmt.Fprintf(w, "## Package %s\n\n", name)
+	return err
+}
+
+// importsAny reports whether one of imports names dep.
+func importsAny(imports map[string]bool, dep *goPackage, provides func(*goPackage, string) bool) bool {
+	for imp := range imports {
+		if provides(dep, imp) {
+			return true
+		}
+	}
+	return false
+}
+
+// goImports returns the import paths of the Go file at rel, or nil if it
+// can't be read or parsed.
+func goImports(fsys fs.FS, rel string) []string {
+	src, err := fs.ReadFile(fsys, rel)
+	if err != nil {
+		return nil
+	}
+	file, err := parser.ParseFile(token.NewFileSet(), rel, src, parser.ImportsOnly|parser.SkipObjectResolution)
+	if err != nil {
+		return nil
+	}
+	var imports []string
+	for _, spec := range file.Imports {
+		if imp, err := strconv.Unquote(spec.Path.Value); err == nil {
+			imports = append(imports, imp)
+		}
+	}
+	return imports
+}
+
+// goModulePath returns the module path declared by go.mod at the root of
+// fsys, or "".
+func goModulePath(fsys fs.FS) string {
+	data, err := fs.ReadFile(fsys, "go.mod")
+	if err != nil {
+		return ""
+	}
+	for line := range strings.Lines(string(data)) {
+		if rest, ok := strings.CutPrefix(strings.TrimSpace(line), "module"); ok && rest != "" && (rest[0] == ' ' || rest[0] == '\t') {
+			rest, _, _ = strings.Cut(rest, "//")
+			rest = strings.TrimSpace(rest)
+			if unquoted, err := strconv.Unquote(rest); err == nil {
+				return unquoted
+			}
+			return rest
+		}
+	}
+	return ""
+}
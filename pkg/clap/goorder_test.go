@@ -0,0 +1,84 @@
+package clap
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// goTree is a module whose packages import each other against walk order.
+var goTree = fstest.MapFS{
+	"go.mod":          {Data: []byte("module example.com/m\n\ngo 1.22\n")},
+	"api/api.go":      {Data: []byte("package api\n\nimport \"example.com/m/store\"\n\nvar S = store.New\n")},
+	"main.go":         {Data: []byte("package main\n\nimport _ \"example.com/m/api\"\n\nfunc main() {}\n")},
+	"store/store.go":  {Data: []byte("package store\n\nimport \"example.com/m/util\"\n\nvar New = util.F\n")},
+	"store/index.go":  {Data: []byte("package store\n\nvar index = 1\n")},
+	"util/util.go":    {Data: []byte("package util\n\nfunc F() {}\n")},
+	"util/README.txt": {Data: []byte("not Go\n")},
+}
+
+func TestGoOrder(t *testing.T) {
+	var order []string
+	b, err := New(Options{Sort: "go", Report: func(e Event) { order = append(order, e.Path) }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Run(context.Background(), goTree, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"go.mod", "util/README.txt", "util/util.go", "store/index.go", "store/store.go", "api/api.go", "main.go"}
+	if strings.Join(order, " ") != strings.Join(want, " ") {
+		t.Errorf("order %v, want %v", order, want)
+	}
+}
+
+func TestGoPackageHeaders(t *testing.T) {
+	bundle := func(opts Options) string {
+		t.Helper()
+		opts.Sort, opts.GoPackageHeaders = "go", true
+		b, err := New(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := b.Run(context.Background(), goTree, &buf); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+
+	plain := bundle(Options{})
+	for _, header := range []string{"example.com/m/util", "example.com/m/store", "example.com/m/api", "example.com/m"} {
+		if n := strings.Count(plain, "\n"+packagePrefix+header+"\n\n"); n != 1 {
+			t.Errorf("plain bundle has %d headers for %s, want 1:\n%s", n, header, plain)
+		}
+	}
+	// Readers skip the headers, whatever the framing.
+	for _, out := range []string{plain, bundle(Options{Framing: FramingSafe})} {
+		err := ReadBundleFiles(strings.NewReader(out), func(f BundleFile) error {
+			if want := string(goTree[f.Path].Data); string(f.Content) != want {
+				t.Errorf("%s read back as %q, want %q", f.Path, f.Content, want)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Error(err)
+		}
+	}
+
+	if md := bundle(Options{Format: "markdown"}); !strings.Contains(md, "## Package example.com/m/store\n\n### store/index.go\n") {
+		t.Errorf("markdown bundle has no package heading:\n%s", md)
+	}
+
+	for _, opts := range []Options{{Format: "json"}, {Header: "<{{.Path}}>"}} {
+		opts.Sort, opts.GoPackageHeaders = "go", true
+		if _, err := New(opts); err == nil {
+			t.Errorf("format %q, header %q: package headers accepted", opts.Format, opts.Header)
+		}
+	}
+	if _, err := New(Options{GoPackageHeaders: true}); err == nil {
+		t.Error("package headers accepted without the go sort order")
+	}
+}
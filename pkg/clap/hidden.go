@@ -0,0 +1,12 @@
+package clap
+
+import (
+	"io/fs"
+	"strings"
+)
+
+// isHidden reports whether d is hidden: its name starts with a dot or, on
+// Windows, it has the hidden attribute.
+func isHidden(d fs.DirEntry) bool {
+	return strings.HasPrefix(d.Name(), ".") || hasHiddenAttribute(d)
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package clap
+
+import "io/fs"
+
+// hasHiddenAttribute reports false: outside Windows, only the leading dot
+// hides a file.
+func hasHiddenAttribute(d fs.DirEntry) bool { return false }
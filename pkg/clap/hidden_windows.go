@@ -0,0 +1,18 @@
+//go:build windows
+
+package clap
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// hasHiddenAttribute reports whether d has FILE_ATTRIBUTE_HIDDEN set.
+func hasHiddenAttribute(d fs.DirEntry) bool {
+	info, err := d.Info()
+	if err != nil {
+		return false
+	}
+	attrs, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	return ok && attrs.FileAttributes&syscall.FILE_ATTRIBUTE_HIDDEN != 0
+}
@@ -0,0 +1,141 @@
+package clap
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// languages maps lowercase file extensions, with the dot, and lowercase
+// file names to the language tags used for Markdown code fences, the HTML
+// highlighter, and TemplateData.Lang. File names win over extensions.
+type languages map[string]string
+
+// builtinLanguages is the default table. Tags are those GitHub's
+// Markdown and chroma both recognize.
+var builtinLanguages = languages{
+	".bash":       "bash",
+	".bat":        "batch",
+	".c":          "c",
+	".cc":         "cpp",
+	".cjs":        "javascript",
+	".clj":        "clojure",
+	".cmake":      "cmake",
+	".cpp":        "cpp",
+	".cs":         "csharp",
+	".css":        "css",
+	".cxx":        "cpp",
+	".dart":       "dart",
+	".dockerfile": "dockerfile",
+	".el":         "elisp",
+	".erl":        "erlang",
+	".ex":         "elixir",
+	".exs":        "elixir",
+	".fish":       "fish",
+	".fs":         "fsharp",
+	".go":         "go",
+	".gradle":     "groovy",
+	".graphql":    "graphql",
+	".groovy":     "groovy",
+	".h":          "c",
+	".hcl":        "hcl",
+	".hpp":        "cpp",
+	".hs":         "haskell",
+	".htm":        "html",
+	".html":       "html",
+	".ini":        "ini",
+	".java":       "java",
+	".jl":         "julia",
+	".js":         "javascript",
+	".json":       "json",
+	".jsonc":      "json",
+	".jsx":        "jsx",
+	".kt":         "kotlin",
+	".kts":        "kotlin",
+	".less":       "less",
+	".lua":        "lua",
+	".m":          "objectivec",
+	".makefile":   "makefile",
+	".md":         "markdown",
+	".mjs":        "javascript",
+	".mk":         "makefile",
+	".ml":         "ocaml",
+	".nim":        "nim",
+	".nix":        "nix",
+	".php":        "php",
+	".pl":         "perl",
+	".proto":      "protobuf",
+	".ps1":        "powershell",
+	".py":         "python",
+	".r":          "r",
+	".rb":         "ruby",
+	".rs":         "rust",
+	".sass":       "sass",
+	".scala":      "scala",
+	".scss":       "scss",
+	".sh":         "bash",
+	".sql":        "sql",
+	".svelte":     "svelte",
+	".swift":      "swift",
+	".tf":         "hcl",
+	".toml":       "toml",
+	".ts":         "typescript",
+	".tsx":        "tsx",
+	".vue":        "vue",
+	".xml":        "xml",
+	".yaml":       "yaml",
+	".yml":        "yaml",
+	".zig":        "zig",
+	".zsh":        "zsh",
+
+	"cmakelists.txt": "cmake",
+	"containerfile":  "dockerfile",
+	"dockerfile":     "dockerfile",
+	"gemfile":        "ruby",
+	"gnumakefile":    "makefile",
+	"jenkinsfile":    "groovy",
+	"makefile":       "makefile",
+	"rakefile":       "ruby",
+	"vagrantfile":    "ruby",
+}
+
+// newLanguages returns the built-in table with overrides applied. Keys
+// starting with a dot are extensions; others are file names. A key mapped
+// to "" takes the file out of the table.
+func newLanguages(overrides map[string]string) (languages, error) {
+	if len(overrides) == 0 {
+		return builtinLanguages, nil
+	}
+	langs := make(languages, len(builtinLanguages)+len(overrides))
+	for key, lang := range builtinLanguages {
+		langs[key] = lang
+	}
+	for key, lang := range overrides {
+		key = strings.ToLower(strings.TrimSpace(key))
+		if key == "" || key == "." || strings.Contains(key, "/") {
+			return nil, fmt.Errorf("language for %q: want an extension such as .tpl or a file name such as BUILD", key)
+		}
+		if lang == "" {
+			delete(langs, key)
+		} else {
+			langs[key] = lang
+		}
+	}
+	return langs, nil
+}
+
+// of returns the language of the file at p, or "" if unknown. Names
+// such as Dockerfile.dev count as the Dockerfile they extend.
+func (l languages) of(p string) string {
+	name := strings.ToLower(path.Base(strings.ReplaceAll(p, "\\", "/")))
+	if lang, ok := l[name]; ok {
+		return lang
+	}
+	if lang, ok := l[path.Ext(name)]; ok {
+		return lang
+	}
+	if base, _, ok := strings.Cut(name, "."); ok && (base == "dockerfile" || base == "containerfile") {
+		return l[base]
+	}
+	return ""
+}
@@ -0,0 +1,31 @@
+package clap
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+// lineSeparator goes between a line number and the line.
+const lineSeparator = " | "
+
+// numberLines prefixes every line of content with its right-aligned
+// 1-based number.
+func numberLines(content []byte) []byte {
+	if len(content) == 0 {
+		return content
+	}
+	lines := bytes.SplitAfter(content, []byte("\n"))
+	if len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	width := len(strconv.Itoa(len(lines)))
+
+	var out bytes.Buffer
+	out.Grow(len(content) + len(lines)*(width+len(lineSeparator)))
+	for i, line := range lines {
+		fmt.Fprintf(&out, "%*d%s", width, i+1, lineSeparator)
+		out.Write(line)
+	}
+	return out.Bytes()
+}
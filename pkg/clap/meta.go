@@ -0,0 +1,138 @@
+package clap
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Fields for Options.HeaderMeta.
+const (
+	MetaSize   = "size"   // bytes of content, as bundled
+	MetaMode   = "mode"   // permissions, e.g. -rw-r--r--
+	MetaMtime  = "mtime"  // modification time, RFC 3339 in UTC
+	MetaSHA256 = "sha256" // hex SHA-256 of the content, as bundled
+	MetaLang   = "lang"   // language, as in Markdown fences
+
+	// MetaLength is always written with FramingSafe: the number of bytes
+	// of content that follow the meta line, verbatim.
+	MetaLength = "length"
+
+	// MetaDuplicateOf is written on every deduplicated copy in a plain
+	// bundle: the path of the earlier file whose content it has, in place
+	// of its "identical to" stub.
+	MetaDuplicateOf = "duplicate_of"
+)
+
+// metaFields lists the fields in the order they are written.
+var metaFields = []string{MetaSize, MetaMode, MetaMtime, MetaSHA256, MetaLang}
+
+// metaPrefix starts the line after a plain header that holds the file's
+// metadata. Content lines starting with "=== " are escaped, so it can't be
+// confused with one.
+const metaPrefix = headerPrefix + "meta "
+
+// fileMeta is one metadata field of a file.
+type fileMeta struct {
+	key, value string
+}
+
+// normalizeMeta validates Options.HeaderMeta and returns its fields in
+// writing order. "hash" is accepted for sha256.
+func normalizeMeta(fields []string) ([]string, error) {
+	want := map[string]bool{}
+	for _, field := range fields {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if field == "hash" {
+			field = MetaSHA256
+		}
+		if !slices.Contains(metaFields, field) {
+			return nil, fmt.Errorf("unknown header metadata %q (want %s)", field, strings.Join(metaFields, ", "))
+		}
+		want[field] = true
+	}
+	var normalized []string
+	for _, field := range metaFields {
+		if want[field] {
+			normalized = append(normalized, field)
+		}
+	}
+	return normalized, nil
+}
+
+// describe returns the requested metadata for the file at path whose
+// bundled content is r. r is read for the size and hash, then rewound.
+func describe(fields []string, langs languages, path string, info fs.FileInfo, r io.ReadSeeker) ([]fileMeta, error) {
+	var meta []fileMeta
+	for _, field := range fields {
+		var value string
+		switch field {
+		case MetaSize:
+			size, err := r.Seek(0, io.SeekEnd)
+			if err != nil {
+				return nil, err
+			}
+			value = strconv.FormatInt(size, 10)
+		case MetaMode:
+			value = info.Mode().String()
+		case MetaMtime:
+			value = mtime(info.ModTime())
+		case MetaSHA256:
+			h := sha256.New()
+			if _, err := io.Copy(h, r); err != nil {
+				return nil, err
+			}
+			value = hex.EncodeToString(h.Sum(nil))
+		case MetaLang:
+			if value = langs.of(path); value == "" {
+				continue
+			}
+		}
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		meta = append(meta, fileMeta{field, value})
+	}
+	return meta, nil
+}
+
+// formatMeta renders metadata as space-separated key=value pairs. Values
+// that start with a quote or hold spaces or control characters, as paths
+// can, are written as Go string literals.
+func formatMeta(meta []fileMeta) string {
+	parts := make([]string, len(meta))
+	for i, m := range meta {
+		value := m.value
+		if strings.HasPrefix(value, `"`) || strings.ContainsFunc(value, func(r rune) bool { return r <= ' ' || r == 0x7f }) {
+			value = strconv.Quote(value)
+		}
+		parts[i] = m.key + "=" + value
+	}
+	return strings.Join(parts, " ")
+}
+
+// parseMeta reads the key=value pairs written by formatMeta.
+func parseMeta(s string) map[string]string {
+	meta := map[string]string{}
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok || strings.ContainsAny(key, " \t") {
+			_, s, _ = strings.Cut(s, " ")
+			continue
+		}
+		value := rest
+		if quoted, err := strconv.QuotedPrefix(rest); err == nil {
+			value, _ = strconv.Unquote(quoted)
+			s = rest[len(quoted):]
+		} else {
+			value, s, _ = strings.Cut(rest, " ")
+		}
+		meta[key] = value
+	}
+	return meta
+}
@@ -0,0 +1,41 @@
+package clap
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeLayouts are the absolute times ParseTime accepts, in local time
+// unless they carry a zone.
+var timeLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02"}
+
+// ParseTime parses a point in time for the modification time filters:
+// a date such as "2024-06-01", a date and time, or an age before now such
+// as "48h", "90m", "7d", or "2w".
+func ParseTime(s string, now time.Time) (time.Time, error) {
+	value := strings.TrimSpace(s)
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	// time.ParseDuration stops at hours; days and weeks are what people
+	// mostly mean.
+	days := 0.0
+	switch {
+	case strings.HasSuffix(value, "d"):
+		days = 1
+	case strings.HasSuffix(value, "w"):
+		days = 7
+	}
+	if n, err := strconv.ParseFloat(value[:max(len(value)-1, 0)], 64); days > 0 && err == nil && n >= 0 {
+		return now.Add(-time.Duration(n * days * float64(24*time.Hour))), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (want a date like 2024-06-01 or an age like 48h or 7d)", s)
+}
@@ -0,0 +1,165 @@
+package clap
+
+import (
+	"cmp"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// DefaultWeight is the weight of files that match no Options.Weights
+// pattern.
+const DefaultWeight = 50
+
+// Weight gives the files matching Pattern, a glob in .gitignore syntax,
+// a weight: heavier files are bundled earlier and dropped later under
+// Options.FitTokens.
+type Weight struct {
+	Pattern string
+	Weight  int
+}
+
+// fileOrder decides the order files are bundled in. The walk yields them
+// sorted by name within each directory; weights, sort, reverse, first,
+// and last rearrange that.
+type fileOrder struct {
+	sort     string
+	reverse  bool
+	first    []*gitIgnore // one matcher per Options.First pattern
+	last     []*gitIgnore
+	weights  []*gitIgnore // one matcher per Options.Weights entry
+	weight   []int
+	packages map[*fileJob]*goPackage // for sort "go"
+}
+
+// newFileOrder validates the ordering options.
+func newFileOrder(opts Options) (*fileOrder, error) {
+	switch opts.Sort {
+	case "", "path", "size", "mtime", "ext", "go":
+	default:
+		return nil, fmt.Errorf("unknown sort %q (want path, size, mtime, ext, or go)", opts.Sort)
+	}
+	matchers := func(patterns []string) []*gitIgnore {
+		var list []*gitIgnore
+		for _, pattern := range patterns {
+			list = append(list, newExcludes([]string{pattern}))
+		}
+		return list
+	}
+	o := &fileOrder{sort: opts.Sort, reverse: opts.Reverse, first: matchers(opts.First), last: matchers(opts.Last)}
+	for _, w := range opts.Weights {
+		o.weights = append(o.weights, newExcludes([]string{w.Pattern}))
+		o.weight = append(o.weight, w.Weight)
+	}
+	return o, nil
+}
+
+// weightOf returns the weight of the last Options.Weights pattern job
+// matches, or DefaultWeight.
+func (o *fileOrder) weightOf(job *fileJob) int {
+	for i := len(o.weights) - 1; i >= 0; i-- {
+		if matchAny(o.weights[i:i+1], job.rel) >= 0 {
+			return o.weight[i]
+		}
+	}
+	return DefaultWeight
+}
+
+// apply returns jobs in bundle order: files matching a First pattern, in
+// pattern order, then everything else sorted, then files matching a Last
+// pattern, in pattern order. jobs itself is left in walk order.
+func (o *fileOrder) apply(jobs []*fileJob) []*fileJob {
+	if o.sort == "" && !o.reverse && o.first == nil && o.last == nil && o.weights == nil {
+		return jobs
+	}
+	if o.sort == "go" {
+		o.packages = goPackages(jobs)
+	}
+
+	// group is 0 for First matches, 1 for the rest, and 2 for Last
+	// matches; rank orders files within the First and Last groups.
+	type placed struct {
+		job         *fileJob
+		group, rank int
+	}
+	list := make([]placed, len(jobs))
+	for i, job := range jobs {
+		list[i] = placed{job: job, group: 1}
+		if rank := matchAny(o.first, job.rel); rank >= 0 {
+			list[i].group, list[i].rank = 0, rank
+		} else if rank := matchAny(o.last, job.rel); rank >= 0 {
+			list[i].group, list[i].rank = 2, rank
+		}
+	}
+
+	if o.reverse {
+		slices.Reverse(list)
+	}
+	slices.SortStableFunc(list, func(a, b placed) int {
+		if a.group != b.group {
+			return cmp.Compare(a.group, b.group)
+		}
+		if a.group != 1 {
+			return cmp.Compare(a.rank, b.rank)
+		}
+		c := o.compare(a.job, b.job)
+		if o.reverse {
+			c = -c
+		}
+		return c
+	})
+
+	ordered := make([]*fileJob, len(list))
+	for i, p := range list {
+		ordered[i] = p.job
+	}
+	return ordered
+}
+
+// compare orders two files by weight, heaviest first, then by the sort
+// key. Ties keep walk order.
+func (o *fileOrder) compare(a, b *fileJob) int {
+	if o.weights != nil {
+		if c := cmp.Compare(o.weightOf(b), o.weightOf(a)); c != 0 {
+			return c
+		}
+	}
+	switch o.sort {
+	case "path":
+		return strings.Compare(a.path, b.path)
+	case "size":
+		return cmp.Compare(a.info.Size(), b.info.Size())
+	case "mtime":
+		return a.info.ModTime().Compare(b.info.ModTime())
+	case "ext":
+		return strings.Compare(strings.ToLower(path.Ext(a.rel)), strings.ToLower(path.Ext(b.rel)))
+	case "go":
+		return cmp.Compare(o.goRank(a), o.goRank(b))
+	}
+	return 0
+}
+
+// goRank returns the rank of job's Go package, or 0 if it isn't Go.
+func (o *fileOrder) goRank(job *fileJob) int {
+	if pkg := o.packages[job]; pkg != nil {
+		return pkg.rank
+	}
+	return 0
+}
+
+// matchAny returns the index of the first matcher that matches rel or one
+// of its parent directories, or -1.
+func matchAny(matchers []*gitIgnore, rel string) int {
+	for i, m := range matchers {
+		if m.match(rel, false) {
+			return i
+		}
+		for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+			if m.match(dir, true) {
+				return i
+			}
+		}
+	}
+	return -1
+}
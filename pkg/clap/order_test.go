@@ -0,0 +1,66 @@
+package clap
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// weightTree has files of the same size, for weights to tell apart.
+func weightTree() fstest.MapFS {
+	fsys := fstest.MapFS{}
+	for _, name := range []string{"docs/guide.md", "src/main.go", "src/util.go", "src/util_test.go"} {
+		var body strings.Builder
+		for i := range 30 {
+			fmt.Fprintf(&body, "%s line %d\n", name, i)
+		}
+		fsys[name] = &fstest.MapFile{Data: []byte(body.String())}
+	}
+	return fsys
+}
+
+var weights = []Weight{
+	{Pattern: "*.md", Weight: 10},
+	{Pattern: "src/**", Weight: 90},
+	{Pattern: "src/util*", Weight: DefaultWeight}, // the last match wins
+}
+
+func TestWeights(t *testing.T) {
+	var order []string
+	b, err := New(Options{Weights: weights, Report: func(e Event) { order = append(order, e.Path) }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Run(context.Background(), weightTree(), &strings.Builder{}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"src/main.go", "src/util.go", "src/util_test.go", "docs/guide.md"}
+	if strings.Join(order, " ") != strings.Join(want, " ") {
+		t.Errorf("order %v, want %v", order, want)
+	}
+}
+
+func TestFitWeights(t *testing.T) {
+	fsys := weightTree()
+	kept := fstest.MapFS{"src/main.go": fsys["src/main.go"], "src/util.go": fsys["src/util.go"]}
+	_, budget, _ := bundleTokens(t, kept, Options{})
+	budget += 2 // a bundle counts as a whole, the fit estimate by section
+
+	// The lightest go first, whatever FitPriority says; within a weight,
+	// tests go before other files.
+	opts := Options{Weights: weights, FitTokens: budget, FitPriority: []string{"docs/**"}}
+	out, tokens, events := bundleTokens(t, fsys, opts)
+	if tokens > budget {
+		t.Errorf("bundle has %d tokens, over the budget of %d", tokens, budget)
+	}
+	for path, dropped := range map[string]bool{"docs/guide.md": true, "src/util_test.go": true, "src/main.go": false, "src/util.go": false} {
+		if e := events[path]; (e.Skipped == SkippedOverBudget) != dropped || e.Truncated {
+			t.Errorf("%s: skipped %q, truncated %v; want dropped %v", path, e.Skipped, e.Truncated, dropped)
+		}
+	}
+	if i, j := strings.Index(out, "=== src/main.go ==="), strings.Index(out, "=== src/util.go ==="); i < 0 || j < i {
+		t.Errorf("kept files out of weight order:\n%s", out)
+	}
+}
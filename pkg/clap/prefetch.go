@@ -0,0 +1,187 @@
+package clap
+
+import (
+	"io/fs"
+	"path"
+	"sync"
+)
+
+// prefetchFS reads directories, and stats their entries, ahead of a
+// sequential fs.WalkDir over it, for Options.WalkJobs. Its workers share
+// one stack of directories to read, so whichever is free takes the next,
+// and each pushes the subdirectories it finds. The walk still visits
+// everything in its own order, making the same decisions, so the bundle
+// doesn't change; it just finds most listings ready instead of waiting on
+// the file system for each.
+type prefetchFS struct {
+	fs.FS
+	ahead func(rel string, d fs.DirEntry) bool // whether to read a subdirectory ahead
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	stack   []string                  // directories to read, the next one last
+	dirs    map[string]*prefetchedDir // read or being read, and not yet walked
+	walked  map[string]bool           // listed by the walk; not worth reading
+	pruned  map[string]bool           // skipped by the walk, along with everything below
+	ready   int                       // listings waiting for the walk
+	limit   int                       // of ready listings, to bound memory
+	stopped bool
+	workers sync.WaitGroup
+}
+
+// prefetchedDir is one directory's listing, once done.
+type prefetchedDir struct {
+	done    bool
+	entries []fs.DirEntry
+	err     error
+}
+
+// newPrefetchFS starts workers reading fsys from its root. ahead decides
+// which subdirectories are read before the walk gets to them; it must be
+// safe to call concurrently. Call stop once the walk is over.
+func newPrefetchFS(fsys fs.FS, workers int, ahead func(rel string, d fs.DirEntry) bool) *prefetchFS {
+	p := &prefetchFS{
+		FS:     fsys,
+		ahead:  ahead,
+		stack:  []string{"."},
+		dirs:   map[string]*prefetchedDir{},
+		walked: map[string]bool{},
+		pruned: map[string]bool{},
+		limit:  64 * workers,
+	}
+	p.cond = sync.NewCond(&p.mu)
+	for range workers {
+		p.workers.Go(p.work)
+	}
+	return p
+}
+
+// work reads directories off the stack until stopped.
+func (p *prefetchFS) work() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for {
+		for !p.stopped && (len(p.stack) == 0 || p.ready >= p.limit) {
+			p.cond.Wait()
+		}
+		if p.stopped {
+			return
+		}
+		dir := p.stack[len(p.stack)-1]
+		p.stack = p.stack[:len(p.stack)-1]
+		if p.walked[dir] || p.dirs[dir] != nil || p.isPruned(dir) {
+			continue
+		}
+		d := &prefetchedDir{}
+		p.dirs[dir] = d
+
+		p.mu.Unlock()
+		entries, err := readDirInfo(p.FS, dir)
+		p.mu.Lock()
+		d.entries, d.err, d.done = entries, err, true
+		if p.isPruned(dir) {
+			// The walk skipped it while it was being read.
+			delete(p.dirs, dir)
+		} else {
+			p.ready++
+			p.push(dir, entries)
+		}
+		p.cond.Broadcast()
+	}
+}
+
+// prune tells the workers that the walk skips dir and everything below
+// it, so listings read there ahead are dropped and no more are read. The
+// walk would otherwise never collect them, and they'd count against
+// p.limit for the rest of the walk.
+func (p *prefetchFS) prune(dir string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pruned[dir] = true
+	for name, d := range p.dirs {
+		if d.done && p.isPruned(name) {
+			delete(p.dirs, name)
+			p.ready--
+		}
+	}
+	p.cond.Broadcast()
+}
+
+// isPruned reports whether dir is, or is below, a directory the walk
+// skips. p.mu must be held.
+func (p *prefetchFS) isPruned(dir string) bool {
+	if len(p.pruned) == 0 {
+		return false
+	}
+	for ; dir != "."; dir = path.Dir(dir) {
+		if p.pruned[dir] {
+			return true
+		}
+	}
+	return false
+}
+
+// push queues the subdirectories of dir worth reading ahead, the first
+// on top, since that is the order the walk will want them in. p.mu must
+// be held.
+func (p *prefetchFS) push(dir string, entries []fs.DirEntry) {
+	for i := len(entries) - 1; i >= 0; i-- {
+		if e := entries[i]; e.IsDir() {
+			if rel := path.Join(dir, e.Name()); p.ahead(rel, e) {
+				p.stack = append(p.stack, rel)
+			}
+		}
+	}
+}
+
+// ReadDir returns the listing of name, waiting for a worker that is
+// reading it, or reading it here if none has got to it yet.
+func (p *prefetchFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.walked[name] = true
+	if d := p.dirs[name]; d != nil {
+		for !d.done {
+			p.cond.Wait()
+		}
+		delete(p.dirs, name)
+		p.ready--
+		p.cond.Broadcast()
+		return d.entries, d.err
+	}
+
+	p.mu.Unlock()
+	entries, err := readDirInfo(p.FS, name)
+	p.mu.Lock()
+	// The workers carry on below this directory.
+	p.push(name, entries)
+	p.cond.Broadcast()
+	return entries, err
+}
+
+// Stat and ReadFile keep the underlying file system's shortcuts; Stat in
+// particular never opens the file, which could block on a FIFO.
+func (p *prefetchFS) Stat(name string) (fs.FileInfo, error) { return fs.Stat(p.FS, name) }
+
+func (p *prefetchFS) ReadFile(name string) ([]byte, error) { return fs.ReadFile(p.FS, name) }
+
+// stop ends the workers and waits for them.
+func (p *prefetchFS) stop() {
+	p.mu.Lock()
+	p.stopped = true
+	p.cond.Broadcast()
+	p.mu.Unlock()
+	p.workers.Wait()
+}
+
+// readDirInfo lists dir, sorted by name, with each entry's information
+// looked up already, so the walk doesn't wait for it either.
+func readDirInfo(fsys fs.FS, dir string) ([]fs.DirEntry, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	for i, e := range entries {
+		if info, err := e.Info(); err == nil {
+			entries[i] = fs.FileInfoToDirEntry(info)
+		}
+	}
+	return entries, err
+}
@@ -0,0 +1,94 @@
+package clap
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+// countingFS counts the times each directory is listed.
+type countingFS struct {
+	fs.FS
+	mu    sync.Mutex
+	reads map[string]int
+}
+
+func (c *countingFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	c.mu.Lock()
+	c.reads[name]++
+	c.mu.Unlock()
+	return fs.ReadDir(c.FS, name)
+}
+
+// ignoredTree has an ignored subtree with more directories than a
+// one-worker prefetchFS reads ahead, listed before the rest.
+func ignoredTree() fstest.MapFS {
+	fsys := fstest.MapFS{".gitignore": {Data: []byte("/a-ignored/\n")}}
+	for i := range 200 {
+		fsys[fmt.Sprintf("a-ignored/d%03d/f.txt", i)] = &fstest.MapFile{Data: []byte("ignored\n")}
+		fsys[fmt.Sprintf("src/d%03d/f.txt", i)] = &fstest.MapFile{Data: []byte(fmt.Sprintf("file %d\n", i))}
+	}
+	return fsys
+}
+
+func TestPrefetchPrune(t *testing.T) {
+	fsys := &countingFS{FS: ignoredTree(), reads: map[string]int{}}
+	p := newPrefetchFS(fsys, 1, func(string, fs.DirEntry) bool { return true })
+	defer p.stop()
+
+	// Let the worker fill its limit, mostly with the ignored subtree.
+	p.mu.Lock()
+	for p.ready < p.limit {
+		p.cond.Wait()
+	}
+	p.mu.Unlock()
+
+	err := fs.WalkDir(p, ".", func(rel string, d fs.DirEntry, err error) error {
+		if err == nil && d.IsDir() && rel == "a-ignored" {
+			p.prune(rel)
+			return fs.SkipDir
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.mu.Lock()
+	ready, left := p.ready, len(p.dirs)
+	p.mu.Unlock()
+	if ready != 0 || left != 0 {
+		t.Errorf("after the walk, %d listings ready and %d kept, want none", ready, left)
+	}
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+	for i := range 200 {
+		if dir := fmt.Sprintf("src/d%03d", i); fsys.reads[dir] != 1 {
+			t.Errorf("%s listed %d times, want once", dir, fsys.reads[dir])
+		}
+	}
+}
+
+func TestPrefetchSameBundle(t *testing.T) {
+	fsys := ignoredTree()
+	var want bytes.Buffer
+	for _, jobs := range []int{1, 4} {
+		b, err := New(Options{WalkJobs: jobs, Reproducible: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := b.Run(context.Background(), fsys, &buf); err != nil {
+			t.Fatal(err)
+		}
+		if jobs == 1 {
+			want = buf
+		} else if buf.String() != want.String() {
+			t.Errorf("WalkJobs %d bundles differently from a serial walk", jobs)
+		}
+	}
+}
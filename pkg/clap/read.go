@@ -0,0 +1,283 @@
+package clap
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io"
+	"io/fs"
+	"regexp"
+	"sync"
+)
+
+// fileJob is a file selected by the walk. Workers fill in result; the
+// writer consumes jobs in walk order, so output stays deterministic no
+// matter which worker finishes first.
+type fileJob struct {
+	src  *Source
+	rel  string // slash-separated path within src.FS
+	path string // display path used in headers and events
+	info fs.FileInfo
+
+	skipped string      // set before reading when the file is known to be left out
+	pre     *fileResult // read ahead of the writer, for Options.FitTokens
+	result  chan fileResult
+}
+
+// fileResult is what a worker learned about a file.
+type fileResult struct {
+	content    []byte
+	tokens     int
+	redactions []Redaction
+	encoding   string // converted from, or ""
+	truncated  bool
+	sanitized  bool
+	hash       [32]byte // SHA-256 of content, when deduplicating
+	skipped    string   // reason the file is left out, or ""
+	err        error
+}
+
+// fileReader loads file contents and their token counts.
+type fileReader struct {
+	tokens        *tokenizer
+	includeBinary bool
+	keepEncoding  bool
+	keepEmpty     bool
+	stripComments bool
+	signatures    bool
+	redact        bool
+	sanitize      string // Options.Sanitize, never ""
+	escape        bool   // Options.SanitizeEscape
+	langs         languages
+	whitespace    whitespace
+	lineNumbers   bool
+	truncate      truncator
+	dedupe        bool
+	grep          *regexp.Regexp // content must match, unless grepInvert
+	grepInvert    bool
+	noGenerated   bool
+	anonymize     *Anonymizer
+	throttle      *throttle // paces reads to Options.ReadRate, if set
+
+	cache     *Cache
+	cacheSalt string // settings that change what reading gives, part of every key
+}
+
+// cacheKey is job's key in the cache.
+func (fr *fileReader) cacheKey(job *fileJob) string {
+	return fr.cacheSalt + "\x00" + job.path
+}
+
+// startReaders launches n workers that read every job sent on the
+// returned channel. Close the channel once the walk is done.
+func (fr *fileReader) startReaders(n int) chan<- *fileJob {
+	work := make(chan *fileJob, n)
+	for range max(n, 1) {
+		go func() {
+			for job := range work {
+				job.result <- fr.read(job)
+			}
+		}()
+	}
+	return work
+}
+
+// probe marks the jobs read would skip as skipped, using n workers:
+// binaries, unless includeBinary, blank files, unless keepEmpty, generated
+// files, with noGenerated, and with grep, files whose content doesn't
+// match. Without grep, only sniffSize bytes of each file are read.
+func (fr *fileReader) probe(ctx context.Context, jobs []*fileJob, n int) {
+	next := make(chan *fileJob)
+	var wg sync.WaitGroup
+	for range max(n, 1) {
+		wg.Go(func() {
+			for job := range next {
+				if reason := fr.probeFile(job); reason != "" {
+					job.skipped = reason
+				}
+			}
+		})
+	}
+
+	for _, job := range jobs {
+		if job.skipped != "" {
+			continue
+		}
+		select {
+		case next <- job:
+		case <-ctx.Done():
+		}
+	}
+	close(next)
+	wg.Wait()
+}
+
+// isBinary is isBinary, except that files with a UTF-16 byte order mark
+// are text unless they are kept in their original encoding.
+func (fr *fileReader) isBinary(name string, head []byte) bool {
+	if !fr.keepEncoding && hasUTF16BOM(head) {
+		return isBinary(name, nil)
+	}
+	return isBinary(name, head)
+}
+
+// probeFile returns the reason read would skip job, or "". Errors are
+// left for read to report.
+func (fr *fileReader) probeFile(job *fileJob) string {
+	if fr.cache != nil {
+		if result, ok := fr.cache.lookup(fr.cacheKey(job), job.info); ok {
+			return result.skipped
+		}
+	}
+	file, err := job.src.FS.Open(job.rel)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+	r := fr.throttle.reader(file)
+	head, err := readHead(r)
+	if err != nil {
+		return ""
+	}
+	if !fr.includeBinary && fr.isBinary(job.rel, head) {
+		return SkippedBinary
+	}
+	if !fr.keepEmpty && len(head) < sniffSize && fr.isBlank(head) {
+		// Larger files are left for read to find blank.
+		return SkippedEmpty
+	}
+	if fr.noGenerated && isGenerated(job.rel, head) {
+		return SkippedGenerated
+	}
+	if fr.grep == nil {
+		return ""
+	}
+	rest, err := io.ReadAll(r)
+	if err != nil {
+		return ""
+	}
+	content := append(head, rest...)
+	if !fr.keepEncoding {
+		content, _ = toUTF8(content)
+	}
+	if !fr.matches(content) {
+		return SkippedNoMatch
+	}
+	return ""
+}
+
+// isBlank reports whether content, once transcoded, is empty or holds
+// only whitespace.
+func (fr *fileReader) isBlank(content []byte) bool {
+	if !fr.keepEncoding {
+		content, _ = toUTF8(content)
+	}
+	return len(bytes.TrimSpace(content)) == 0
+}
+
+// matches reports whether content passes the grep filter.
+func (fr *fileReader) matches(content []byte) bool {
+	return fr.grep == nil || fr.grep.Match(content) != fr.grepInvert
+}
+
+// readHead reads up to sniffSize bytes from r.
+func readHead(r io.Reader) ([]byte, error) {
+	head := make([]byte, sniffSize)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	return head[:n], nil
+}
+
+// read loads one file, from the cache if it hasn't changed since.
+func (fr *fileReader) read(job *fileJob) fileResult {
+	if fr.cache == nil {
+		return fr.load(job)
+	}
+	key := fr.cacheKey(job)
+	if result, ok := fr.cache.lookup(key, job.info); ok {
+		if fr.dedupe && result.skipped == "" {
+			result.hash = sha256.Sum256(result.content)
+		}
+		return result
+	}
+	result := fr.load(job)
+	if result.err == nil {
+		fr.cache.store(key, job.info, result)
+	}
+	return result
+}
+
+// load reads one file, sniffing for binary content before reading it all.
+func (fr *fileReader) load(job *fileJob) fileResult {
+	name := job.rel
+	file, err := job.src.FS.Open(name)
+	if err != nil {
+		return fileResult{err: err}
+	}
+	defer file.Close()
+	r := fr.throttle.reader(file)
+
+	head, err := readHead(r)
+	if err != nil {
+		return fileResult{err: err}
+	}
+	if !fr.includeBinary && fr.isBinary(name, head) {
+		return fileResult{skipped: SkippedBinary}
+	}
+	if fr.noGenerated && isGenerated(name, head) {
+		return fileResult{skipped: SkippedGenerated}
+	}
+
+	rest, err := io.ReadAll(r)
+	if err != nil {
+		return fileResult{err: err}
+	}
+	content := append(head, rest...)
+
+	var encoding string
+	if !fr.keepEncoding {
+		content, encoding = toUTF8(content)
+	}
+	if !fr.keepEmpty && len(bytes.TrimSpace(content)) == 0 {
+		return fileResult{skipped: SkippedEmpty}
+	}
+	// Match what the file says, before anything is stripped or replaced.
+	if !fr.matches(content) {
+		return fileResult{skipped: SkippedNoMatch}
+	}
+	var sanitized bool
+	if fr.langs.sanitizes(fr.sanitize, name) {
+		content, sanitized = sanitize(content, fr.escape)
+	}
+	if fr.signatures {
+		content = signatures(name, content)
+	}
+	if fr.stripComments {
+		content = stripComments(name, content)
+	}
+	var redactions []Redaction
+	if fr.redact {
+		content, redactions = redact(content)
+	}
+	if fr.anonymize != nil {
+		content = fr.anonymize.Content(content)
+	}
+	content = fr.whitespace.apply(content)
+	if fr.lineNumbers {
+		content = numberLines(content)
+	}
+	// Truncate last, so line numbers count from the original start and
+	// redaction sees whole secrets.
+	var truncated bool
+	content, truncated = fr.truncate.truncate(content)
+
+	result := fileResult{content: content, redactions: redactions, encoding: encoding, truncated: truncated, sanitized: sanitized}
+	if fr.dedupe {
+		result.hash = sha256.Sum256(content)
+	}
+
+	result.tokens, result.err = fr.tokens.count(bytes.NewReader(content))
+	return result
+}
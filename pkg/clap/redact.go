@@ -0,0 +1,131 @@
+package clap
+
+import (
+	"bytes"
+	"math"
+	"regexp"
+	"sort"
+)
+
+// Redaction is one secret replaced in a file's content.
+type Redaction struct {
+	Kind string // what the secret looked like, e.g. "aws-access-key"
+	Line int    // 1-based line where it started
+}
+
+// secretPatterns are the secrets Options.Redact looks for. When a pattern
+// has a capture group, only the group is replaced, so the key name in an
+// assignment stays readable.
+var secretPatterns = []struct {
+	kind string
+	re   *regexp.Regexp
+}{
+	{"private-key", regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----[\s\S]*?-----END [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----`)},
+	{"aws-access-key", regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA)[0-9A-Z]{16}\b`)},
+	{"aws-secret-key", regexp.MustCompile(`(?i)aws_?secret_?(?:access_?)?key["']?\s*[:=]\s*["']?([A-Za-z0-9/+=]{40})\b`)},
+	{"github-token", regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{"slack-token", regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`)},
+	{"bearer-token", regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9\-._~+/]{20,}=*)`)},
+	{"secret", regexp.MustCompile(`(?i)(?:password|passwd|secret|token|api_?key)["']?\s*[:=]\s*["']([^"'\s]{8,})["']`)},
+}
+
+// quotedString finds candidates for the high-entropy check.
+var quotedString = regexp.MustCompile(`["'\x60]([A-Za-z0-9+/=_\-]{32,})["'\x60]`)
+
+// minEntropy and minHexEntropy are the Shannon entropies, in bits per
+// character, above which a long quoted string is treated as a secret.
+// Identifiers and prose sit well below them; random base64 and hex keys
+// sit above. Hex gets its own threshold since it tops out at 4 bits.
+const (
+	minEntropy    = 4.3
+	minHexEntropy = 3.5
+)
+
+type secretSpan struct {
+	start, end int
+	kind       string
+}
+
+// redact replaces every secret in content with a "[REDACTED kind]"
+// placeholder and reports what was replaced.
+func redact(content []byte) ([]byte, []Redaction) {
+	var spans []secretSpan
+	for _, p := range secretPatterns {
+		for _, m := range p.re.FindAllSubmatchIndex(content, -1) {
+			start, end := m[0], m[1]
+			if len(m) > 2 && m[2] >= 0 {
+				start, end = m[2], m[3]
+			}
+			spans = append(spans, secretSpan{start, end, p.kind})
+		}
+	}
+	for _, m := range quotedString.FindAllSubmatchIndex(content, -1) {
+		if value := content[m[2]:m[3]]; isRandom(value) {
+			spans = append(spans, secretSpan{m[2], m[3], "high-entropy-string"})
+		}
+	}
+	if len(spans) == 0 {
+		return content, nil
+	}
+
+	// Earlier patterns are more specific, so on overlap the first span to
+	// start names the secret. Overlapping spans are merged, so none of
+	// either is left in the clear.
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	merged := spans[:1]
+	for _, span := range spans[1:] {
+		if top := &merged[len(merged)-1]; span.start < top.end {
+			top.end = max(top.end, span.end)
+			continue
+		}
+		merged = append(merged, span)
+	}
+
+	var out bytes.Buffer
+	var redactions []Redaction
+	last, line := 0, 1
+	for _, span := range merged {
+		line += bytes.Count(content[last:span.start], []byte("\n"))
+		out.Write(content[last:span.start])
+		out.WriteString("[REDACTED " + span.kind + "]")
+		redactions = append(redactions, Redaction{Kind: span.kind, Line: line})
+		line += bytes.Count(content[span.start:span.end], []byte("\n"))
+		last = span.end
+	}
+	out.Write(content[last:])
+	return out.Bytes(), redactions
+}
+
+// isRandom reports whether s looks like a random key: mixed letters and
+// digits with high entropy.
+func isRandom(s []byte) bool {
+	var letters, digits bool
+	hex := true
+	counts := map[byte]int{}
+	for _, c := range s {
+		counts[c]++
+		switch {
+		case c >= '0' && c <= '9':
+			digits = true
+		case c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F':
+			letters = true
+		case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			letters, hex = true, false
+		default:
+			hex = false
+		}
+	}
+	if !letters || !digits {
+		return false
+	}
+
+	entropy := 0.0
+	for _, n := range counts {
+		p := float64(n) / float64(len(s))
+		entropy -= p * math.Log2(p)
+	}
+	if hex {
+		return entropy >= minHexEntropy
+	}
+	return entropy >= minEntropy
+}
@@ -0,0 +1,81 @@
+package clap
+
+import (
+	"fmt"
+	"regexp"
+	"unicode/utf8"
+)
+
+// Options.Sanitize values.
+const (
+	SanitizeAuto = "auto" // files that aren't source code; the default
+	SanitizeAll  = "all"
+	SanitizeOff  = "off"
+)
+
+// ansiSequence matches ANSI escape sequences: CSI sequences such as color
+// codes (ESC [ ... final byte, or the one-byte CSI), OSC sequences such as
+// terminal titles and hyperlinks (ESC ] ... BEL or ESC \, within a line),
+// and the other two-byte escapes.
+var ansiSequence = regexp.MustCompile("(?:\x1b\\[|\u009b)[0-?]*[ -/]*[@-~]|\x1b\\][^\x07\x1b\n]*(?:\x07|\x1b\\\\)?|\x1b[@-Z\\\\-_]")
+
+// sanitizes reports whether mode cleans the file at path: with
+// SanitizeAuto, files in no language or in Markdown, such as logs and
+// terminal captures; code may hold control characters on purpose.
+func (l languages) sanitizes(mode, path string) bool {
+	switch mode {
+	case SanitizeAll:
+		return true
+	case SanitizeOff:
+		return false
+	}
+	lang := l.of(path)
+	return lang == "" || lang == "markdown"
+}
+
+// sanitize removes ANSI escape sequences and control characters other
+// than tab, newline, and the carriage return of a CRLF from content, and
+// reports whether there were any. With escape, they are written as visible
+// escapes such as \x1b instead. Invalid UTF-8 is left alone.
+func sanitize(content []byte, escape bool) ([]byte, bool) {
+	if !hasControl(content) {
+		return content, false
+	}
+	if !escape {
+		content = ansiSequence.ReplaceAll(content, nil)
+	}
+	out := make([]byte, 0, len(content))
+	for i := 0; i < len(content); {
+		r, size := utf8.DecodeRune(content[i:])
+		if isControl(r) && !(r == '\r' && i+1 < len(content) && content[i+1] == '\n') {
+			if escape {
+				out = fmt.Appendf(out, "\\x%02x", r)
+			}
+		} else {
+			out = append(out, content[i:i+size]...)
+		}
+		i += size
+	}
+	return out, true
+}
+
+// hasControl reports whether content has anything sanitize would change.
+func hasControl(content []byte) bool {
+	for i := 0; i < len(content); {
+		r, size := utf8.DecodeRune(content[i:])
+		if isControl(r) && !(r == '\r' && i+1 < len(content) && content[i+1] == '\n') {
+			return true
+		}
+		i += size
+	}
+	return false
+}
+
+// isControl reports whether r is a C0 or C1 control character or DEL,
+// other than tab and newline.
+func isControl(r rune) bool {
+	if r == '\t' || r == '\n' {
+		return false
+	}
+	return r < 0x20 || r == 0x7f || r >= 0x80 && r <= 0x9f
+}
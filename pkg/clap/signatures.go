@@ -0,0 +1,79 @@
+package clap
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path"
+	"strings"
+)
+
+// elidedBody stands in for the function bodies signatures drops.
+const elidedBody = "{ ... }"
+
+// signatureExtractors reduce a source file to its API surface, by
+// extension.
+var signatureExtractors = map[string]func([]byte) ([]byte, bool){
+	".go": goSignatures,
+}
+
+// signatures reduces content to its declarations, if name's language is
+// supported; other files, and files that don't parse, are kept whole.
+func signatures(name string, content []byte) []byte {
+	extract := signatureExtractors[strings.ToLower(path.Ext(name))]
+	if extract == nil {
+		return content
+	}
+	if out, ok := extract(content); ok {
+		return out
+	}
+	return content
+}
+
+// goSignatures keeps the package clause, imports, constants, and type
+// declarations of a Go file, and its functions and methods with their
+// bodies elided, each with its doc comment. Variables are dropped, since
+// their values are implementation. Whatever precedes the package clause,
+// such as build constraints, is kept too.
+func goSignatures(src []byte) ([]byte, bool) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return nil, false
+	}
+	offset := func(pos token.Pos) int { return fset.Position(pos).Offset }
+	span := func(doc *ast.CommentGroup, from, to token.Pos) []byte {
+		if doc != nil {
+			from = doc.Pos()
+		}
+		return src[offset(from):offset(to)]
+	}
+
+	var out bytes.Buffer
+	out.Write(src[:offset(file.Name.End())])
+	out.WriteString("\n")
+	for _, decl := range file.Decls {
+		var text []byte
+		switch decl := decl.(type) {
+		case *ast.GenDecl:
+			if decl.Tok == token.VAR {
+				continue
+			}
+			text = span(decl.Doc, decl.Pos(), decl.End())
+		case *ast.FuncDecl:
+			if decl.Body == nil {
+				text = span(decl.Doc, decl.Pos(), decl.End())
+				break
+			}
+			text = bytes.Clone(bytes.TrimRight(span(decl.Doc, decl.Pos(), decl.Body.Lbrace), " \t"))
+			text = append(text, " "+elidedBody...)
+		default:
+			continue
+		}
+		out.WriteString("\n")
+		out.Write(text)
+		out.WriteString("\n")
+	}
+	return out.Bytes(), true
+}
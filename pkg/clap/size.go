@@ -0,0 +1,59 @@
+package clap
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// sizeUnits maps unit suffixes to byte multipliers. Units are binary, so
+// "200KB" is 200*1024 bytes.
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"kib", 1 << 10}, {"mib", 1 << 20}, {"gib", 1 << 30},
+	{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30},
+	{"k", 1 << 10}, {"m", 1 << 20}, {"g", 1 << 30},
+	{"b", 1},
+}
+
+// ParseSize parses a human-readable size such as "512", "200KB", or
+// "1.5m" into bytes.
+func ParseSize(s string) (int64, error) {
+	value := strings.ToLower(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			multiplier = unit.bytes
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// FormatSize renders bytes with the largest binary unit that keeps the
+// value at or above one, e.g. "200KB" or "1.5MB".
+func FormatSize(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return formatUnit(n, 1<<30, "GB")
+	case n >= 1<<20:
+		return formatUnit(n, 1<<20, "MB")
+	case n >= 1<<10:
+		return formatUnit(n, 1<<10, "KB")
+	}
+	return fmt.Sprintf("%dB", n)
+}
+
+// formatUnit renders n in the given unit with at most one decimal.
+func formatUnit(n, unit int64, suffix string) string {
+	value := strconv.FormatFloat(float64(n)/float64(unit), 'f', 1, 64)
+	return strings.TrimSuffix(value, ".0") + suffix
+}
@@ -0,0 +1,120 @@
+package clap
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+)
+
+// FormatOutput is one of the bundles RunFormats writes.
+type FormatOutput struct {
+	Format string // as Options.Format
+	W      io.Writer
+}
+
+// RunFormats is like RunSources but writes one bundle per output, each in
+// its own format, from a single walk and read of the files. Every file
+// gets the same content in each, so archive formats, which keep files
+// byte for byte, can only be combined with each other. Split limits are
+// ignored and Options.Placed isn't called.
+func (b *Bundler) RunFormats(ctx context.Context, sources []Source, outputs []FormatOutput) error {
+	tee := &teeFormatter{}
+	archives := 0
+	for _, o := range outputs {
+		format, err := newBundleFormatter(b.opts, o.Format)
+		if err != nil {
+			return err
+		}
+		if isArchive(format) {
+			archives++
+		}
+		tee.formats = append(tee.formats, format)
+		tee.outs = append(tee.outs, bufio.NewWriterSize(o.W, 64*1024))
+	}
+	if archives > 0 && archives < len(outputs) {
+		return fmt.Errorf("archive formats can't be written alongside text formats")
+	}
+
+	multi := *b
+	multi.format = tee
+	multi.opts.Placed = nil
+	if archives > 0 {
+		multi.opts.KeepEncoding = true
+	}
+	return multi.RunSources(ctx, sources, io.Discard)
+}
+
+// teeFormatter writes every call to each of its formatters, each to its
+// own output. The writer it is handed is ignored.
+type teeFormatter struct {
+	formats []formatter
+	outs    []*bufio.Writer
+}
+
+func (t *teeFormatter) begin(io.Writer) error {
+	for i, f := range t.formats {
+		if err := f.begin(t.outs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *teeFormatter) writeTree(_ io.Writer, tree string) error {
+	for i, f := range t.formats {
+		if err := f.writeTree(t.outs[i], tree); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFrontMatter is only called when every format takes front matter.
+func (t *teeFormatter) writeFrontMatter(_ io.Writer, block string) error {
+	for i, f := range t.formats {
+		if err := f.(frontMatterWriter).writeFrontMatter(t.outs[i], block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writePackageHeader is only called when every format takes package
+// headers.
+func (t *teeFormatter) writePackageHeader(_ io.Writer, name string) error {
+	for i, f := range t.formats {
+		if err := f.(packageHeaderWriter).writePackageHeader(t.outs[i], name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *teeFormatter) partHeader(part, total int) string { return "" }
+
+// writeFile rewinds the content for each formatter.
+func (t *teeFormatter) writeFile(_ io.Writer, path string, info fs.FileInfo, r io.ReadSeeker) error {
+	for i, f := range t.formats {
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		if err := f.writeFile(t.outs[i], path, info, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *teeFormatter) end(io.Writer) error {
+	for i, f := range t.formats {
+		if err := f.end(t.outs[i]); err != nil {
+			return err
+		}
+		if err := t.outs[i].Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package clap
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// throttleChunk is the most read at once through a throttle, so the pauses
+// between reads stay short and the rate even.
+const throttleChunk = 64 << 10
+
+// throttle paces reads across all workers to Options.ReadRate.
+type throttle struct {
+	rate int64 // bytes per second
+
+	mu   sync.Mutex
+	next time.Time // when the bytes read so far are paid for
+}
+
+// newThrottle returns a throttle for rate bytes per second, or nil, which
+// reads at full speed, if rate isn't positive.
+func newThrottle(rate int64) *throttle {
+	if rate <= 0 {
+		return nil
+	}
+	return &throttle{rate: rate}
+}
+
+// reader returns r, paced by t when t isn't nil.
+func (t *throttle) reader(r io.Reader) io.Reader {
+	if t == nil {
+		return r
+	}
+	return &throttledReader{r: r, t: t}
+}
+
+// wait blocks until n more bytes fit the rate.
+func (t *throttle) wait(n int) {
+	t.mu.Lock()
+	now := time.Now()
+	if t.next.Before(now) {
+		t.next = now
+	}
+	t.next = t.next.Add(time.Duration(int64(n) * int64(time.Second) / t.rate))
+	delay := t.next.Sub(now)
+	t.mu.Unlock()
+	time.Sleep(delay)
+}
+
+type throttledReader struct {
+	r io.Reader
+	t *throttle
+}
+
+func (tr *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > throttleChunk {
+		p = p[:throttleChunk]
+	}
+	n, err := tr.r.Read(p)
+	if n > 0 {
+		tr.t.wait(n)
+	}
+	return n, err
+}
@@ -0,0 +1,70 @@
+package clap
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+// tokenChunkSize bounds how much content is held in memory while counting.
+// Chunks are cut at line breaks where possible, which BPE pre-tokenization
+// rarely merges across, so counts match encoding the whole file.
+const tokenChunkSize = 64 * 1024
+
+// tokenizers maps --tokenizer names to tiktoken encodings.
+var tokenizers = map[string]string{
+	"cl100k": "cl100k_base",
+	"o200k":  "o200k_base",
+}
+
+// tokenizer counts tokens the way OpenAI-compatible BPE encodings do,
+// using vocabularies embedded in the binary so no download is needed.
+type tokenizer struct {
+	enc *tiktoken.Tiktoken
+}
+
+// newTokenizer loads the encoding registered under name.
+func newTokenizer(name string) (*tokenizer, error) {
+	if name == "" {
+		name = "cl100k"
+	}
+	encoding, ok := tokenizers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown tokenizer %q (want cl100k or o200k)", name)
+	}
+
+	tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+	enc, err := tiktoken.GetEncoding(encoding)
+	if err != nil {
+		return nil, err
+	}
+	return &tokenizer{enc: enc}, nil
+}
+
+// count returns the number of tokens in r, reading at most tokenChunkSize
+// bytes (plus the rest of the current line) at a time.
+func (t *tokenizer) count(r io.Reader) (int, error) {
+	br := bufio.NewReaderSize(r, tokenChunkSize)
+	var chunk bytes.Buffer
+	total := 0
+
+	for {
+		line, err := br.ReadSlice('\n')
+		chunk.Write(line)
+		if err != nil && err != bufio.ErrBufferFull && err != io.EOF {
+			return 0, err
+		}
+
+		if chunk.Len() >= tokenChunkSize || err == io.EOF {
+			total += len(t.enc.EncodeOrdinary(chunk.String()))
+			chunk.Reset()
+		}
+		if err == io.EOF {
+			return total, nil
+		}
+	}
+}
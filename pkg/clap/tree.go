@@ -0,0 +1,96 @@
+package clap
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// treeNode is a directory or file in the rendered tree. Children keep the
+// order they were added in, which is walk order.
+type treeNode struct {
+	name     string
+	children []*treeNode
+	index    map[string]*treeNode
+}
+
+// child returns the named child, creating it if needed.
+func (n *treeNode) child(name string) *treeNode {
+	if c, ok := n.index[name]; ok {
+		return c
+	}
+	c := &treeNode{name: name}
+	if n.index == nil {
+		n.index = map[string]*treeNode{}
+	}
+	n.index[name] = c
+	n.children = append(n.children, c)
+	return c
+}
+
+// renderTree draws the files that will be bundled as a `tree`-style
+// listing, one tree per source labelled with the root the user named,
+// less prefix, and the empty files left out, marked "(empty)". With anon,
+// the labels and names are its pseudonyms, as in the headers.
+func renderTree(sources []Source, jobs []*fileJob, prefix string, anon *Anonymizer) string {
+	var sb strings.Builder
+	for i := range sources {
+		src := &sources[i]
+		label := stripPrefix(src.Root, prefix)
+		if label != "" && stripPrefix(prefix, label) != filepath.Clean(prefix) {
+			// The prefix reaches into the walk, so paths are shown from
+			// where it ends.
+			label = ""
+		}
+		if anon != nil && label != "" {
+			label = anon.Path(label)
+		}
+		root := &treeNode{}
+		for _, job := range jobs {
+			if job.src != src || job.skipped != "" && job.skipped != SkippedEmpty {
+				continue
+			}
+			rel := job.rel
+			if anon != nil {
+				rel = filepath.ToSlash(anon.Path(rel))
+			}
+			if prefix != "" {
+				rel = filepath.ToSlash(job.path)
+				if label != "" && filepath.Clean(label) != "." {
+					rel = strings.TrimPrefix(rel, filepath.ToSlash(filepath.Clean(label))+"/")
+				}
+			}
+			if job.skipped == SkippedEmpty {
+				rel += " (empty)"
+			}
+			node := root
+			for _, part := range strings.Split(rel, "/") {
+				node = node.child(part)
+			}
+		}
+
+		if label == "" {
+			label = "."
+		}
+		sb.WriteString(label)
+		sb.WriteString("\n")
+		writeTreeNodes(&sb, root.children, "")
+	}
+	return sb.String()
+}
+
+// writeTreeNodes writes nodes and their descendants, each line prefixed
+// with the branch art inherited from its ancestors.
+func writeTreeNodes(sb *strings.Builder, nodes []*treeNode, prefix string) {
+	for i, node := range nodes {
+		branch, indent := "├── ", "│   "
+		if i == len(nodes)-1 {
+			branch, indent = "└── ", "    "
+		}
+
+		sb.WriteString(prefix)
+		sb.WriteString(branch)
+		sb.WriteString(node.name)
+		sb.WriteString("\n")
+		writeTreeNodes(sb, node.children, prefix+indent)
+	}
+}
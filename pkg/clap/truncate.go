@@ -0,0 +1,134 @@
+package clap
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+)
+
+// truncator cuts long files down to a head, and optionally a tail, around
+// a marker line saying how much was left out.
+type truncator struct {
+	lines int   // lines to keep; zero means no limit
+	bytes int64 // bytes to keep, marker aside; zero means no limit
+	tail  bool  // keep the end too, splitting the limits evenly
+}
+
+// truncate returns content cut to the limits, and whether it was cut.
+// Whole lines are kept where possible; a single line longer than the byte
+// limit, such as minified JSON, is cut mid-line.
+func (t truncator) truncate(content []byte) ([]byte, bool) {
+	head, tail := len(content), len(content) // content[:head] and content[tail:] are kept
+
+	if t.lines > 0 {
+		keepHead, keepTail := t.lines, 0
+		if t.tail {
+			keepHead, keepTail = t.lines-t.lines/2, t.lines/2
+		}
+		head = lineOffset(content, keepHead)
+		if keepTail > 0 {
+			tail = lastLinesOffset(content, keepTail)
+		}
+	}
+	if head >= tail {
+		head, tail = len(content), len(content)
+	}
+
+	if t.bytes > 0 && int64(head+len(content)-tail) > t.bytes {
+		budgetHead, budgetTail := t.bytes, int64(0)
+		if t.tail {
+			budgetHead, budgetTail = t.bytes-t.bytes/2, t.bytes/2
+		}
+		if head == len(content) {
+			// Nothing was cut yet, so the tail may reach back to the start.
+			tail = 0
+		}
+		if int64(head) > budgetHead {
+			head = int(budgetHead)
+			if nl := bytes.LastIndexByte(content[:head], '\n'); nl >= 0 {
+				head = nl + 1
+			} else {
+				for head > 0 && !utf8.RuneStart(content[head]) {
+					head--
+				}
+			}
+		}
+		if int64(len(content)-tail) > budgetTail {
+			tail = len(content) - int(budgetTail)
+			if tail < len(content) && content[tail-1] != '\n' {
+				if nl := bytes.IndexByte(content[tail:len(content)-1], '\n'); nl >= 0 {
+					tail += nl + 1
+				} else {
+					for tail < len(content) && !utf8.RuneStart(content[tail]) {
+						tail++
+					}
+				}
+			}
+		}
+	}
+	if head >= tail {
+		return content, false
+	}
+
+	cut := content[head:tail]
+	var marker string
+	if (head == 0 || content[head-1] == '\n') && (tail == len(content) || content[tail-1] == '\n') {
+		lines := bytes.Count(cut, []byte("\n"))
+		if cut[len(cut)-1] != '\n' {
+			lines++
+		}
+		marker = fmt.Sprintf("…[truncated %s lines]…\n", groupDigits(lines))
+	} else {
+		marker = fmt.Sprintf("…[truncated %s bytes]…\n", groupDigits(len(cut)))
+	}
+
+	var out bytes.Buffer
+	out.Grow(head + len(marker) + 1 + len(content) - tail)
+	out.Write(content[:head])
+	if head > 0 && content[head-1] != '\n' {
+		out.WriteByte('\n')
+	}
+	out.WriteString(marker)
+	out.Write(content[tail:])
+	return out.Bytes(), true
+}
+
+// lineOffset returns the offset just past the first n lines of content.
+func lineOffset(content []byte, n int) int {
+	offset := 0
+	for range n {
+		nl := bytes.IndexByte(content[offset:], '\n')
+		if nl < 0 {
+			return len(content)
+		}
+		offset += nl + 1
+	}
+	return offset
+}
+
+// lastLinesOffset returns the offset where the last n lines of content
+// start. A final line without a newline counts.
+func lastLinesOffset(content []byte, n int) int {
+	end := len(content)
+	if end > 0 && content[end-1] == '\n' {
+		end--
+	}
+	for range n {
+		nl := bytes.LastIndexByte(content[:end], '\n')
+		if nl < 0 {
+			return 0
+		}
+		end = nl
+	}
+	return end + 1
+}
+
+// groupDigits formats n with commas between groups of three digits.
+func groupDigits(n int) string {
+	s := strconv.Itoa(n)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "," + s[i:]
+	}
+	return s
+}
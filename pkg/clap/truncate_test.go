@@ -0,0 +1,73 @@
+package clap
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestTruncate(t *testing.T) {
+	ten := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"
+	tests := []struct {
+		name string
+		t    truncator
+		in   string
+		want string // "" for unchanged
+	}{
+		{"head", truncator{lines: 3}, ten, "1\n2\n3\n…[truncated 7 lines]…\n"},
+		{"head and tail", truncator{lines: 4, tail: true}, ten, "1\n2\n…[truncated 6 lines]…\n9\n10\n"},
+		{"odd lines", truncator{lines: 5, tail: true}, ten, "1\n2\n3\n…[truncated 5 lines]…\n9\n10\n"},
+		{"no final newline", truncator{lines: 4, tail: true}, "a\nb\nc\nd\ne\nf\ng", "a\nb\n…[truncated 3 lines]…\nf\ng"},
+		{"at the limit", truncator{lines: 10}, ten, ""},
+		{"under the limit", truncator{lines: 20, tail: true}, ten, ""},
+		{"head bytes", truncator{bytes: 7}, ten, "1\n2\n3\n…[truncated 7 lines]…\n"},
+		{"head and tail bytes", truncator{bytes: 8, tail: true}, ten, "1\n2\n…[truncated 7 lines]…\n10\n"},
+		{"lines then bytes", truncator{lines: 6, bytes: 4}, ten, "1\n2\n…[truncated 8 lines]…\n"},
+		{"long line", truncator{bytes: 10}, strings.Repeat("x", 100), strings.Repeat("x", 10) + "\n…[truncated 90 bytes]…\n"},
+		{"long line tail", truncator{bytes: 10, tail: true}, strings.Repeat("x", 100), strings.Repeat("x", 5) + "\n…[truncated 90 bytes]…\n" + strings.Repeat("x", 5)},
+		{"utf-8", truncator{bytes: 3}, "ééééé", "é\n…[truncated 8 bytes]…\n"},
+		{"thousands", truncator{lines: 1}, strings.Repeat("line\n", 1500), "line\n…[truncated 1,499 lines]…\n"},
+	}
+	for _, tt := range tests {
+		got, cut := tt.t.truncate([]byte(tt.in))
+		want := tt.want
+		if want == "" {
+			want = tt.in
+		}
+		if string(got) != want || cut != (tt.want != "") {
+			t.Errorf("%s: truncate(%q) = %q, %v, want %q, %v", tt.name, tt.in, got, cut, want, tt.want != "")
+		}
+	}
+}
+
+func TestGroupDigits(t *testing.T) {
+	for n, want := range map[int]string{0: "0", 999: "999", 1000: "1,000", 1234567: "1,234,567"} {
+		if got := groupDigits(n); got != want {
+			t.Errorf("groupDigits(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestTruncateBundle(t *testing.T) {
+	fsys := fstest.MapFS{
+		"long.txt":  {Data: []byte("1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n")},
+		"short.txt": {Data: []byte("1\n2\n")},
+	}
+	truncated := map[string]bool{}
+	b, err := New(Options{TruncateLines: 4, TruncateTail: true, Report: func(e Event) { truncated[e.Path] = e.Truncated }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := b.Run(context.Background(), fsys, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if !truncated["long.txt"] || truncated["short.txt"] {
+		t.Errorf("truncated %v, want just long.txt", truncated)
+	}
+	if want := "=== long.txt ===\n1\n2\n…[truncated 6 lines]…\n9\n10\n"; !strings.Contains(buf.String(), want) {
+		t.Errorf("bundle doesn't have %q:\n%s", want, buf.String())
+	}
+}
@@ -0,0 +1,101 @@
+package clap
+
+import (
+	"bytes"
+	"fmt"
+	"unicode/utf8"
+)
+
+// Options.NormalizeEOL values.
+const (
+	EOLKeep = "keep" // the default
+	EOLLF   = "lf"
+	EOLCRLF = "crlf"
+)
+
+// whitespace is the Options that rewrite line endings and blanks.
+type whitespace struct {
+	eol  string // EOLLF or EOLCRLF, or "" to keep line endings
+	trim bool   // drop spaces and tabs at the ends of lines
+	tabs int    // expand tabs to stops this many columns apart, if > 0
+}
+
+// newWhitespace checks Options.NormalizeEOL and Options.TabsToSpaces.
+func newWhitespace(opts Options) (whitespace, error) {
+	ws := whitespace{trim: opts.TrimTrailingSpace, tabs: opts.TabsToSpaces}
+	switch opts.NormalizeEOL {
+	case "", EOLKeep:
+	case EOLLF, EOLCRLF:
+		ws.eol = opts.NormalizeEOL
+	default:
+		return whitespace{}, fmt.Errorf("unknown line ending %q (want %s, %s, or %s)", opts.NormalizeEOL, EOLLF, EOLCRLF, EOLKeep)
+	}
+	if ws.tabs < 0 {
+		return whitespace{}, fmt.Errorf("negative tab width %d", ws.tabs)
+	}
+	return ws, nil
+}
+
+// active reports whether apply changes anything.
+func (ws whitespace) active() bool {
+	return ws.eol != "" || ws.trim || ws.tabs > 0
+}
+
+// apply rewrites content line by line: trailing blanks first, then tabs,
+// then line endings, which are "\n" or "\r\n".
+func (ws whitespace) apply(content []byte) []byte {
+	if !ws.active() || len(content) == 0 {
+		return content
+	}
+	out := make([]byte, 0, len(content)+len(content)/16)
+	for len(content) > 0 {
+		line, ending := content, ""
+		if i := bytes.IndexByte(content, '\n'); i >= 0 {
+			line, content = content[:i], content[i+1:]
+			ending = "\n"
+			if len(line) > 0 && line[len(line)-1] == '\r' {
+				line, ending = line[:len(line)-1], "\r\n"
+			}
+		} else {
+			content = nil
+		}
+
+		if ws.trim {
+			line = bytes.TrimRight(line, " \t")
+		}
+		if ws.tabs > 0 {
+			out = ws.expandTabs(out, line)
+		} else {
+			out = append(out, line...)
+		}
+		if ending != "" {
+			switch ws.eol {
+			case EOLLF:
+				ending = "\n"
+			case EOLCRLF:
+				ending = "\r\n"
+			}
+			out = append(out, ending...)
+		}
+	}
+	return out
+}
+
+// expandTabs appends line to out with each tab replaced by the spaces up
+// to the next tab stop, counting columns in runes.
+func (ws whitespace) expandTabs(out, line []byte) []byte {
+	col := 0
+	for len(line) > 0 {
+		r, size := utf8.DecodeRune(line)
+		if r == '\t' {
+			n := ws.tabs - col%ws.tabs
+			out = append(out, bytes.Repeat([]byte{' '}, n)...)
+			col += n
+		} else {
+			out = append(out, line[:size]...)
+			col++
+		}
+		line = line[size:]
+	}
+	return out
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package main
+
+// hostPath returns path as given: only Windows has the \\?\ form.
+func hostPath(path string) string { return path }
+
+// samePath reports whether a and b, both cleaned, name the same file.
+func samePath(a, b string) bool { return a == b }
+
+// reservedName reports false: outside Windows, no file names are taken
+// by devices.
+func reservedName(name string) bool { return false }
@@ -0,0 +1,38 @@
+//go:build !windows
+
+package main
+
+import "testing"
+
+func TestHostPath(t *testing.T) {
+	// Only Windows has the long form; elsewhere a backslash is just a byte
+	// in a file name.
+	for _, path := range []string{`\\?\C:\src`, `\\?\UNC\server\share`, "/src/project", "relative/dir"} {
+		if got := hostPath(path); got != path {
+			t.Errorf("hostPath(%q) = %q, want it unchanged", path, got)
+		}
+	}
+}
+
+func TestReservedName(t *testing.T) {
+	for _, name := range []string{"NUL", "com1.txt", "CON .txt", "aux"} {
+		if reservedName(name) {
+			t.Errorf("reservedName(%q) = true, want false outside Windows", name)
+		}
+	}
+}
+
+func TestSamePath(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"/src/clap.file", "/src/clap.file", true},
+		{"/src/clap.file", "/SRC/Clap.File", false},
+	}
+	for _, tt := range tests {
+		if got := samePath(tt.a, tt.b); got != tt.want {
+			t.Errorf("samePath(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
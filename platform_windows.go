@@ -0,0 +1,48 @@
+//go:build windows
+
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// hostPath turns a \\?\ long path into its ordinary form, \\?\C:\dir into
+// C:\dir and \\?\UNC\server\share into \\server\share. The long form turns
+// off the path normalization that os.DirFS relies on when it joins names
+// with a forward slash, and Go adds the prefix back itself where a path
+// is too long to do without.
+func hostPath(path string) string {
+	if rest, ok := strings.CutPrefix(path, `\\?\UNC\`); ok {
+		return `\\` + rest
+	}
+	if rest, ok := strings.CutPrefix(path, `\\?\`); ok && len(filepath.VolumeName(rest)) == 2 {
+		return rest
+	}
+	return path
+}
+
+// samePath reports whether a and b, both cleaned, name the same file.
+// Windows file names are case-insensitive.
+func samePath(a, b string) bool { return strings.EqualFold(a, b) }
+
+// reservedNames are the device names Windows keeps for itself, with or
+// without an extension.
+var reservedNames = []string{
+	"CON", "PRN", "AUX", "NUL", "CONIN$", "CONOUT$",
+	"COM1", "COM2", "COM3", "COM4", "COM5", "COM6", "COM7", "COM8", "COM9", "COM¹", "COM²", "COM³",
+	"LPT1", "LPT2", "LPT3", "LPT4", "LPT5", "LPT6", "LPT7", "LPT8", "LPT9", "LPT¹", "LPT²", "LPT³",
+}
+
+// reservedName reports whether name, a single path element, is a device
+// name that Windows won't create a file under, such as NUL or com1.txt.
+func reservedName(name string) bool {
+	stem, _, _ := strings.Cut(name, ".")
+	stem = strings.TrimRight(stem, " ")
+	for _, reserved := range reservedNames {
+		if strings.EqualFold(stem, reserved) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+//go:build windows
+
+package main
+
+import "testing"
+
+func TestHostPath(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`\\?\C:\src\project`, `C:\src\project`},
+		{`\\?\c:\`, `c:\`},
+		{`\\?\UNC\server\share\dir`, `\\server\share\dir`},
+		{`\\server\share\dir`, `\\server\share\dir`},
+		{`C:\src`, `C:\src`},
+		{`relative\dir`, `relative\dir`},
+		// Device paths other than drive letters keep their prefix.
+		{`\\?\Volume{0b1c}\dir`, `\\?\Volume{0b1c}\dir`},
+	}
+	for _, tt := range tests {
+		if got := hostPath(tt.in); got != tt.want {
+			t.Errorf("hostPath(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestReservedName(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"NUL", true},
+		{"nul", true},
+		{"com1.txt", true},
+		{"CON .txt", true},
+		{"aux.tar.gz", true},
+		{"LPT9", true},
+		{"COM¹", true},
+		{"CONIN$", true},
+		{"console.txt", false},
+		{"com10", false},
+		{"nul_device", false},
+		{"my.nul", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := reservedName(tt.name); got != tt.want {
+			t.Errorf("reservedName(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSamePath(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{`C:\src\clap.file`, `c:\SRC\Clap.File`, true},
+		{`C:\src\clap.file`, `C:\src\clap.file`, true},
+		{`C:\src\clap.file`, `C:\src\clap.files`, false},
+	}
+	for _, tt := range tests {
+		if got := samePath(tt.a, tt.b); got != tt.want {
+			t.Errorf("samePath(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestSafeJoinReserved(t *testing.T) {
+	for _, name := range []string{"NUL", "dir/com1.txt", "CON .txt", `a\aux\b.go`} {
+		if got, err := safeJoin(`C:\out`, name); err == nil {
+			t.Errorf("safeJoin(%q) = %q, want an error for a reserved name", name, got)
+		}
+	}
+	got, err := safeJoin(`C:\out`, "src/console.go")
+	if err != nil || got != `C:\out\src\console.go` {
+		t.Errorf(`safeJoin("src/console.go") = %q, %v, want C:\out\src\console.go`, got, err)
+	}
+}
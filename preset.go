@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// languagePreset is the selection that suits one ecosystem, added by
+// --preset to whatever the command line and the project config select.
+type languagePreset struct {
+	extensions []string // source file extensions
+	names      []string // manifests and build files bundled whatever their extension
+	exclude    []string // generated and vendored paths the default excludes miss
+}
+
+// presets lists the --preset selections.
+var presets = map[string]languagePreset{
+	"go": {
+		extensions: []string{".go"},
+		names:      []string{"go.mod", "go.work", "Makefile"},
+		exclude:    []string{"vendor/"},
+	},
+	"python": {
+		extensions: []string{".py", ".pyi"},
+		names:      []string{"pyproject.toml", "setup.cfg", "requirements.txt", "Pipfile", "tox.ini"},
+		exclude:    []string{"venv/", "*.egg-info/", ".tox/", ".mypy_cache/", ".pytest_cache/"},
+	},
+	"node": {
+		extensions: []string{".js", ".mjs", ".cjs", ".ts", ".mts", ".cts", ".jsx", ".tsx"},
+		names:      []string{"package.json", "tsconfig.json"},
+		exclude:    []string{"coverage/", ".next/", "*.min.js"},
+	},
+	"rust": {
+		extensions: []string{".rs"},
+		names:      []string{"Cargo.toml", "rust-toolchain.toml"},
+	},
+	"web": {
+		extensions: []string{".html", ".css", ".scss", ".sass", ".less", ".js", ".mjs", ".ts", ".jsx", ".tsx", ".vue", ".svelte", ".astro"},
+		names:      []string{"package.json", "tsconfig.json"},
+		exclude:    []string{"coverage/", ".next/", ".nuxt/", ".svelte-kit/", "*.min.js", "*.min.css"},
+	},
+}
+
+// presetNames returns the preset names, sorted.
+func presetNames() []string {
+	return slices.Sorted(maps.Keys(presets))
+}
+
+// findPreset returns the preset called name.
+func findPreset(name string) (languagePreset, error) {
+	preset, ok := presets[name]
+	if !ok {
+		return languagePreset{}, fmt.Errorf("unknown preset %q (want %s)", name, strings.Join(presetNames(), ", "))
+	}
+	return preset, nil
+}
+
+// apply adds the preset's extensions, names, and excludes to the flags.
+// Unlike a --model preset it adds to explicit values rather than giving
+// way to them, so "-e .sql" extends a preset instead of replacing it.
+func (l languagePreset) apply(flags *flag.FlagSet) error {
+	var errs []error
+	set := func(name string, values []string) {
+		for _, value := range values {
+			errs = append(errs, flags.Set(name, value))
+		}
+	}
+	set("e", l.extensions)
+	set("include-name", l.names)
+	set("exclude", l.exclude)
+	return errors.Join(errs...)
+}
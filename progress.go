@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+
+	"clap/pkg/clap"
+)
+
+// progressBar is a one-line bar on stderr showing how far a bundle has
+// got. Log lines are printed above it: logf clears it first and draws it
+// again after.
+type progressBar struct {
+	total int // files to report, once the walk is done
+	files int
+	bytes int64
+	start time.Time
+	drawn time.Time // last redraw
+	shown bool
+}
+
+// bar is the progress bar on screen, if any.
+var bar *progressBar
+
+// progressInterval limits how often the bar is redrawn on its own.
+const progressInterval = 100 * time.Millisecond
+
+// startProgress shows a progress bar if stderr is a terminal.
+func startProgress() *progressBar {
+	if !term.IsTerminal(int(os.Stderr.Fd())) {
+		return nil
+	}
+	bar = &progressBar{start: time.Now()}
+	return bar
+}
+
+// selected sets the number of files the bar counts up to.
+func (b *progressBar) selected(files int) {
+	if b == nil {
+		return
+	}
+	b.total, b.files, b.bytes = files, 0, 0
+	b.draw(true)
+}
+
+// add counts one reported file, and its size if it was bundled.
+func (b *progressBar) add(e clap.Event) {
+	if b == nil || b.total == 0 {
+		return
+	}
+	b.files++
+	if e.Err == nil && e.Skipped == "" {
+		b.bytes += e.Size
+	}
+	b.draw(false)
+}
+
+// draw redraws the bar, at most every progressInterval unless force is
+// set.
+func (b *progressBar) draw(force bool) {
+	if b == nil || b.total == 0 {
+		return
+	}
+	now := time.Now()
+	if !force && now.Sub(b.drawn) < progressInterval {
+		return
+	}
+	b.drawn = now
+
+	width, _, err := term.GetSize(int(os.Stderr.Fd()))
+	if err != nil || width <= 0 {
+		width = 80
+	}
+	done := float64(b.files) / float64(b.total)
+	eta := "--:--"
+	if elapsed := now.Sub(b.start); b.files > 0 {
+		left := time.Duration(float64(elapsed) * (1 - done) / done).Round(time.Second)
+		eta = fmt.Sprintf("%d:%02d", int(left.Minutes()), int(left.Seconds())%60)
+	}
+	stats := fmt.Sprintf(" %d/%d files  %s  ETA %s", b.files, b.total, clap.FormatSize(b.bytes), eta)
+
+	cells := min(max(width-len(stats)-3, 0), 40)
+	filled := int(done * float64(cells))
+	line := "[" + strings.Repeat("=", filled) + strings.Repeat(" ", cells-filled) + "]" + stats
+	fmt.Fprintf(os.Stderr, "\r%s\x1b[K", truncate(line, width-1))
+	b.shown = true
+}
+
+// clear erases the bar from the screen.
+func (b *progressBar) clear() {
+	if b == nil || !b.shown {
+		return
+	}
+	fmt.Fprint(os.Stderr, "\r\x1b[K")
+	b.shown = false
+}
+
+// finish erases the bar for good.
+func (b *progressBar) finish() {
+	b.clear()
+	if bar == b {
+		bar = nil
+	}
+}
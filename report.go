@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"clap/pkg/clap"
+)
+
+// largestFiles is how many files the summary lists by size.
+const largestFiles = 10
+
+// summary aggregates the files included in a bundle.
+type summary struct {
+	Files      int             `json:"files"`
+	Bytes      int64           `json:"bytes"`
+	Tokens     int             `json:"tokens"`
+	Largest    []fileSummary   `json:"largest"`
+	Extensions []extensionStat `json:"extensions"`
+
+	byExt map[string]*extensionStat
+}
+
+type fileSummary struct {
+	Path   string `json:"path"`
+	Bytes  int64  `json:"bytes"`
+	Tokens int    `json:"tokens"`
+}
+
+type extensionStat struct {
+	Extension string `json:"extension"` // "" for files without one
+	Files     int    `json:"files"`
+	Bytes     int64  `json:"bytes"`
+	Tokens    int    `json:"tokens"`
+}
+
+// add counts one included file.
+func (s *summary) add(e clap.Event) {
+	s.Files++
+	s.Bytes += e.Size
+	s.Tokens += e.Tokens
+	s.Largest = append(s.Largest, fileSummary{Path: e.Path, Bytes: e.Size, Tokens: e.Tokens})
+
+	if s.byExt == nil {
+		s.byExt = map[string]*extensionStat{}
+	}
+	ext := strings.ToLower(path.Ext(e.Path))
+	stat := s.byExt[ext]
+	if stat == nil {
+		stat = &extensionStat{Extension: ext}
+		s.byExt[ext] = stat
+	}
+	stat.Files++
+	stat.Bytes += e.Size
+	stat.Tokens += e.Tokens
+}
+
+// finish trims Largest and fills in Extensions, largest first.
+func (s *summary) finish() {
+	sort.SliceStable(s.Largest, func(i, j int) bool { return s.Largest[i].Bytes > s.Largest[j].Bytes })
+	s.Largest = s.Largest[:min(len(s.Largest), largestFiles)]
+
+	s.Extensions = s.Extensions[:0]
+	for _, stat := range s.byExt {
+		s.Extensions = append(s.Extensions, *stat)
+	}
+	sort.Slice(s.Extensions, func(i, j int) bool {
+		a, b := s.Extensions[i], s.Extensions[j]
+		if a.Bytes != b.Bytes {
+			return a.Bytes > b.Bytes
+		}
+		return a.Extension < b.Extension
+	})
+}
+
+// writeText prints the largest files and the extension breakdown.
+func (s *summary) writeText(w io.Writer) {
+	if s.Files == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\nLargest files:\n")
+	for _, f := range s.Largest {
+		fmt.Fprintf(w, "  %8s %8d tokens  %s\n", clap.FormatSize(f.Bytes), f.Tokens, f.Path)
+	}
+	fmt.Fprintf(w, "\nBy extension:\n")
+	for _, stat := range s.Extensions {
+		ext := stat.Extension
+		if ext == "" {
+			ext = "(none)"
+		}
+		fmt.Fprintf(w, "  %-10s %5d files %8s %8d tokens\n", ext, stat.Files, clap.FormatSize(stat.Bytes), stat.Tokens)
+	}
+}
+
+// writeJSON writes the summary as a single JSON object.
+func (s *summary) writeJSON(w io.Writer) error {
+	if s.Largest == nil {
+		s.Largest = []fileSummary{}
+	}
+	if s.Extensions == nil {
+		s.Extensions = []extensionStat{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
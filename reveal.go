@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+
+	"clap/pkg/clap"
+)
+
+// setupReveal implements "clap reveal": it turns the pseudonyms of an
+// --anonymize bundle, or of anything written about one, back into the
+// names they stand for.
+func setupReveal(fs *flag.FlagSet) func(args []string) error {
+	key := fs.String("key", anonymizeKeyFile, "key file written by pack --anonymize")
+	return func(args []string) error {
+		positional, err := parseInterleaved(fs, args)
+		if err != nil {
+			return err
+		}
+		if len(positional) > 1 {
+			return errUsage
+		}
+		name := "-"
+		if len(positional) == 1 {
+			name = positional[0]
+		}
+		return reveal(name, *key)
+	}
+}
+
+// reveal copies the file at name, or stdin for "-", to stdout with every
+// pseudonym in the key file restored.
+func reveal(name, key string) error {
+	if _, err := os.Stat(key); errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("no key file %s; point --key at the one pack --anonymize wrote", key)
+	}
+	anon, err := clap.LoadAnonymizer(key, nil)
+	if err != nil {
+		return err
+	}
+	in := os.Stdin
+	if name != "-" {
+		if in, err = os.Open(name); err != nil {
+			return err
+		}
+		defer in.Close()
+	}
+	text, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(anon.Restore(text))
+	return err
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"time"
+
+	"clap/pkg/clap"
+)
+
+// setupServe implements "clap serve": it answers bundling requests from
+// other programs instead of writing a bundle once.
+func setupServe(fs *flag.FlagSet) func(args []string) error {
+	mcp := fs.Bool("mcp", false, "speak the Model Context Protocol on stdin and stdout")
+	listen := fs.String("listen", "", "serve bundles of <path> over HTTP on this address, e.g. :8080")
+	ttl := fs.Duration("cache-ttl", 10*time.Second, "with --listen, reuse a response for identical requests this long (0 to always rebuild)")
+	return func(args []string) error {
+		positional, err := parseInterleaved(fs, args)
+		if err != nil {
+			return err
+		}
+		if *mcp == (*listen != "") || *mcp && len(positional) > 0 || len(positional) > 1 {
+			return errUsage
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		if *mcp {
+			// stdout carries the protocol; the log is on stderr.
+			return serveMCP(ctx, os.Stdin, os.Stdout)
+		}
+		dir := "."
+		if len(positional) > 0 {
+			dir = positional[0]
+		}
+		return serveHTTP(ctx, *listen, dir, *ttl)
+	}
+}
+
+// mcpVersions are the protocol revisions the server speaks, newest first.
+var mcpVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+// JSON-RPC error codes used by the server.
+const (
+	rpcParseError     = -32700
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+)
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// serveMCP reads newline-delimited JSON-RPC messages from r and writes the
+// responses to w until r is exhausted or ctx is done. Requests are handled
+// one at a time.
+func serveMCP(ctx context.Context, r io.Reader, w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	send := func(resp rpcResponse) error {
+		resp.JSONRPC = "2.0"
+		return enc.Encode(resp)
+	}
+
+	lines := make(chan []byte)
+	scanErr := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+		for scanner.Scan() {
+			lines <- bytes.Clone(scanner.Bytes())
+		}
+		scanErr <- scanner.Err()
+		close(lines)
+	}()
+
+	logf("Serving MCP on stdio\n")
+	for {
+		var line []byte
+		select {
+		case <-ctx.Done():
+			return nil
+		case l, ok := <-lines:
+			if !ok {
+				return <-scanErr
+			}
+			line = l
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		var req rpcRequest
+		if err := json.Unmarshal(line, &req); err != nil {
+			if err := send(rpcResponse{ID: json.RawMessage("null"), Error: &rpcError{rpcParseError, err.Error()}}); err != nil {
+				return err
+			}
+			continue
+		}
+		result, rpcErr := handleMCP(ctx, req)
+		if req.ID == nil {
+			continue // notifications get no response
+		}
+		if err := send(rpcResponse{ID: req.ID, Result: result, Error: rpcErr}); err != nil {
+			return err
+		}
+	}
+}
+
+// handleMCP dispatches one request.
+func handleMCP(ctx context.Context, req rpcRequest) (any, *rpcError) {
+	switch req.Method {
+	case "initialize":
+		var params struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		json.Unmarshal(req.Params, &params)
+		version := mcpVersions[0]
+		if slices.Contains(mcpVersions, params.ProtocolVersion) {
+			version = params.ProtocolVersion
+		}
+		return map[string]any{
+			"protocolVersion": version,
+			"capabilities":    map[string]any{"tools": map[string]any{}},
+			"serverInfo":      map[string]any{"name": "clap", "version": "1"},
+		}, nil
+
+	case "ping":
+		return map[string]any{}, nil
+
+	case "tools/list":
+		return map[string]any{"tools": mcpTools}, nil
+
+	case "tools/call":
+		var params struct {
+			Name      string   `json:"name"`
+			Arguments mcpInput `json:"arguments"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, &rpcError{rpcInvalidParams, err.Error()}
+		}
+		text, err := callTool(ctx, params.Name, params.Arguments)
+		if errors.Is(err, errUnknownTool) {
+			return nil, &rpcError{rpcInvalidParams, err.Error()}
+		}
+		if err != nil {
+			return mcpText(err.Error(), true), nil
+		}
+		return mcpText(text, false), nil
+	}
+
+	if strings.HasPrefix(req.Method, "notifications/") {
+		return nil, nil
+	}
+	return nil, &rpcError{rpcMethodNotFound, "unknown method " + req.Method}
+}
+
+// mcpText wraps a tool's output as a tools/call result.
+func mcpText(text string, isError bool) map[string]any {
+	return map[string]any{
+		"content": []map[string]any{{"type": "text", "text": text}},
+		"isError": isError,
+	}
+}
+
+// mcpInput holds the arguments shared by every tool.
+type mcpInput struct {
+	Path          string   `json:"path"`
+	Extensions    []string `json:"extensions"`
+	Exclude       []string `json:"exclude"`
+	Format        string   `json:"format"`
+	MaxSize       string   `json:"max_size"`
+	MaxDepth      int      `json:"max_depth"`
+	GitTracked    bool     `json:"git_tracked"`
+	Tree          bool     `json:"tree"`
+	StripComments bool     `json:"strip_comments"`
+	Signatures    bool     `json:"signatures"`
+	Redact        bool     `json:"redact"`
+}
+
+// mcpFilterSchema describes the mcpInput properties common to both tools.
+var mcpFilterSchema = map[string]any{
+	"path":        map[string]any{"type": "string", "description": "directory to bundle"},
+	"extensions":  map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "only include these extensions, e.g. [\"go\", \"md\"]"},
+	"exclude":     map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "skip paths matching these .gitignore-style globs"},
+	"max_size":    map[string]any{"type": "string", "description": "skip files larger than this, e.g. \"200KB\""},
+	"max_depth":   map[string]any{"type": "integer", "description": "only descend this many directory levels"},
+	"git_tracked": map[string]any{"type": "boolean", "description": "only include files tracked by git"},
+}
+
+// mcpFormats are the formats the bundle tool offers: text, since its
+// result is a text content block.
+var mcpFormats = []string{"plain", "markdown", "json", "jsonl", "xml-docs"}
+
+var mcpTools = []map[string]any{
+	{
+		"name":        "bundle",
+		"description": "Bundle the files in a directory into a single text document, respecting .gitignore. Returns the bundle followed by a summary.",
+		"inputSchema": map[string]any{
+			"type":     "object",
+			"required": []string{"path"},
+			"properties": merge(mcpFilterSchema, map[string]any{
+				"format":         map[string]any{"type": "string", "enum": mcpFormats, "description": "output format (default plain)"},
+				"tree":           map[string]any{"type": "boolean", "description": "start with a directory tree"},
+				"strip_comments": map[string]any{"type": "boolean", "description": "remove comments from source files"},
+				"signatures":     map[string]any{"type": "boolean", "description": "keep only declarations and function signatures of Go files"},
+				"redact":         map[string]any{"type": "boolean", "description": "replace secrets with placeholders"},
+			}),
+		},
+	},
+	{
+		"name":        "list",
+		"description": "List the files a bundle of a directory would include, with their sizes, without reading them.",
+		"inputSchema": map[string]any{
+			"type":       "object",
+			"required":   []string{"path"},
+			"properties": mcpFilterSchema,
+		},
+	},
+}
+
+// merge returns the union of two maps; b wins on conflicts.
+func merge(a, b map[string]any) map[string]any {
+	m := maps.Clone(a)
+	maps.Copy(m, b)
+	return m
+}
+
+var errUnknownTool = errors.New("unknown tool")
+
+// callTool runs the named tool and returns its text output.
+func callTool(ctx context.Context, name string, in mcpInput) (string, error) {
+	if name != "bundle" && name != "list" {
+		return "", fmt.Errorf("%w %q", errUnknownTool, name)
+	}
+	if in.Path == "" {
+		return "", fmt.Errorf("path is required")
+	}
+	if in.Format != "" && !slices.Contains(mcpFormats, in.Format) {
+		return "", fmt.Errorf("unknown format %q (want %s)", in.Format, strings.Join(mcpFormats, ", "))
+	}
+	info, err := os.Stat(in.Path)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", in.Path)
+	}
+
+	result, err := runTool(ctx, name, in, clap.Source{FS: os.DirFS(in.Path)}, in.Path, nil)
+	if err != nil {
+		return "", err
+	}
+	if name == "list" {
+		return fmt.Sprintf("%s%d files (%s)\n", result.report, result.files, clap.FormatSize(result.size)), nil
+	}
+	return fmt.Sprintf("%s\n%s%d files, %d bytes, %d tokens\n", result.content, result.report, result.files, result.size, result.tokens), nil
+}
+
+// toolResult is the output of a bundle or list request.
+type toolResult struct {
+	content []byte // the bundle; empty for list
+	report  string // a line per skipped file and, for list, per file
+	files   int
+	size    int64
+	tokens  int
+}
+
+// runTool bundles or lists source as in asks; in.Path is ignored in favor
+// of source. dir is the directory source reads, for git. cache, if not
+// nil, keeps file contents and token counts between calls.
+func runTool(ctx context.Context, name string, in mcpInput, source clap.Source, dir string, cache *clap.Cache) (toolResult, error) {
+	var result toolResult
+	var maxSize int64
+	if in.MaxSize != "" {
+		var err error
+		if maxSize, err = clap.ParseSize(in.MaxSize); err != nil {
+			return result, err
+		}
+	}
+
+	var report strings.Builder
+	opts := clap.Options{
+		Extensions:     in.Extensions,
+		Exclude:        append(in.Exclude, "/"+cacheFile, outputTemp+"*"),
+		Format:         in.Format,
+		MaxSize:        maxSize,
+		MaxDepth:       in.MaxDepth,
+		Tree:           in.Tree,
+		StripComments:  in.StripComments,
+		Signatures:     in.Signatures,
+		Redact:         in.Redact,
+		GlobalExcludes: clap.GlobalExcludesFile(),
+		Cache:          cache,
+		Report: func(e clap.Event) {
+			switch {
+			case e.Err != nil:
+				fmt.Fprintf(&report, "%s (error: %v)\n", e.Path, e.Err)
+			case e.Skipped != "":
+				fmt.Fprintf(&report, "%s (%s, skipped)\n", e.Path, e.Skipped)
+			case name == "list":
+				fmt.Fprintf(&report, "%s (%s)\n", e.Path, clap.FormatSize(e.Size))
+				result.files++
+				result.size += e.Size
+			default:
+				result.files++
+				result.size += e.Size
+				result.tokens += e.Tokens
+			}
+		},
+	}
+	bundler, err := clap.New(opts)
+	if err != nil {
+		return result, err
+	}
+
+	if in.GitTracked {
+		if source.Only, err = clap.GitTrackedFiles(dir); err != nil {
+			return result, err
+		}
+		if source.Only == nil {
+			source.Only = []string{}
+		}
+	}
+
+	if name == "list" {
+		if err := bundler.List(ctx, []clap.Source{source}); err != nil {
+			return result, err
+		}
+		result.report = report.String()
+		return result, nil
+	}
+
+	var out bytes.Buffer
+	if err := bundler.RunSources(ctx, []clap.Source{source}, &out); err != nil {
+		return result, err
+	}
+	result.content, result.report = out.Bytes(), report.String()
+	return result, nil
+}
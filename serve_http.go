@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"clap/pkg/clap"
+)
+
+// httpServer answers /bundle and /list requests for the tree at root.
+// Requests can't reach outside it, through ".." or through symlinks.
+type httpServer struct {
+	root *os.Root
+	dir  string // root's path, for git
+	ttl  time.Duration
+
+	mu        sync.Mutex
+	responses map[string]*httpResponse // by endpoint and canonical query
+	tokens    map[string]*clap.Cache   // by requested subdirectory
+}
+
+// httpResponse is a generated bundle or listing, kept for ttl.
+type httpResponse struct {
+	body        []byte
+	contentType string
+	etag        string
+	result      toolResult
+	created     time.Time
+}
+
+// maxResponses bounds the response cache.
+const maxResponses = 64
+
+// serveHTTP serves the tree at dir on addr until ctx is done.
+func serveHTTP(ctx context.Context, addr, dir string, ttl time.Duration) error {
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+
+	s := &httpServer{root: root, dir: dir, ttl: ttl, responses: map[string]*httpResponse{}, tokens: map[string]*clap.Cache{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /bundle", s.handle("bundle"))
+	mux.HandleFunc("GET /list", s.handle("list"))
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Handler: mux, BaseContext: func(net.Listener) context.Context { return ctx }}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdown)
+	}()
+
+	logf("Serving %s on http://%s\n", dir, listener.Addr())
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// handle returns the handler for the bundle or list endpoint.
+func (s *httpServer) handle(name string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		in, err := parseQuery(query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		sub, err := sandboxPath(in.Path)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		key := name + "?" + query.Encode()
+		resp := s.cached(key)
+		if resp == nil {
+			if resp, err = s.generate(r.Context(), name, in, sub); err != nil {
+				status := http.StatusInternalServerError
+				switch {
+				case errors.Is(err, fs.ErrNotExist):
+					status = http.StatusNotFound
+				case errors.Is(err, fs.ErrPermission):
+					status = http.StatusForbidden
+				}
+				http.Error(w, err.Error(), status)
+				return
+			}
+			s.store(key, resp)
+		}
+
+		h := w.Header()
+		h.Set("ETag", resp.etag)
+		h.Set("X-Clap-Files", strconv.Itoa(resp.result.files))
+		h.Set("X-Clap-Bytes", strconv.FormatInt(resp.result.size, 10))
+		if name == "bundle" {
+			h.Set("X-Clap-Tokens", strconv.Itoa(resp.result.tokens))
+		}
+		if r.Header.Get("If-None-Match") == resp.etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		h.Set("Content-Type", resp.contentType)
+		w.Write(resp.body)
+	}
+}
+
+// generate builds a fresh response for the subdirectory sub.
+func (s *httpServer) generate(ctx context.Context, name string, in mcpInput, sub string) (*httpResponse, error) {
+	fsys, err := fs.Sub(s.root.FS(), sub)
+	if err != nil {
+		return nil, err
+	}
+	info, err := fs.Stat(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", sub, errors.Unwrap(err))
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", sub)
+	}
+
+	s.mu.Lock()
+	cache := s.tokens[sub]
+	if cache == nil {
+		cache = clap.NewCache()
+		s.tokens[sub] = cache
+	}
+	s.mu.Unlock()
+
+	result, err := runTool(ctx, name, in, clap.Source{FS: fsys}, filepath.Join(s.dir, filepath.FromSlash(sub)), cache)
+	if err != nil {
+		return nil, err
+	}
+	resp := &httpResponse{body: result.content, contentType: contentType(in.Format), result: result, created: time.Now()}
+	if name == "list" {
+		resp.body = []byte(fmt.Sprintf("%s%d files (%s)\n", result.report, result.files, clap.FormatSize(result.size)))
+		resp.contentType = "text/plain; charset=utf-8"
+	}
+	sum := sha256.Sum256(resp.body)
+	resp.etag = `"` + hex.EncodeToString(sum[:8]) + `"`
+	return resp, nil
+}
+
+// cached returns the stored response for key if it is younger than ttl.
+func (s *httpServer) cached(key string) *httpResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resp := s.responses[key]
+	if resp == nil || time.Since(resp.created) >= s.ttl {
+		return nil
+	}
+	return resp
+}
+
+// store keeps resp for key, dropping expired responses, and the oldest
+// when the cache is full.
+func (s *httpServer) store(key string, resp *httpResponse) {
+	if s.ttl <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var oldest string
+	for k, r := range s.responses {
+		if time.Since(r.created) >= s.ttl {
+			delete(s.responses, k)
+		} else if oldest == "" || r.created.Before(s.responses[oldest].created) {
+			oldest = k
+		}
+	}
+	if len(s.responses) >= maxResponses {
+		delete(s.responses, oldest)
+	}
+	s.responses[key] = resp
+}
+
+// parseQuery reads the bundle options from a query string. They are named
+// as in the MCP tools; ext and exclude may be repeated or comma-separated.
+func parseQuery(query url.Values) (mcpInput, error) {
+	in := mcpInput{
+		Path:    query.Get("path"),
+		Format:  query.Get("format"),
+		MaxSize: query.Get("max_size"),
+	}
+	list := func(key string) []string {
+		var values commaList
+		for _, v := range query[key] {
+			values.Set(v)
+		}
+		return values
+	}
+	in.Extensions = list("ext")
+	in.Exclude = list("exclude")
+
+	var errs []error
+	if in.Format != "" && !slices.Contains(formatNames, in.Format) {
+		errs = append(errs, fmt.Errorf("format: unknown format %q (want %s)", in.Format, strings.Join(formatNames, ", ")))
+	}
+	flag := func(key string) bool {
+		v := query.Get(key)
+		if v == "" {
+			return false
+		}
+		on, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", key, err))
+		}
+		return on
+	}
+	in.GitTracked = flag("git_tracked")
+	in.Tree = flag("tree")
+	in.StripComments = flag("strip_comments")
+	in.Signatures = flag("signatures")
+	in.Redact = flag("redact")
+	if v := query.Get("max_depth"); v != "" {
+		depth, err := strconv.Atoi(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("max_depth: %v", err))
+		}
+		in.MaxDepth = depth
+	}
+	return in, errors.Join(errs...)
+}
+
+// sandboxPath turns a requested path into a slash-separated one below the
+// served root, rejecting anything that would leave it.
+func sandboxPath(p string) (string, error) {
+	if p == "" {
+		return ".", nil
+	}
+	p = path.Clean(strings.TrimPrefix(filepath.ToSlash(p), "/"))
+	if !fs.ValidPath(p) {
+		return "", fmt.Errorf("path %q is outside the served tree", p)
+	}
+	return p, nil
+}
+
+// contentType returns the media type of a bundle in format.
+func contentType(format string) string {
+	switch format {
+	case "markdown", "md":
+		return "text/markdown; charset=utf-8"
+	case "json":
+		return "application/json"
+	case "jsonl", "ndjson":
+		return "application/x-ndjson"
+	case "html":
+		return "text/html; charset=utf-8"
+	case "xml-docs", "xml":
+		return "application/xml"
+	case "zip":
+		return "application/zip"
+	case "tar.gz", "tgz":
+		return "application/gzip"
+	case "sqlite":
+		return "application/vnd.sqlite3"
+	}
+	return "text/plain; charset=utf-8"
+}
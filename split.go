@@ -0,0 +1,169 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"filippo.io/age"
+
+	"clap/pkg/clap"
+)
+
+// partTemp prefixes the temporary files parts are written to before they
+// are numbered.
+const partTemp = ".clap-part-"
+
+// parseSplit parses a --split limit. A plain size such as "100k" or
+// "1.5MB" limits bytes; a "t" or "tokens" suffix, as in "100kt" or
+// "50000 tokens", limits tokens, with k and m counted in thousands.
+func parseSplit(s string) (int64, int, error) {
+	value := strings.ToLower(strings.TrimSpace(s))
+	for _, suffix := range []string{"tokens", "token", "t"} {
+		if !strings.HasSuffix(value, suffix) {
+			continue
+		}
+		value = strings.TrimSpace(strings.TrimSuffix(value, suffix))
+		multiplier := 1.0
+		switch {
+		case strings.HasSuffix(value, "k"):
+			multiplier = 1e3
+		case strings.HasSuffix(value, "m"):
+			multiplier = 1e6
+		}
+		n, err := strconv.ParseFloat(strings.TrimRight(value, "km"), 64)
+		if err != nil || n*multiplier < 1 {
+			return 0, 0, fmt.Errorf("invalid token limit %q", s)
+		}
+		return 0, int(n * multiplier), nil
+	}
+
+	n, err := clap.ParseSize(s)
+	if err != nil {
+		return 0, 0, err
+	}
+	if n < 1 {
+		return 0, 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n, 0, nil
+}
+
+// partPath numbers the output path for part n: "clap.file" becomes
+// "clap.001.file".
+func partPath(output string, n int) string {
+	ext := filepath.Ext(output)
+	return fmt.Sprintf("%s.%03d%s", strings.TrimSuffix(output, ext), n, ext)
+}
+
+// partPattern is the --skip-output glob matching every part of output.
+func partPattern(output string) string {
+	base := filepath.Base(output)
+	ext := filepath.Ext(base)
+	return strings.TrimSuffix(base, ext) + ".[0-9][0-9][0-9]" + ext
+}
+
+// isPart reports whether name is a part of output or one of its
+// temporary files.
+func isPart(output, name string) bool {
+	if filepath.Dir(name) != filepath.Dir(output) {
+		return false
+	}
+	base := filepath.Base(name)
+	if strings.HasPrefix(base, partTemp) {
+		return true
+	}
+	matched, _ := filepath.Match(partPattern(output), base)
+	return matched
+}
+
+// parts writes a split bundle. Parts go to temporary files until the
+// total is known, then commit copies each to its numbered path behind its
+// header, compressed with --compress and encrypted with --encrypt.
+type parts struct {
+	output     string
+	compress   string
+	recipients []age.Recipient
+	temps      []*os.File
+}
+
+// next opens the temporary file for the next part.
+func (p *parts) next() (io.Writer, error) {
+	f, err := os.CreateTemp(filepath.Dir(p.output), partTemp+"*")
+	if err != nil {
+		return nil, err
+	}
+	p.temps = append(p.temps, f)
+	return f, nil
+}
+
+// commit writes the numbered parts, removes parts left over from an
+// earlier, longer run, and returns the paths written.
+func (p *parts) commit(header func(part, total int) string) ([]string, error) {
+	names := make([]string, len(p.temps))
+	for i, temp := range p.temps {
+		names[i] = partPath(p.output, i+1)
+		if err := writePart(names[i], header(i+1, len(p.temps)), temp, p.compress, p.recipients); err != nil {
+			return nil, fmt.Errorf("writing %s: %v", names[i], err)
+		}
+	}
+	for n := len(p.temps) + 1; ; n++ {
+		if err := os.Remove(partPath(p.output, n)); err != nil {
+			break
+		}
+	}
+	return names, nil
+}
+
+// writePart writes header and the content of temp to name, compressed
+// with method if it isn't "" and encrypted to recipients if there are any,
+// through a temporary file so name is never left half-written.
+func writePart(name, header string, temp *os.File, method string, recipients []age.Recipient) error {
+	if _, err := temp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(name), partTemp+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	w, err := newEncoder(f, method, recipients)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := io.WriteString(w, header); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := io.Copy(w, temp); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), name)
+}
+
+// cleanup closes and removes the temporary files.
+func (p *parts) cleanup() error {
+	var errs []error
+	for _, temp := range p.temps {
+		errs = append(errs, temp.Close(), os.Remove(temp.Name()))
+	}
+	p.temps = nil
+	return errors.Join(errs...)
+}
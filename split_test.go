@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"clap/pkg/clap"
+)
+
+func TestParseSplit(t *testing.T) {
+	tests := []struct {
+		in     string
+		bytes  int64
+		tokens int
+	}{
+		{"100", 100, 0},
+		{"2k", 2 << 10, 0},
+		{"100kt", 0, 100000},
+		{"1.5m tokens", 0, 1500000},
+		{"50000 token", 0, 50000},
+		{"0", 0, 0},
+		{"0.5t", 0, 0},
+		{"k tokens", 0, 0},
+	}
+	for _, tt := range tests {
+		bytes, tokens, err := parseSplit(tt.in)
+		if tt.bytes == 0 && tt.tokens == 0 {
+			if err == nil {
+				t.Errorf("parseSplit(%q) = %d, %d, want an error", tt.in, bytes, tokens)
+			}
+			continue
+		}
+		if err != nil || bytes != tt.bytes || tokens != tt.tokens {
+			t.Errorf("parseSplit(%q) = %d, %d, %v, want %d, %d", tt.in, bytes, tokens, err, tt.bytes, tt.tokens)
+		}
+	}
+}
+
+func TestPartPath(t *testing.T) {
+	if got, want := partPath(filepath.Join("out", "clap.file"), 7), filepath.Join("out", "clap.007.file"); got != want {
+		t.Errorf("partPath = %q, want %q", got, want)
+	}
+	if !isPart("clap.file", "clap.012.file") || isPart("clap.file", "clap.1.file") || isPart("clap.file", filepath.Join("sub", "clap.001.file")) {
+		t.Error("isPart doesn't match just the parts beside the output")
+	}
+}
+
+// splitTree has files of up to 40 bytes and one of 253, larger than a
+// 100-byte part. 3.txt has lines a part header or separator could be
+// mistaken for.
+var splitTree = fstest.MapFS{
+	"1.txt":     {Data: []byte(strings.Repeat("one ", 9) + "one\n")},
+	"2.txt":     {Data: []byte(strings.Repeat("two ", 9) + "two\n")},
+	"3.txt":     {Data: []byte(strings.Repeat("=== ", 9) + "hi\n\n")},
+	"4-big.txt": {Data: []byte(strings.Repeat("big line\n", 27) + "big line!\n")},
+	"5.txt":     {Data: []byte("five\n")},
+}
+
+// writeSplit bundles splitTree into dir with opts, the way clap does with
+// --split, and returns the parts written and the part each file went in.
+func writeSplit(t *testing.T, dir string, opts clap.Options) ([]string, map[string]int) {
+	t.Helper()
+	placed := map[string]int{}
+	opts.Placed = func(pl clap.Placement) { placed[pl.Path] = pl.Part }
+	b, err := clap.New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &parts{output: filepath.Join(dir, "clap.file")}
+	defer p.cleanup()
+	if err := b.RunParts(context.Background(), []clap.Source{{FS: splitTree}}, p.next); err != nil {
+		t.Fatal(err)
+	}
+	names, err := p.commit(b.PartHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return names, placed
+}
+
+func TestSplit(t *testing.T) {
+	dir := t.TempDir()
+	// An earlier, longer run left a part behind.
+	stale := partPath(filepath.Join(dir, "clap.file"), 5)
+	if err := os.WriteFile(stale, []byte("stale"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	names, placed := writeSplit(t, dir, clap.Options{SplitBytes: 100})
+	want := map[string]int{"1.txt": 1, "2.txt": 1, "3.txt": 2, "4-big.txt": 3, "5.txt": 4}
+	if fmt.Sprint(placed) != fmt.Sprint(want) {
+		t.Errorf("files went in parts %v, want %v", placed, want)
+	}
+	if len(names) != 4 {
+		t.Fatalf("wrote %d parts, want 4", len(names))
+	}
+	if _, err := os.Stat(stale); err == nil {
+		t.Error("part left over from an earlier run wasn't removed")
+	}
+
+	for i, name := range names {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header := fmt.Sprintf("--- part %d/4 ---\n\n", i+1); !strings.HasPrefix(string(data), header) {
+			t.Errorf("%s doesn't start with %q:\n%s", name, header, data)
+		}
+		// Every part reads back as whole files, the ones placed in it.
+		var read []string
+		err = clap.ReadBundleFiles(strings.NewReader(string(data)), func(f clap.BundleFile) error {
+			read = append(read, f.Path)
+			if string(f.Content) != string(splitTree[f.Path].Data) {
+				t.Errorf("%s read back from %s as %q, want %q", f.Path, name, f.Content, splitTree[f.Path].Data)
+			}
+			if placed[f.Path] != i+1 {
+				t.Errorf("%s read back from part %d, placed in %d", f.Path, i+1, placed[f.Path])
+			}
+			return nil
+		})
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		if len(read) == 0 {
+			t.Errorf("%s holds no files", name)
+		}
+	}
+}
+
+func TestSplitTokens(t *testing.T) {
+	tokens := map[string]int{}
+	opts := clap.Options{
+		SplitTokens: 30,
+		Report:      func(e clap.Event) { tokens[e.Path] = e.Tokens },
+	}
+	_, placed := writeSplit(t, t.TempDir(), opts)
+
+	total := map[int]int{}
+	files := map[int]int{}
+	for path, part := range placed {
+		total[part] += tokens[path]
+		files[part]++
+	}
+	for part, n := range total {
+		if n > opts.SplitTokens && files[part] > 1 {
+			t.Errorf("part %d has %d tokens in %d files, over the %d limit", part, n, files[part], opts.SplitTokens)
+		}
+	}
+	if len(total) < 2 {
+		t.Errorf("split into %d parts, want several: %v", len(total), placed)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"clap/pkg/clap"
+)
+
+// setupStats implements "clap stats": it reads the files a bundle would
+// include, with the usual bundling flags and config, and shows how the
+// files, bytes, and tokens divide up by directory, heaviest first.
+func setupStats(fs *flag.FlagSet) func(args []string) error {
+	p := newPacker(fs)
+	depth := fs.Int("depth", 3, "show directories this many levels down (0 for all)")
+	showFiles := fs.Bool("files", false, "list files too, not just directories")
+	return func(args []string) error {
+		if err := p.parse(args); err != nil {
+			return err
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		defer p.close()
+		return p.stats(ctx, *depth, *showFiles)
+	}
+}
+
+// statsNode totals the included files at or below one path.
+type statsNode struct {
+	name     string
+	dir      bool
+	files    int
+	bytes    int64
+	tokens   int
+	children map[string]*statsNode
+}
+
+// add counts a file of size bytes and tokens under the path parts.
+func (n *statsNode) add(parts []string, size int64, tokens int) {
+	n.files++
+	n.bytes += size
+	n.tokens += tokens
+	if len(parts) == 0 {
+		return
+	}
+	if n.children == nil {
+		n.children = map[string]*statsNode{}
+	}
+	child, ok := n.children[parts[0]]
+	if !ok {
+		child = &statsNode{name: parts[0], dir: len(parts) > 1}
+		n.children[parts[0]] = child
+	}
+	child.add(parts[1:], size, tokens)
+}
+
+// sorted returns the children, the most tokens first.
+func (n *statsNode) sorted(showFiles bool) []*statsNode {
+	var children []*statsNode
+	for _, child := range n.children {
+		if child.dir || showFiles {
+			children = append(children, child)
+		}
+	}
+	slices.SortFunc(children, func(x, y *statsNode) int {
+		return cmp.Or(cmp.Compare(y.tokens, x.tokens), cmp.Compare(y.bytes, x.bytes), cmp.Compare(x.name, y.name))
+	})
+	return children
+}
+
+// stats bundles the tree to nowhere and prints the totals by directory.
+func (p *packer) stats(ctx context.Context, depth int, showFiles bool) error {
+	if depth < 0 {
+		return fmt.Errorf("--depth: want zero or more levels")
+	}
+	opts, err := p.options()
+	if err != nil {
+		return err
+	}
+	// Only content is counted, so the format and its framing don't matter.
+	opts.Format, opts.Header, opts.Footer, opts.HeaderMeta, opts.Framing = "", "", "", nil, ""
+	opts.Tree, opts.FrontMatter = false, nil
+	opts.SplitBytes, opts.SplitTokens = 0, 0
+	if *p.useCache {
+		if err := p.loadCache(); err != nil {
+			return err
+		}
+		opts.Cache = p.cache
+	}
+
+	root := &statsNode{name: ".", dir: true}
+	opts.Report = func(e clap.Event) {
+		switch {
+		case e.Err != nil:
+			logError(fmt.Errorf("reading %s: %v", e.Path, e.Err))
+		case e.Skipped == "":
+			root.add(strings.Split(filepath.ToSlash(e.Path), "/"), e.Size, e.Tokens)
+		}
+	}
+
+	sources, closeSources, err := p.sources(ctx)
+	defer closeSources()
+	if err != nil {
+		return err
+	}
+	bundler, err := clap.New(opts)
+	if err != nil {
+		return err
+	}
+	if err := bundler.RunSources(ctx, sources, io.Discard); err != nil {
+		return fmt.Errorf("reading %s: %v", strings.Join(p.paths, ", "), err)
+	}
+	if p.cache != nil {
+		if err := p.cache.Save(filepath.Join(p.path, cacheFile)); err != nil {
+			logError(fmt.Errorf("saving cache: %v", err))
+		}
+	}
+	if p.anon != nil {
+		if err := p.anon.Save(p.anonymizeKeyPath()); err != nil {
+			return fmt.Errorf("saving %s: %v", p.anonymizeKeyPath(), err)
+		}
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	fmt.Fprintf(out, "%10s %8s %7s  %s\n", "tokens", "size", "files", "path")
+	writeStats(out, root, "", "", depth, showFiles)
+	return out.Flush()
+}
+
+// writeStats writes node's line and, while depth allows, its children's,
+// with tree art like --tree.
+func writeStats(w io.Writer, node *statsNode, branch, indent string, depth int, showFiles bool) {
+	// A directory holding nothing but another shares its line, so a root
+	// such as /home/me/api doesn't take one per level.
+	name := node.name
+	for len(node.children) == 1 {
+		var only *statsNode
+		for _, child := range node.children {
+			only = child
+		}
+		if !only.dir {
+			break
+		}
+		if name == "." {
+			name = only.name
+		} else {
+			name += "/" + only.name
+		}
+		node = only
+	}
+	if node.dir && name != "." {
+		name += "/"
+	}
+	files := fmt.Sprint(node.files)
+	if !node.dir {
+		files = ""
+	}
+	fmt.Fprintf(w, "%10d %8s %7s  %s%s\n", node.tokens, clap.FormatSize(node.bytes), files, branch, name)
+	if depth == 1 {
+		return
+	}
+	children := node.sorted(showFiles)
+	for i, child := range children {
+		branch, next := "├── ", "│   "
+		if i == len(children)-1 {
+			branch, next = "└── ", "    "
+		}
+		writeStats(w, child, indent+branch, indent+next, max(depth-1, 0), showFiles)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+
+	"clap/pkg/clap"
+)
+
+// setupUnpack implements "clap unpack": it splits a plain bundle back
+// into the files it was built from.
+func setupUnpack(fs *flag.FlagSet) func(args []string) error {
+	outDir := fs.String("out", ".", "directory to write files into")
+	var identityFiles stringList
+	fs.Var(&identityFiles, "identity", "age key file to decrypt an --encrypt bundle with (repeatable)")
+	return func(args []string) error {
+		positional, err := parseInterleaved(fs, args)
+		if err != nil {
+			return err
+		}
+		if len(positional) != 1 {
+			return errUsage
+		}
+		identities, err := loadIdentities(identityFiles)
+		if err != nil {
+			return err
+		}
+		return unpack(hostPath(positional[0]), hostPath(*outDir), identities)
+	}
+}
+
+// unpack writes every file in the bundle at bundlePath below outDir. Files
+// bundled with --header-meta are checked against their size and SHA-256,
+// and get their mode and mtime back. Encrypted bundles are decrypted with
+// identities.
+func unpack(bundlePath, outDir string, identities []age.Identity) error {
+	bundle, err := openBundle(bundlePath, identities)
+	if err != nil {
+		return fmt.Errorf("opening bundle %s: %v", bundlePath, err)
+	}
+	defer bundle.Close()
+
+	count, mismatched := 0, 0
+	err = clap.ReadBundleFiles(bundle, func(f clap.BundleFile) error {
+		path, content := f.Path, f.Content
+		target, err := safeJoin(outDir, path)
+		if err != nil {
+			logf("Skipping %s: %v\n", path, err)
+			return nil
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if problem := verifyMeta(f); problem != "" {
+			logf("Checksum mismatch for %s: %s\n", path, problem)
+			mismatched++
+		}
+		perm := os.FileMode(0644)
+		if mode, ok := parseMode(f.Meta[clap.MetaMode]); ok {
+			perm = mode
+		}
+		if err := os.WriteFile(target, content, perm); err != nil {
+			return err
+		}
+		if mtime, err := time.Parse(time.RFC3339, f.Meta[clap.MetaMtime]); err == nil {
+			os.Chtimes(target, mtime, mtime)
+		}
+
+		logf("%s (%d bytes)\n", target, len(content))
+		count++
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("unpacking %s: %v", bundlePath, err)
+	}
+
+	logf("Unpacked %d files into %s\n", count, outDir)
+	if mismatched > 0 {
+		return fmt.Errorf("%d files don't match their bundled checksums", mismatched)
+	}
+	return nil
+}
+
+// verifyMeta checks a file's content against its bundled size and
+// SHA-256, if present, and describes the first mismatch.
+func verifyMeta(f clap.BundleFile) string {
+	if size, ok := f.Meta[clap.MetaSize]; ok && size != strconv.Itoa(len(f.Content)) {
+		return fmt.Sprintf("%d bytes, want %s", len(f.Content), size)
+	}
+	if want, ok := f.Meta[clap.MetaSHA256]; ok {
+		sum := sha256.Sum256(f.Content)
+		if got := hex.EncodeToString(sum[:]); got != want {
+			return fmt.Sprintf("sha256 %s, want %s", got, want)
+		}
+	}
+	return ""
+}
+
+// parseMode reads the permission bits of a mode such as -rwxr-xr-x.
+func parseMode(s string) (os.FileMode, bool) {
+	if len(s) != 10 {
+		return 0, false
+	}
+	var mode os.FileMode
+	for i, c := range s[1:] {
+		switch {
+		case byte(c) == "rwxrwxrwx"[i]:
+			mode |= 1 << (8 - i)
+		case c != '-':
+			return 0, false
+		}
+	}
+	return mode, true
+}
+
+// safeJoin joins a bundle path onto root, rejecting paths that would land
+// outside it. Absolute bundle paths are treated as relative to root.
+func safeJoin(root, name string) (string, error) {
+	name = filepath.FromSlash(name)
+	name = strings.TrimPrefix(name, filepath.VolumeName(name))
+	rel := filepath.Clean(strings.TrimLeft(name, string(filepath.Separator)))
+
+	for _, elem := range strings.Split(rel, string(filepath.Separator)) {
+		if reservedName(elem) {
+			return "", fmt.Errorf("%s is a reserved name on this system", elem)
+		}
+	}
+	if !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("path escapes %s", root)
+	}
+	return filepath.Join(root, rel), nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSafeJoin(t *testing.T) {
+	root := filepath.Join("out", "restored")
+	tests := []struct {
+		name string
+		want string // "" for an error
+	}{
+		{"main.go", filepath.Join(root, "main.go")},
+		{"pkg/clap/clap.go", filepath.Join(root, "pkg", "clap", "clap.go")},
+		{"./docs/../README.md", filepath.Join(root, "README.md")},
+		// Absolute paths land below root.
+		{"/etc/passwd", filepath.Join(root, "etc", "passwd")},
+		{"../escape.go", ""},
+		{"a/../../escape.go", ""},
+		{"..", ""},
+	}
+	for _, tt := range tests {
+		got, err := safeJoin(root, tt.name)
+		switch {
+		case tt.want == "" && err == nil:
+			t.Errorf("safeJoin(%q) = %q, want an error", tt.name, got)
+		case tt.want != "" && (err != nil || got != tt.want):
+			t.Errorf("safeJoin(%q) = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"clap/pkg/clap"
+)
+
+// setupVerify implements "clap verify": it rebuilds a bundle from the tree
+// with the usual bundling flags and config, and fails if the bundle on
+// disk no longer matches.
+func setupVerify(fs *flag.FlagSet) func(args []string) error {
+	p := newPacker(fs)
+	unified := fs.Bool("u", false, "print a unified diff of each stale file")
+	return func(args []string) error {
+		positional, err := parseInterleaved(fs, args)
+		if err != nil {
+			return err
+		}
+		if len(positional) == 0 {
+			return errUsage
+		}
+		bundlePath := positional[0]
+		if err := p.parse(positional[1:]); err != nil {
+			return err
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		defer p.close()
+		return p.verify(ctx, bundlePath, *unified)
+	}
+}
+
+// verify compares the plain bundle at bundlePath with a fresh bundle of
+// the tree, listing every file that was added, removed, or changed since.
+func (p *packer) verify(ctx context.Context, bundlePath string, unified bool) error {
+	oldFiles, oldOrder, err := readBundleFile(bundlePath)
+	if err != nil {
+		return err
+	}
+
+	opts, err := p.options()
+	if err != nil {
+		return err
+	}
+	if opts.Format != "" && opts.Format != "plain" || opts.Header != "" || opts.Footer != "" {
+		return fmt.Errorf("clap verify reads plain bundles, without --format, --header, or --footer")
+	}
+	opts.Tree, opts.FrontMatter = false, nil
+	opts.SplitBytes, opts.SplitTokens = 0, 0
+	opts.Output, _ = os.Stat(bundlePath)
+	if *p.useCache {
+		if err := p.loadCache(); err != nil {
+			return err
+		}
+		opts.Cache = p.cache
+	}
+
+	sources, closeSources, err := p.sources(ctx)
+	defer closeSources()
+	if err != nil {
+		return err
+	}
+	bundler, err := clap.New(opts)
+	if err != nil {
+		return err
+	}
+	var fresh bytes.Buffer
+	if err := bundler.RunSources(ctx, sources, &fresh); err != nil {
+		return fmt.Errorf("bundling %s: %v", strings.Join(p.paths, ", "), err)
+	}
+	newFiles, newOrder, err := readBundleFiles(&fresh)
+	if err != nil && len(newFiles) > 0 {
+		return fmt.Errorf("reading fresh bundle: %v", err)
+	}
+
+	added, removed, changed := listChanges(oldFiles, oldOrder, newFiles, newOrder)
+	if added+removed+changed == 0 {
+		logf("%s is up to date (%d files)\n", bundlePath, len(oldOrder))
+		return nil
+	}
+	if unified {
+		if err := writeUnifiedAll(oldFiles, oldOrder, newFiles, newOrder, 3); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("%s is stale: %d added, %d removed, %d changed", bundlePath, added, removed, changed)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"clap/pkg/clap"
+)
+
+// setupWatch implements "clap watch": it builds the bundle, then rebuilds
+// it whenever something in the tree changes, until interrupted.
+func setupWatch(fs *flag.FlagSet) func(args []string) error {
+	p := newPacker(fs)
+	debounce := fs.Duration("debounce", 300*time.Millisecond, "quiet period after a change before rebuilding")
+	return func(args []string) error {
+		if err := p.parse(args); err != nil {
+			return err
+		}
+		if slices.ContainsFunc(p.paths, clap.IsGitURL) {
+			return fmt.Errorf("clap watch needs local paths, not a git URL")
+		}
+		return watch(p, *debounce)
+	}
+}
+
+// watch runs p's build on every change until interrupted.
+func watch(p *packer, debounce time.Duration) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("starting watcher: %v", err)
+	}
+	defer watcher.Close()
+
+	for _, path := range p.paths {
+		if err := watchTree(watcher, path); err != nil {
+			return fmt.Errorf("watching %s: %v", path, err)
+		}
+	}
+
+	build := func() {
+		if err := p.runAll(ctx); err != nil && ctx.Err() == nil {
+			logError(err)
+		}
+	}
+	build()
+	logf("Watching %s for changes (Ctrl-C to stop)\n", strings.Join(p.paths, ", "))
+
+	// Changes are coalesced: each event restarts the timer, and the bundle
+	// is rebuilt once the tree has been quiet for the debounce period.
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if p.isOutput(event.Name) {
+				continue
+			}
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if err := watchTree(watcher, event.Name); err != nil {
+						logError(fmt.Errorf("watching %s: %v", event.Name, err))
+					}
+				}
+			}
+			timer.Reset(debounce)
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			logError(fmt.Errorf("watching: %v", err))
+
+		case <-timer.C:
+			logf("Change detected, rebuilding\n")
+			build()
+
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// watchTree adds root and every directory below it, except .git, to the
+// watcher. fsnotify watches are not recursive.
+func watchTree(watcher *fsnotify.Watcher, root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if d.Name() == ".git" && path != root {
+			return filepath.SkipDir
+		}
+		return watcher.Add(path)
+	})
+}